@@ -23,29 +23,21 @@ func main() {
 
 	tasks := []types.Task{
 		{
-			Database:     "default",
-			Table:        "test_table_agg",
-			PartitionKey: time.Hour * 24,
+			Database:         "default",
+			Table:            "test_table_agg",
+			PartitionKey:     time.Hour * 24,
+			ResolutionColumn: "rollup_interval",
 			RollUpSettings: []types.RollUpSetting{
 				{
 					After:    time.Hour * 24,
 					Interval: time.Hour,
-					ColumnSettings: []types.ColumnSetting{
-						{
-							Name:       "rollup_interval",
-							Expression: "3600",
-						},
-					},
 				},
 			},
 			ColumnSettings: []types.ColumnSetting{
 				{
 					Name: "col1",
 				},
-				{
-					Name:       "counter",
-					Expression: "countStateMerge(counter)",
-				},
+				types.MergeState("counter", "count"),
 				{
 					Name:         "event_time",
 					IsRollUpTime: true,
@@ -75,5 +67,25 @@ func main() {
 
 	for event := range eventsChan {
 		fmt.Println(event.String()) // we can log/alert error of rollup here.
+
+		// Reports can be used to log or chart roll up results.
+		for _, report := range event.Reports {
+			for _, shardReport := range report.Shards {
+				if shardReport.Skipped {
+					continue
+				}
+
+				fmt.Printf(
+					"%s.%s on %s: %d -> %d rows, %d -> %d bytes\n",
+					report.Database,
+					report.Table,
+					shardReport.Shard,
+					shardReport.RowsRead,
+					shardReport.RowsWritten,
+					shardReport.BytesBefore,
+					shardReport.BytesAfter,
+				)
+			}
+		}
 	}
 }
@@ -8,6 +8,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
+	"unicode"
 
 	sqlUtils "github.com/ozontech/ch-rollup/internal/utils/sql"
 	"github.com/ozontech/ch-rollup/pkg/database"
@@ -40,3 +42,96 @@ func DropTable(ctx context.Context, shard database.Shard, databaseName, tableNam
 
 	return nil
 }
+
+// TruncateTable ...
+func TruncateTable(ctx context.Context, shard database.Shard, databaseName, tableName string) error {
+	if sqlUtils.ValidateEntityName(databaseName) != nil || sqlUtils.ValidateEntityName(tableName) != nil {
+		return errInvalidArguments
+	}
+
+	if err := shard.Exec(ctx, "TRUNCATE TABLE "+sqlUtils.QuotedDatabaseEntity(databaseName, tableName)); err != nil {
+		return fmt.Errorf("failed to truncate table %s in %s: %w", tableName, databaseName, err)
+	}
+
+	return nil
+}
+
+var errNotReplicatedEngine = errors.New("table engine is not replicated")
+
+// CreateReplicatedTableAs creates dstTableName with the same structure and engine as srcTableName,
+// but with replication path replaced by zooKeeperPath. It is needed because 'CREATE TABLE AS'
+// copies replication path of Replicated*MergeTree tables and new table conflicts with origin.
+func CreateReplicatedTableAs(ctx context.Context, shard database.Shard, databaseName, srcTableName, dstTableName, zooKeeperPath string) error {
+	if sqlUtils.ValidateEntityName(databaseName) != nil || sqlUtils.ValidateEntityName(srcTableName) != nil || sqlUtils.ValidateEntityName(dstTableName) != nil {
+		return errInvalidArguments
+	}
+
+	var engineFull string
+
+	err := shard.QueryRow(
+		ctx,
+		"SELECT engine_full FROM system.tables WHERE database = ? AND name = ?",
+		databaseName,
+		srcTableName,
+	).Scan(&engineFull)
+	if err != nil {
+		return fmt.Errorf("failed to get engine of %s in %s: %w", srcTableName, databaseName, err)
+	}
+
+	engine, err := ReplaceReplicationPath(engineFull, zooKeeperPath)
+	if err != nil {
+		return fmt.Errorf("failed to prepare engine of %s in %s: %w", dstTableName, databaseName, err)
+	}
+
+	if err = shard.Exec(ctx, fmt.Sprintf("CREATE TABLE %s AS %s ENGINE = %s", sqlUtils.QuotedDatabaseEntity(databaseName, dstTableName), sqlUtils.QuotedDatabaseEntity(databaseName, srcTableName), engine)); err != nil {
+		return fmt.Errorf("failed to create table %s as %s in %s: %w", dstTableName, srcTableName, databaseName, err)
+	}
+
+	return nil
+}
+
+// IsReplicatedEngine reports whether engine definition (as it is shown at system.tables.engine_full) is Replicated*MergeTree.
+func IsReplicatedEngine(engineFull string) bool {
+	return strings.HasPrefix(engineName(engineFull), "Replicated")
+}
+
+func engineName(engineFull string) string {
+	nameEnd := strings.IndexFunc(engineFull, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+	if nameEnd == -1 {
+		return engineFull
+	}
+
+	return engineFull[:nameEnd]
+}
+
+// ReplaceReplicationPath replaces the first argument of Replicated*MergeTree engine definition
+// (as it is shown at system.tables.engine_full) with zooKeeperPath.
+// If engine defined without arguments, zooKeeperPath and '{replica}' macro will be added.
+func ReplaceReplicationPath(engineFull, zooKeeperPath string) (string, error) {
+	if !IsReplicatedEngine(engineFull) {
+		return "", errNotReplicatedEngine
+	}
+
+	nameEnd := len(engineName(engineFull))
+
+	quotedPath := sqlUtils.QuotedString(zooKeeperPath)
+
+	rest := engineFull[nameEnd:]
+	if !strings.HasPrefix(rest, "(") {
+		return engineFull[:nameEnd] + "(" + quotedPath + ", '{replica}')" + rest, nil
+	}
+
+	args := strings.TrimLeft(rest[1:], " ")
+	if strings.HasPrefix(args, ")") {
+		return engineFull[:nameEnd] + "(" + quotedPath + ", '{replica}'" + args, nil
+	}
+
+	pathEnd := sqlUtils.StringLiteralEnd(args)
+	if pathEnd == -1 {
+		return "", fmt.Errorf("failed to parse replication path at engine '%s'", engineFull)
+	}
+
+	return engineFull[:nameEnd] + "(" + quotedPath + args[pathEnd:], nil
+}
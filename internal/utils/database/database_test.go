@@ -172,3 +172,275 @@ func TestDropTable(t *testing.T) {
 		})
 	}
 }
+
+func TestTruncateTable(t *testing.T) {
+	t.Parallel()
+
+	const (
+		testDatabaseName = "test_database"
+		testTableName    = "test_table"
+	)
+
+	type args struct {
+		database string
+		table    string
+	}
+	tests := []struct {
+		name             string
+		prepareShardMock func(mockShard *mockDatabase.MockShard)
+		args             args
+		wantErr          bool
+	}{
+		{
+			name: "Ok",
+			prepareShardMock: func(mockShard *mockDatabase.MockShard) {
+				mockShard.
+					EXPECT().
+					Exec(
+						gomock.Any(),
+						`TRUNCATE TABLE "test_database"."test_table"`,
+					).
+					Return(nil)
+			},
+			args: args{
+				database: testDatabaseName,
+				table:    testTableName,
+			},
+		},
+		{
+			name: "Error InvalidArguments",
+			args: args{
+				database: "$",
+				table:    "123",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Error at Exec",
+			prepareShardMock: func(mockShard *mockDatabase.MockShard) {
+				mockShard.
+					EXPECT().
+					Exec(
+						gomock.Any(),
+						`TRUNCATE TABLE "test_database"."test_table"`,
+					).
+					Return(errors.New("test error"))
+			},
+			args: args{
+				database: testDatabaseName,
+				table:    testTableName,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctrl := gomock.NewController(t)
+			shardMock := mockDatabase.NewMockShard(ctrl)
+
+			if tt.prepareShardMock != nil {
+				tt.prepareShardMock(shardMock)
+			}
+
+			err := TruncateTable(context.Background(), shardMock, tt.args.database, tt.args.table)
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
+
+func TestCreateReplicatedTableAs(t *testing.T) {
+	t.Parallel()
+
+	const (
+		testDatabaseName  = "test_database"
+		testSrcTableName  = "test_src_table"
+		testDstTableName  = "test_dst_table"
+		testZooKeeperPath = "/clickhouse/test/path"
+
+		engineQuery = "SELECT engine_full FROM system.tables WHERE database = ? AND name = ?"
+	)
+
+	type args struct {
+		database string
+		srcTable string
+		dstTable string
+	}
+	tests := []struct {
+		name             string
+		prepareShardMock func(ctrl *gomock.Controller, mockShard *mockDatabase.MockShard)
+		args             args
+		wantErr          bool
+	}{
+		{
+			name: "Ok",
+			prepareShardMock: func(ctrl *gomock.Controller, mockShard *mockDatabase.MockShard) {
+				rowMock := mockDatabase.NewMockRow(ctrl)
+				rowMock.EXPECT().Scan(gomock.Any()).SetArg(0, "ReplicatedMergeTree('/clickhouse/tables/{shard}/test_src_table', '{replica}') ORDER BY id")
+
+				mockShard.EXPECT().QueryRow(gomock.Any(), engineQuery, testDatabaseName, testSrcTableName).Return(rowMock)
+
+				mockShard.
+					EXPECT().
+					Exec(
+						gomock.Any(),
+						`CREATE TABLE "test_database"."test_dst_table" AS "test_database"."test_src_table" ENGINE = ReplicatedMergeTree('/clickhouse/test/path', '{replica}') ORDER BY id`,
+					).
+					Return(nil)
+			},
+			args: args{
+				database: testDatabaseName,
+				srcTable: testSrcTableName,
+				dstTable: testDstTableName,
+			},
+		},
+		{
+			name: "Error InvalidArguments",
+			args: args{
+				database: "$",
+				srcTable: "&",
+				dstTable: "123",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Error at QueryRow",
+			prepareShardMock: func(ctrl *gomock.Controller, mockShard *mockDatabase.MockShard) {
+				rowMock := mockDatabase.NewMockRow(ctrl)
+				rowMock.EXPECT().Scan(gomock.Any()).Return(errors.New("test error"))
+
+				mockShard.EXPECT().QueryRow(gomock.Any(), engineQuery, testDatabaseName, testSrcTableName).Return(rowMock)
+			},
+			args: args{
+				database: testDatabaseName,
+				srcTable: testSrcTableName,
+				dstTable: testDstTableName,
+			},
+			wantErr: true,
+		},
+		{
+			name: "Error not replicated",
+			prepareShardMock: func(ctrl *gomock.Controller, mockShard *mockDatabase.MockShard) {
+				rowMock := mockDatabase.NewMockRow(ctrl)
+				rowMock.EXPECT().Scan(gomock.Any()).SetArg(0, "MergeTree ORDER BY id")
+
+				mockShard.EXPECT().QueryRow(gomock.Any(), engineQuery, testDatabaseName, testSrcTableName).Return(rowMock)
+			},
+			args: args{
+				database: testDatabaseName,
+				srcTable: testSrcTableName,
+				dstTable: testDstTableName,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctrl := gomock.NewController(t)
+			shardMock := mockDatabase.NewMockShard(ctrl)
+
+			if tt.prepareShardMock != nil {
+				tt.prepareShardMock(ctrl, shardMock)
+			}
+
+			err := CreateReplicatedTableAs(context.Background(), shardMock, tt.args.database, tt.args.srcTable, tt.args.dstTable, testZooKeeperPath)
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
+
+func TestReplaceReplicationPath(t *testing.T) {
+	t.Parallel()
+
+	const testZooKeeperPath = "/clickhouse/test/path"
+
+	tests := []struct {
+		name       string
+		engineFull string
+		want       string
+		wantErr    bool
+	}{
+		{
+			name:       "With arguments",
+			engineFull: "ReplicatedAggregatingMergeTree('/clickhouse/tables/{shard}/t', '{replica}') PARTITION BY toYYYYMMDD(event_time) ORDER BY id",
+			want:       "ReplicatedAggregatingMergeTree('/clickhouse/test/path', '{replica}') PARTITION BY toYYYYMMDD(event_time) ORDER BY id",
+		},
+		{
+			name:       "With engine specific arguments",
+			engineFull: "ReplicatedReplacingMergeTree('/clickhouse/tables/{shard}/t', '{replica}', version) ORDER BY id",
+			want:       "ReplicatedReplacingMergeTree('/clickhouse/test/path', '{replica}', version) ORDER BY id",
+		},
+		{
+			name:       "With escaped quote at path",
+			engineFull: `ReplicatedMergeTree('/clickhouse/\'t\'', '{replica}') ORDER BY id`,
+			want:       "ReplicatedMergeTree('/clickhouse/test/path', '{replica}') ORDER BY id",
+		},
+		{
+			name:       "Without arguments",
+			engineFull: "ReplicatedMergeTree ORDER BY id",
+			want:       "ReplicatedMergeTree('/clickhouse/test/path', '{replica}') ORDER BY id",
+		},
+		{
+			name:       "With empty arguments",
+			engineFull: "ReplicatedMergeTree() ORDER BY id",
+			want:       "ReplicatedMergeTree('/clickhouse/test/path', '{replica}') ORDER BY id",
+		},
+		{
+			name:       "Not replicated",
+			engineFull: "MergeTree ORDER BY id",
+			wantErr:    true,
+		},
+		{
+			name:       "Bad path argument",
+			engineFull: "ReplicatedMergeTree(path, '{replica}') ORDER BY id",
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ReplaceReplicationPath(tt.engineFull, testZooKeeperPath)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
+
+func TestIsReplicatedEngine(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		engineFull string
+		want       bool
+	}{
+		{
+			name:       "Replicated",
+			engineFull: "ReplicatedAggregatingMergeTree('/clickhouse/tables/{shard}/t', '{replica}') ORDER BY id",
+			want:       true,
+		},
+		{
+			name:       "Replicated without arguments",
+			engineFull: "ReplicatedMergeTree ORDER BY id",
+			want:       true,
+		},
+		{
+			name:       "Not replicated",
+			engineFull: "MergeTree PARTITION BY toYYYYMMDD(event_time) ORDER BY id",
+		},
+		{
+			name:       "Replicated at settings",
+			engineFull: "MergeTree ORDER BY id SETTINGS storage_policy = 'Replicated'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, IsReplicatedEngine(tt.engineFull))
+		})
+	}
+}
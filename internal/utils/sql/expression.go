@@ -0,0 +1,408 @@
+// Copyright 2025 LLC "Ozon Technologies".
+// SPDX-License-Identifier: Apache-2.0
+
+package sql
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	errEmptyExpression     = errors.New("expression must not be empty")
+	errUnexpectedSymbol    = errors.New("unexpected symbol")
+	errUnterminated        = errors.New("unterminated literal or identifier")
+	errUnbalanced          = errors.New("unbalanced parentheses")
+	errManyExpressions     = errors.New("only one expression allowed")
+	errForbiddenKeyword    = errors.New("forbidden keyword")
+	errForbiddenFunction   = errors.New("forbidden function")
+	errNotAllowedFunction  = errors.New("function is not allowed")
+	errForbiddenQualifier  = errors.New("references to other tables and databases are not allowed")
+	errMisplacedKeyword    = errors.New("keyword is allowed only inside of function call")
+	errInTable             = errors.New("IN must be followed by list of values")
+	errCommentsNotAllowed  = errors.New("comments are not allowed")
+	errSeparatorNotAllowed = errors.New("statement separator is not allowed")
+	errUnknownPlaceholder  = errors.New("unknown placeholder")
+)
+
+// forbiddenKeywords start subqueries or other statements, or change the query around expression.
+var forbiddenKeywords = []string{
+	"SELECT", "WITH", "JOIN", "UNION", "EXCEPT", "INTERSECT", "GLOBAL",
+	"INTO", "FORMAT", "SETTINGS", "INSERT", "ALTER", "DROP", "CREATE", "TRUNCATE", "SYSTEM",
+	"WHERE", "PREWHERE", "HAVING", "GROUP", "ORDER", "LIMIT", "OFFSET",
+}
+
+// forbiddenFunctions read or write data outside of the table: table functions and functions that access files,
+// network or other tables.
+var forbiddenFunctions = []string{
+	"url", "urlCluster", "file", "fileCluster", "remote", "remoteSecure", "cluster", "clusterAllReplicas",
+	"s3", "s3Cluster", "gcs", "hdfs", "hdfsCluster", "azureBlobStorage", "azureBlobStorageCluster",
+	"mysql", "postgresql", "mongodb", "redis", "jdbc", "odbc", "sqlite", "executable", "input",
+	"merge", "view", "viewIfPermitted", "loop", "iceberg", "deltaLake", "hudi",
+	"hasColumnInTable",
+}
+
+// forbiddenFunctionPrefixes start families of functions that read dictionaries and Join tables, like dictGetOrDefault.
+var forbiddenFunctionPrefixes = []string{"dictGet", "dictHas", "dictIsIn", "joinGet"}
+
+// aggregateCombinators can be appended to allowed aggregate function, like countMergeState.
+var aggregateCombinators = []string{
+	"SimpleState", "MergeState", "State", "Merge", "If", "Array", "Distinct", "ForEach", "Map",
+	"OrNull", "OrDefault", "Resample", "ArgMin", "ArgMax",
+}
+
+// ExpressionOptions restricts ValidateExpression.
+type ExpressionOptions struct {
+	// AllowedFunctions are functions that can be called, aggregate functions can be called with combinators.
+	// Default: any function except functions that access data outside of the table.
+	AllowedFunctions []string
+	// AllowedQualifiers are tables that can qualify column names, like "table"."column". Default: none.
+	AllowedQualifiers []string
+	// Placeholders are allowed placeholders with braces, like "{column}". They must be expanded by ExpandPlaceholders
+	// before expression is inserted into the query. Default: none.
+	Placeholders []string
+}
+
+type tokenKind int
+
+const (
+	tokenIdentifier tokenKind = iota
+	tokenQuotedIdentifier
+	tokenNumber
+	tokenString
+	tokenSymbol
+	tokenPlaceholder
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+}
+
+// ValidateExpression checks that s is a single scalar or aggregate expression over columns of the table,
+// so it can be safely inserted into select list or where clause of the query.
+func ValidateExpression(s string, opts ExpressionOptions) error {
+	tokens, err := tokenize(s, opts.Placeholders)
+	if err != nil {
+		return err
+	}
+
+	if len(tokens) == 0 {
+		return errEmptyExpression
+	}
+
+	depth := 0
+
+	for i := 0; i < len(tokens); i++ {
+		current := tokens[i]
+
+		switch current.kind {
+		case tokenSymbol:
+			switch current.value {
+			case "(", "[":
+				depth++
+			case ")", "]":
+				depth--
+				if depth < 0 {
+					return errUnbalanced
+				}
+			case ",":
+				if depth == 0 {
+					return errManyExpressions
+				}
+			case ":":
+				// Type of x::Type is not a function.
+				if i+1 < len(tokens) && tokens[i+1].value == ":" {
+					i = skipType(tokens, i+2) - 1
+				}
+			}
+		case tokenIdentifier, tokenQuotedIdentifier:
+			if err = validateName(tokens, i, opts); err != nil {
+				return err
+			}
+
+			if current.kind != tokenIdentifier {
+				continue
+			}
+
+			switch strings.ToUpper(current.value) {
+			case "AS":
+				if depth == 0 {
+					return fmt.Errorf("%w: '%s'", errMisplacedKeyword, current.value)
+				}
+
+				// Type of CAST(x AS Type) is not a function.
+				i = skipType(tokens, i+1) - 1
+			case "FROM":
+				// Like extract(HOUR FROM time), at top level it would add FROM clause to the query.
+				if depth == 0 {
+					return fmt.Errorf("%w: '%s'", errMisplacedKeyword, current.value)
+				}
+			case "IN":
+				// x IN table reads other table.
+				if i+1 < len(tokens) && (tokens[i+1].kind == tokenIdentifier || tokens[i+1].kind == tokenQuotedIdentifier) {
+					return errInTable
+				}
+			}
+		}
+	}
+
+	if depth != 0 {
+		return errUnbalanced
+	}
+
+	return nil
+}
+
+// validateName checks identifier at tokens[i]: keywords, called functions and qualifiers.
+func validateName(tokens []token, i int, opts ExpressionOptions) error {
+	current := tokens[i]
+
+	if current.kind == tokenIdentifier && slices.Contains(forbiddenKeywords, strings.ToUpper(current.value)) {
+		return fmt.Errorf("%w: '%s'", errForbiddenKeyword, current.value)
+	}
+
+	if i+1 >= len(tokens) || tokens[i+1].kind != tokenSymbol {
+		return nil
+	}
+
+	switch tokens[i+1].value {
+	case ".":
+		if i > 0 && tokens[i-1].value == "." || !slices.Contains(opts.AllowedQualifiers, current.value) {
+			return fmt.Errorf("%w: '%s'", errForbiddenQualifier, current.value)
+		}
+	case "(":
+		// Quoted name is a function name as well, like "dictGet"(...).
+		if current.kind == tokenQuotedIdentifier || !isOperatorKeyword(current.value) {
+			return validateFunction(current.value, opts.AllowedFunctions)
+		}
+	}
+
+	return nil
+}
+
+// isOperatorKeyword reports whether keyword can be followed by parentheses, but it's not a function.
+func isOperatorKeyword(value string) bool {
+	switch strings.ToUpper(value) {
+	case "IN", "NOT", "AND", "OR", "IS", "LIKE", "ILIKE", "BETWEEN", "CASE", "WHEN", "THEN", "ELSE", "INTERVAL":
+		return true
+	default:
+		return false
+	}
+}
+
+func validateFunction(name string, allowedFunctions []string) error {
+	if slices.ContainsFunc(forbiddenFunctions, func(function string) bool { return strings.EqualFold(function, name) }) {
+		return fmt.Errorf("%w: '%s'", errForbiddenFunction, name)
+	}
+
+	lowerName := strings.ToLower(name)
+	if slices.ContainsFunc(forbiddenFunctionPrefixes, func(prefix string) bool { return strings.HasPrefix(lowerName, strings.ToLower(prefix)) }) {
+		return fmt.Errorf("%w: '%s'", errForbiddenFunction, name)
+	}
+
+	if len(allowedFunctions) == 0 {
+		return nil
+	}
+
+	for base := name; base != ""; {
+		if slices.ContainsFunc(allowedFunctions, func(function string) bool { return strings.EqualFold(function, base) }) {
+			return nil
+		}
+
+		index := slices.IndexFunc(aggregateCombinators, func(combinator string) bool { return strings.HasSuffix(base, combinator) })
+		if index < 0 {
+			break
+		}
+
+		base = strings.TrimSuffix(base, aggregateCombinators[index])
+	}
+
+	return fmt.Errorf("%w: '%s'", errNotAllowedFunction, name)
+}
+
+// skipType returns index right after type name and its parameters starting at tokens[i].
+func skipType(tokens []token, i int) int {
+	if i >= len(tokens) || tokens[i].kind != tokenIdentifier && tokens[i].kind != tokenQuotedIdentifier {
+		return i
+	}
+
+	i++
+
+	if i >= len(tokens) || tokens[i] != (token{kind: tokenSymbol, value: "("}) {
+		return i
+	}
+
+	for depth := 0; i < len(tokens); i++ {
+		if tokens[i].kind != tokenSymbol {
+			continue
+		}
+
+		switch tokens[i].value {
+		case "(":
+			depth++
+		case ")":
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+
+	return i
+}
+
+// tokenize splits expression into tokens. Comments, statement separators, query parameters
+// and placeholders other than allowed ones are rejected.
+func tokenize(s string, placeholders []string) ([]token, error) {
+	var result []token
+
+	for i := 0; i < len(s); {
+		c := s[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case isIdentifierStart(c):
+			end := i + 1
+			for end < len(s) && isIdentifierPart(s[end]) {
+				end++
+			}
+
+			result = append(result, token{kind: tokenIdentifier, value: s[i:end]})
+			i = end
+		case isDigit(c) || c == '.' && i+1 < len(s) && isDigit(s[i+1]):
+			end := i + 1
+			for end < len(s) && (isIdentifierPart(s[end]) || s[end] == '.' ||
+				(s[end] == '+' || s[end] == '-') && (s[end-1] == 'e' || s[end-1] == 'E')) {
+				end++
+			}
+
+			result = append(result, token{kind: tokenNumber, value: s[i:end]})
+			i = end
+		case c == '\'':
+			end := StringLiteralEnd(s[i:])
+			if end < 0 {
+				return nil, errUnterminated
+			}
+
+			result = append(result, token{kind: tokenString, value: s[i : i+end]})
+			i += end
+		case c == '"' || c == '`':
+			// Quoted identifiers have the same escapes as string literals.
+			end := QuotedEnd(s[i:], c)
+			if end < 0 {
+				return nil, errUnterminated
+			}
+
+			result = append(result, token{kind: tokenQuotedIdentifier, value: unquote(s[i+1:i+end-1], c)})
+			i += end
+		case c == '-' && strings.HasPrefix(s[i:], "--"), c == '/' && strings.HasPrefix(s[i:], "/*"), c == '#':
+			return nil, errCommentsNotAllowed
+		case c == ';':
+			return nil, errSeparatorNotAllowed
+		case c == '{' && len(placeholders) > 0:
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return nil, errUnterminated
+			}
+
+			placeholder := s[i : i+end+1]
+			if !slices.Contains(placeholders, placeholder) {
+				return nil, fmt.Errorf("%w: '%s'", errUnknownPlaceholder, placeholder)
+			}
+
+			result = append(result, token{kind: tokenPlaceholder, value: placeholder})
+			i += end + 1
+		case strings.IndexByte("()[],.+-*/%=<>!|&:", c) >= 0:
+			result = append(result, token{kind: tokenSymbol, value: s[i : i+1]})
+			i++
+		default:
+			return nil, fmt.Errorf("%w: '%c'", errUnexpectedSymbol, c)
+		}
+	}
+
+	return result, nil
+}
+
+// unquote returns name of quoted identifier without escapes, s is the identifier between quotes.
+func unquote(s string, quote byte) string {
+	var result strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == quote && i+1 < len(s) && s[i+1] == quote:
+			i++
+		case s[i] == '\\' && i+1 < len(s):
+			i++
+
+			if s[i] == 'x' && i+2 < len(s) {
+				if value, err := strconv.ParseUint(s[i+1:i+3], 16, 8); err == nil {
+					result.WriteByte(byte(value))
+					i += 2
+
+					continue
+				}
+			}
+
+			if index := strings.IndexByte("abfnrtv0", s[i]); index >= 0 {
+				result.WriteByte("\a\b\f\n\r\t\v\x00"[index])
+				continue
+			}
+		}
+
+		result.WriteByte(s[i])
+	}
+
+	return result.String()
+}
+
+func isIdentifierStart(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
+
+func isIdentifierPart(c byte) bool {
+	return isIdentifierStart(c) || isDigit(c)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// ExpandPlaceholders replaces placeholders with braces, like "{column}", by their values.
+// Placeholders inside of string literals and quoted identifiers are kept as is. Values must be sanitized.
+func ExpandPlaceholders(s string, values map[string]string) string {
+	var result strings.Builder
+
+	for i := 0; i < len(s); {
+		end := i + 1
+
+		switch s[i] {
+		case '\'':
+			if literalEnd := StringLiteralEnd(s[i:]); literalEnd > 0 {
+				end = i + literalEnd
+			}
+		case '"', '`':
+			if identifierEnd := QuotedEnd(s[i:], s[i]); identifierEnd > 0 {
+				end = i + identifierEnd
+			}
+		case '{':
+			if placeholderEnd := strings.IndexByte(s[i:], '}'); placeholderEnd >= 0 {
+				if value, ok := values[s[i:i+placeholderEnd+1]]; ok {
+					result.WriteString(value)
+					i += placeholderEnd + 1
+
+					continue
+				}
+			}
+		}
+
+		result.WriteString(s[i:end])
+		i = end
+	}
+
+	return result.String()
+}
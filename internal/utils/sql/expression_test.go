@@ -0,0 +1,266 @@
+// Copyright 2025 LLC "Ozon Technologies".
+// SPDX-License-Identifier: Apache-2.0
+
+package sql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateExpression(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		s       string
+		opts    ExpressionOptions
+		wantErr error
+	}{
+		{
+			name: "Ok aggregate",
+			s:    "countMergeState(counter)",
+		},
+		{
+			name: "Ok parametric aggregate",
+			s:    "quantilesMergeState(0.5, 0.9)(latency)",
+		},
+		{
+			name: "Ok predicate",
+			s:    "service_tier = 'low' AND hits > 1e-5 OR service IN ('a', 'b')",
+		},
+		{
+			name: "Ok cast and extract",
+			s:    "sum(CAST(value AS Decimal(18, 2))) + extract(HOUR FROM event_time)::UInt64",
+		},
+		{
+			name: "Ok string with keywords",
+			s:    "if(service = 'SELECT 1; DROP TABLE t', 1, 0)",
+		},
+		{
+			name: "Ok allowed function with combinator",
+			s:    "sumIfMergeState(hits, hits > 0)",
+			opts: ExpressionOptions{AllowedFunctions: []string{"sum"}},
+		},
+		{
+			name: "Ok allowed qualifier",
+			s:    `"test_table"."event_time" < now()`,
+			opts: ExpressionOptions{AllowedFunctions: []string{"NOW"}, AllowedQualifiers: []string{"test_table"}},
+		},
+		{
+			name: "Ok placeholders",
+			s:    "countMergeState({column}) + {interval_sec}",
+			opts: ExpressionOptions{Placeholders: []string{"{column}", "{interval_sec}"}},
+		},
+		{
+			name:    "Unknown placeholder",
+			s:       "countMergeState({table})",
+			opts:    ExpressionOptions{Placeholders: []string{"{column}"}},
+			wantErr: errUnknownPlaceholder,
+		},
+		{
+			name:    "Empty",
+			s:       " ",
+			wantErr: errEmptyExpression,
+		},
+		{
+			name:    "Statement separator",
+			s:       "count(); DROP TABLE test_table",
+			wantErr: errSeparatorNotAllowed,
+		},
+		{
+			name:    "Comment",
+			s:       "count() -- comment",
+			wantErr: errCommentsNotAllowed,
+		},
+		{
+			name:    "Subquery",
+			s:       "hits IN (SELECT hits FROM other_table)",
+			wantErr: errForbiddenKeyword,
+		},
+		{
+			name:    "In table",
+			s:       "service IN other_table",
+			wantErr: errInTable,
+		},
+		{
+			name:    "Many expressions",
+			s:       "count(), sum(hits)",
+			wantErr: errManyExpressions,
+		},
+		{
+			name:    "Top level from",
+			s:       "hits FROM other_table",
+			wantErr: errMisplacedKeyword,
+		},
+		{
+			name:    "Top level alias",
+			s:       "count() AS hits",
+			wantErr: errMisplacedKeyword,
+		},
+		{
+			name:    "Table function",
+			s:       "sum(hits) + (count() FROM url('http://example.com', CSV))",
+			wantErr: errForbiddenFunction,
+		},
+		{
+			name:    "Other database",
+			s:       "other_database.other_table.hits",
+			wantErr: errForbiddenQualifier,
+		},
+		{
+			name:    "Quoted other table",
+			s:       `"other_table"."hits" > 0`,
+			opts:    ExpressionOptions{AllowedQualifiers: []string{"test_table"}},
+			wantErr: errForbiddenQualifier,
+		},
+		{
+			name:    "Not allowed function",
+			s:       "sleepEachRow(3)",
+			opts:    ExpressionOptions{AllowedFunctions: []string{"count", "sum"}},
+			wantErr: errNotAllowedFunction,
+		},
+		{
+			name:    "Unbalanced parentheses",
+			s:       "count())",
+			wantErr: errUnbalanced,
+		},
+		{
+			name:    "Unterminated string",
+			s:       "service = 'low",
+			wantErr: errUnterminated,
+		},
+		{
+			name:    "Escaped quote at identifier",
+			s:       `tuple(1 AS "\"'", (SELECT name FROM system.users) /* '*/)`,
+			opts:    ExpressionOptions{AllowedFunctions: []string{"tuple"}},
+			wantErr: errCommentsNotAllowed,
+		},
+		{
+			name:    "Subquery after escaped identifier",
+			s:       "`a\\`b` + (SELECT 1)",
+			wantErr: errForbiddenKeyword,
+		},
+		{
+			name:    "Unterminated identifier",
+			s:       `"hits\" > 0`,
+			wantErr: errUnterminated,
+		},
+		{
+			name:    "Dictionary",
+			s:       "dictGetOrDefault('users', 'name', id, '')",
+			wantErr: errForbiddenFunction,
+		},
+		{
+			name:    "Quoted table function",
+			s:       "count() + `file`('/etc/passwd', 'CSV', 'x String')",
+			wantErr: errForbiddenFunction,
+		},
+		{
+			name:    "Quoted dictionary",
+			s:       `"dictGet"('users', 'name', id)`,
+			opts:    ExpressionOptions{AllowedFunctions: []string{"count"}},
+			wantErr: errForbiddenFunction,
+		},
+		{
+			name:    "Escaped quoted dictionary",
+			s:       `"dict\x47et"('users', 'name', id)`,
+			wantErr: errForbiddenFunction,
+		},
+		{
+			name:    "Quoted function not allowed",
+			s:       `"sum"(hits)`,
+			opts:    ExpressionOptions{AllowedFunctions: []string{"count"}},
+			wantErr: errNotAllowedFunction,
+		},
+		{
+			name: "Ok quoted allowed function",
+			s:    `"count"()`,
+			opts: ExpressionOptions{AllowedFunctions: []string{"count"}},
+		},
+		{
+			name:    "Order by clause",
+			s:       "count() ORDER BY 1",
+			wantErr: errForbiddenKeyword,
+		},
+		{
+			name:    "Where clause",
+			s:       "hits WHERE 1",
+			wantErr: errForbiddenKeyword,
+		},
+		{
+			name:    "Prewhere clause",
+			s:       "hits PREWHERE 1",
+			wantErr: errForbiddenKeyword,
+		},
+		{
+			name:    "Group by clause",
+			s:       "count() GROUP BY hits HAVING count() > 1",
+			wantErr: errForbiddenKeyword,
+		},
+		{
+			name:    "Limit clause",
+			s:       "hits LIMIT 1 OFFSET 1",
+			wantErr: errForbiddenKeyword,
+		},
+		{
+			name:    "Join table",
+			s:       "joinGetOrNull('users', 'name', id)",
+			wantErr: errForbiddenFunction,
+		},
+		{
+			name:    "Query parameter",
+			s:       "service = {service:String}",
+			wantErr: errUnexpectedSymbol,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assert.ErrorIs(t, ValidateExpression(tt.s, tt.opts), tt.wantErr)
+		})
+	}
+}
+
+func TestExpandPlaceholders(t *testing.T) {
+	t.Parallel()
+
+	values := map[string]string{
+		"{column}":       `"hits"`,
+		"{interval_sec}": "3600",
+	}
+
+	tests := []struct {
+		name string
+		s    string
+		want string
+	}{
+		{
+			name: "Ok",
+			s:    "countMergeState({column}) * {interval_sec}",
+			want: `countMergeState("hits") * 3600`,
+		},
+		{
+			name: "Literals",
+			s:    "concat('{column}', \"{column}\")",
+			want: "concat('{column}', \"{column}\")",
+		},
+		{
+			name: "Escaped quote at identifier",
+			s:    `"a\"{column}" + {column}`,
+			want: `"a\"{column}" + "hits"`,
+		},
+		{
+			name: "Unknown placeholder",
+			s:    "{table}",
+			want: "{table}",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, ExpandPlaceholders(tt.s, values))
+		})
+	}
+}
@@ -7,6 +7,7 @@ package sql
 import (
 	"errors"
 	"regexp"
+	"strings"
 )
 
 var (
@@ -34,3 +35,38 @@ func QuotedDatabaseEntity(database, entity string) string {
 func QuotedEntity(entity string) string {
 	return `"` + entity + `"`
 }
+
+// QuotedString returns s as ClickHouse string literal.
+func QuotedString(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// StringLiteralEnd returns index right after string literal at the beginning of s.
+// Returns -1 if s doesn't start with complete string literal.
+func StringLiteralEnd(s string) int {
+	return QuotedEnd(s, '\'')
+}
+
+// QuotedEnd returns index right after string literal or identifier quoted by the quote at the beginning of s.
+// Quote is escaped by backslash or doubled, like ClickHouse does. It returns -1 if s doesn't start with quote or it's unterminated.
+func QuotedEnd(s string, quote byte) int {
+	if len(s) == 0 || s[0] != quote {
+		return -1
+	}
+
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case quote:
+			if i+1 < len(s) && s[i+1] == quote {
+				i++
+				continue
+			}
+
+			return i + 1
+		}
+	}
+
+	return -1
+}
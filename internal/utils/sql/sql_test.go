@@ -56,3 +56,52 @@ func TestQuotedEntity(t *testing.T) {
 
 	assert.Equal(t, `"test-entity"`, QuotedEntity("test-entity"))
 }
+
+func TestQuotedString(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, `'it\'s \\ test'`, QuotedString(`it's \ test`))
+}
+
+func TestStringLiteralEnd(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		s    string
+		want int
+	}{
+		{
+			name: "Ok",
+			s:    "'test', next",
+			want: 6,
+		},
+		{
+			name: "With backslash escape",
+			s:    `'te\'st', next`,
+			want: 8,
+		},
+		{
+			name: "With quote escape",
+			s:    "'te''st', next",
+			want: 8,
+		},
+		{
+			name: "Not a literal",
+			s:    "test",
+			want: -1,
+		},
+		{
+			name: "Not terminated",
+			s:    "'test",
+			want: -1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tt.want, StringLiteralEnd(tt.s))
+		})
+	}
+}
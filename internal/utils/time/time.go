@@ -58,3 +58,77 @@ func SplitTimeRangeByInterval(timeRange Range, interval time.Duration) []Range {
 
 	return result
 }
+
+const (
+	day  = 24 * time.Hour
+	week = 7 * day
+
+	// firstMondayAfterEpoch is a number of days from Unix epoch to the first Monday.
+	firstMondayAfterEpoch = 4
+)
+
+// TruncateIn returns the result of rounding t down to a multiple of d in loc.
+// Multiples of day are aligned to midnights in loc, so days with DST transitions are handled correctly,
+// and multiples of week are aligned to Mondays.
+// If loc is nil, it returns t.Truncate(d).
+func TruncateIn(t time.Time, d time.Duration, loc *time.Location) time.Time {
+	if loc == nil || d <= 0 {
+		return t.Truncate(d)
+	}
+
+	t = t.In(loc)
+
+	if d%day != 0 {
+		_, offset := t.Zone()
+		shift := time.Duration(offset) * time.Second
+
+		return t.Add(shift).Truncate(d).Add(-shift)
+	}
+
+	days := int64(d / day)
+
+	year, month, dayOfMonth := t.Date()
+	dayNumber := time.Date(year, month, dayOfMonth, 0, 0, 0, 0, time.UTC).Unix() / int64(day/time.Second)
+	// Days are counted from Unix epoch and weeks start on Monday like in ClickHouse.
+	var shift int64
+	if d%week == 0 {
+		shift = firstMondayAfterEpoch
+	}
+
+	dayNumber -= ((dayNumber-shift)%days + days) % days
+
+	year, month, dayOfMonth = time.Unix(dayNumber*int64(day/time.Second), 0).UTC().Date()
+
+	return time.Date(year, month, dayOfMonth, 0, 0, 0, 0, loc)
+}
+
+// NextIn returns start of the d interval that follows the interval of t in loc. See TruncateIn.
+func NextIn(t time.Time, d time.Duration, loc *time.Location) time.Time {
+	start := TruncateIn(t, d, loc)
+
+	if loc == nil || d%day != 0 {
+		return start.Add(d)
+	}
+
+	return start.AddDate(0, 0, int(d/day))
+}
+
+// TruncateMonthsIn returns start of the months interval of t in loc.
+// Months are counted from Unix epoch like in ClickHouse. If loc is nil, UTC is used.
+func TruncateMonthsIn(t time.Time, months int, loc *time.Location) time.Time {
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	year, month, _ := t.In(loc).Date()
+
+	monthNumber := (year-1970)*12 + int(month-time.January)
+	monthNumber -= (monthNumber%months + months) % months
+
+	return time.Date(1970, time.January+time.Month(monthNumber), 1, 0, 0, 0, 0, loc)
+}
+
+// NextMonthsIn returns start of the months interval that follows the interval of t in loc. See TruncateMonthsIn.
+func NextMonthsIn(t time.Time, months int, loc *time.Location) time.Time {
+	return TruncateMonthsIn(t, months, loc).AddDate(0, months, 0)
+}
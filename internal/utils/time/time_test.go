@@ -151,3 +151,161 @@ func TestSplitTimeRangeByInterval(t *testing.T) {
 		})
 	}
 }
+
+func TestTruncateIn(t *testing.T) {
+	t.Parallel()
+
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	assert.NoError(t, err)
+
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	assert.NoError(t, err)
+
+	newYork, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+
+	type args struct {
+		t   time.Time
+		d   time.Duration
+		loc *time.Location
+	}
+	tests := []struct {
+		name     string
+		args     args
+		want     time.Time
+		wantNext time.Time
+	}{
+		{
+			name: "Without location",
+			args: args{
+				t: time.Date(2024, time.June, 23, 22, 30, 0, 0, time.UTC),
+				d: time.Hour * 24,
+			},
+			want:     time.Date(2024, time.June, 23, 0, 0, 0, 0, time.UTC),
+			wantNext: time.Date(2024, time.June, 24, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "Day",
+			args: args{
+				t:   time.Date(2024, time.June, 23, 22, 30, 0, 0, time.UTC),
+				d:   time.Hour * 24,
+				loc: moscow,
+			},
+			want:     time.Date(2024, time.June, 23, 21, 0, 0, 0, time.UTC),
+			wantNext: time.Date(2024, time.June, 24, 21, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "Days from epoch",
+			args: args{
+				t:   time.Date(2024, time.June, 23, 10, 0, 0, 0, time.UTC),
+				d:   time.Hour * 24 * 3,
+				loc: time.UTC,
+			},
+			want:     time.Date(2024, time.June, 22, 0, 0, 0, 0, time.UTC),
+			wantNext: time.Date(2024, time.June, 25, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "Week from Monday",
+			args: args{
+				t:   time.Date(2024, time.June, 23, 10, 0, 0, 0, time.UTC),
+				d:   time.Hour * 24 * 7,
+				loc: time.UTC,
+			},
+			want:     time.Date(2024, time.June, 17, 0, 0, 0, 0, time.UTC),
+			wantNext: time.Date(2024, time.June, 24, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "Hour with half hour offset",
+			args: args{
+				t:   time.Date(2024, time.June, 23, 10, 10, 0, 0, time.UTC),
+				d:   time.Hour,
+				loc: kolkata,
+			},
+			want:     time.Date(2024, time.June, 23, 9, 30, 0, 0, time.UTC),
+			wantNext: time.Date(2024, time.June, 23, 10, 30, 0, 0, time.UTC),
+		},
+		{
+			name: "Day with DST transition",
+			args: args{
+				t:   time.Date(2024, time.March, 10, 12, 0, 0, 0, time.UTC),
+				d:   time.Hour * 24,
+				loc: newYork,
+			},
+			want:     time.Date(2024, time.March, 10, 5, 0, 0, 0, time.UTC),
+			wantNext: time.Date(2024, time.March, 11, 4, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.True(t, tt.want.Equal(TruncateIn(tt.args.t, tt.args.d, tt.args.loc)))
+			assert.True(t, tt.wantNext.Equal(NextIn(tt.args.t, tt.args.d, tt.args.loc)))
+		})
+	}
+}
+
+func TestTruncateMonthsIn(t *testing.T) {
+	t.Parallel()
+
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	assert.NoError(t, err)
+
+	type args struct {
+		t      time.Time
+		months int
+		loc    *time.Location
+	}
+	tests := []struct {
+		name     string
+		args     args
+		want     time.Time
+		wantNext time.Time
+	}{
+		{
+			name: "Month",
+			args: args{
+				t:      time.Date(2024, time.February, 29, 10, 0, 0, 0, time.UTC),
+				months: 1,
+			},
+			want:     time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC),
+			wantNext: time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "Month in location",
+			args: args{
+				t:      time.Date(2024, time.January, 31, 22, 0, 0, 0, time.UTC),
+				months: 1,
+				loc:    moscow,
+			},
+			want:     time.Date(2024, time.January, 31, 21, 0, 0, 0, time.UTC),
+			wantNext: time.Date(2024, time.February, 29, 21, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "Quarter",
+			args: args{
+				t:      time.Date(2024, time.May, 15, 0, 0, 0, 0, time.UTC),
+				months: 3,
+			},
+			want:     time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC),
+			wantNext: time.Date(2024, time.July, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "Year",
+			args: args{
+				t:      time.Date(2024, time.May, 15, 0, 0, 0, 0, time.UTC),
+				months: 12,
+			},
+			want:     time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+			wantNext: time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.True(t, tt.want.Equal(TruncateMonthsIn(tt.args.t, tt.args.months, tt.args.loc)))
+			assert.True(t, tt.wantNext.Equal(NextMonthsIn(tt.args.t, tt.args.months, tt.args.loc)))
+		})
+	}
+}
@@ -5,6 +5,7 @@ package static
 
 import (
 	"context"
+	"fmt"
 	"strconv"
 
 	"github.com/ClickHouse/clickhouse-go/v2"
@@ -23,44 +24,61 @@ func connect(ctx context.Context, address, userName, password string) (clickhous
 		return nil, err
 	}
 
-	return conn, conn.Ping(ctx)
-}
-
-func openClusterShards(ctx context.Context, conn clickhouse.Conn, userName, password, clusterName string) ([]shard, error) {
-	shardsAddresses, err := getShardsAddresses(ctx, conn, clusterName)
-	if err != nil {
+	if err = conn.Ping(ctx); err != nil {
+		_ = conn.Close()
 		return nil, err
 	}
 
-	shards := make([]shard, 0, len(shardsAddresses))
+	return conn, nil
+}
 
-	for _, shardAddress := range shardsAddresses {
-		conn, err = connect(ctx, shardAddress, userName, password)
+func openClusterShards(ctx context.Context, shardsReplicas [][]string, userName, password string) ([]shard, error) {
+	shards := make([]shard, 0, len(shardsReplicas))
+
+	for _, replicas := range shardsReplicas {
+		elected, err := electReplica(ctx, replicas, userName, password)
 		if err != nil {
-			return nil, err
+			return nil, multierr.Append(err, closeShards(shards))
 		}
 
-		shards = append(
-			shards,
-			shard{
-				name: shardAddress,
-				conn: conn,
-			},
-		)
+		shards = append(shards, elected)
 	}
 
 	return shards, nil
 }
 
-func getShardsAddresses(ctx context.Context, conn clickhouse.Conn, clusterName string) ([]string, error) {
-	// TODO: handle replicas
+// electReplica returns connection to the first available replica of shard.
+// Replicas are ordered by replica_num, so the same replica is elected while it's available.
+func electReplica(ctx context.Context, replicas []string, userName, password string) (shard, error) {
+	var errs error
+
+	for _, replicaAddress := range replicas {
+		conn, err := connect(ctx, replicaAddress, userName, password)
+		if err != nil {
+			errs = multierr.Append(errs, fmt.Errorf("failed to connect to %s: %w", replicaAddress, err))
+			continue
+		}
+
+		return shard{
+			name: replicaAddress,
+			conn: conn,
+		}, nil
+	}
+
+	return shard{}, fmt.Errorf("no available replicas: %w", errs)
+}
+
+// getShardsReplicas returns addresses of replicas grouped by shard.
+func getShardsReplicas(ctx context.Context, conn clickhouse.Conn, clusterName string) (result [][]string, err error) {
 	rows, err := conn.Query(ctx, `
 		SELECT 
-			host_address, port
+			shard_num, host_address, port
 		FROM 
 		    system.clusters
 		WHERE 
 		    cluster = $1
+		ORDER BY
+		    shard_num, replica_num
 	`, clusterName)
 	if err != nil {
 		return nil, err
@@ -72,14 +90,38 @@ func getShardsAddresses(ctx context.Context, conn clickhouse.Conn, clusterName s
 		}
 	}()
 
-	var result []string
+	var lastShardNum uint32
 
 	for rows.Next() {
-		var host string
-		var port int
+		var (
+			shardNum uint32
+			host     string
+			port     uint16
+		)
+
+		if err = rows.Scan(&shardNum, &host, &port); err != nil {
+			return nil, err
+		}
+
+		if len(result) == 0 || shardNum != lastShardNum {
+			result = append(result, nil)
+			lastShardNum = shardNum
+		}
 
-		result = append(result, host+":"+strconv.Itoa(port))
+		result[len(result)-1] = append(result[len(result)-1], host+":"+strconv.Itoa(int(port)))
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
 	}
 
 	return result, nil
 }
+
+func closeShards(shards []shard) (err error) {
+	for _, shard := range shards {
+		err = multierr.Append(err, shard.Close())
+	}
+
+	return err
+}
@@ -7,8 +7,8 @@ package static
 import (
 	"context"
 	"errors"
-
-	"go.uber.org/multierr"
+	"fmt"
+	"sync"
 
 	"github.com/ozontech/ch-rollup/pkg/database"
 	clickhouseGoWrap "github.com/ozontech/ch-rollup/pkg/database/error_wrappers/clickhouse_go"
@@ -16,7 +16,12 @@ import (
 
 // Cluster ...
 type Cluster struct {
+	mu     sync.Mutex
 	shards []shard
+	// replicas are addresses of replicas of each shard, they are set only with ClusterName.
+	replicas [][]string
+	userName string
+	password string
 }
 
 // NewOptions ...
@@ -40,6 +45,9 @@ func (opts NewOptions) validate() error {
 }
 
 // New returns new static Cluster.
+// If ClusterName is set, one replica is elected for each shard of the cluster:
+// the first available one in order of system.clusters.replica_num. Replica is elected again by Shards,
+// if elected one is unavailable.
 func New(ctx context.Context, opts NewOptions) (*Cluster, error) {
 	if err := opts.validate(); err != nil {
 		return nil, err
@@ -61,18 +69,35 @@ func New(ctx context.Context, opts NewOptions) (*Cluster, error) {
 		}, nil
 	}
 
-	shards, err := openClusterShards(ctx, conn, opts.Username, opts.Password, opts.ClusterName)
+	shardsReplicas, err := getShardsReplicas(ctx, conn, opts.ClusterName)
+	_ = conn.Close()
+
+	if err != nil {
+		return nil, err
+	}
+
+	shards, err := openClusterShards(ctx, shardsReplicas, opts.Username, opts.Password)
 	if err != nil {
 		return nil, err
 	}
 
 	return &Cluster{
-		shards: shards,
+		shards:   shards,
+		replicas: shardsReplicas,
+		userName: opts.Username,
+		password: opts.Password,
 	}, nil
 }
 
-// Shards returns slice of Shards.
-func (c *Cluster) Shards(_ context.Context) ([]database.Shard, error) {
+// Shards returns slice of Shards. Unavailable replicas are replaced by elected ones.
+func (c *Cluster) Shards(ctx context.Context) ([]database.Shard, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.reelectReplicas(ctx); err != nil {
+		return nil, err
+	}
+
 	result := make([]database.Shard, 0, len(c.shards))
 
 	for _, shard := range c.shards {
@@ -82,11 +107,29 @@ func (c *Cluster) Shards(_ context.Context) ([]database.Shard, error) {
 	return result, nil
 }
 
-// Close Cluster.
-func (c *Cluster) Close() (err error) {
-	for _, shard := range c.shards {
-		err = multierr.Append(err, shard.Close())
+// reelectReplicas elects replica again for each shard which elected replica doesn't respond.
+func (c *Cluster) reelectReplicas(ctx context.Context) error {
+	for i, replicas := range c.replicas {
+		if c.shards[i].conn.Ping(ctx) == nil {
+			continue
+		}
+
+		elected, err := electReplica(ctx, replicas, c.userName, c.password)
+		if err != nil {
+			return fmt.Errorf("failed to elect replica instead of %s: %w", c.shards[i].name, err)
+		}
+
+		_ = c.shards[i].Close()
+		c.shards[i] = elected
 	}
 
-	return err
+	return nil
+}
+
+// Close Cluster.
+func (c *Cluster) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return closeShards(c.shards)
 }
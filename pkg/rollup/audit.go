@@ -0,0 +1,107 @@
+// Copyright 2025 LLC "Ozon Technologies".
+// SPDX-License-Identifier: Apache-2.0
+
+package rollup
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/huandu/go-sqlbuilder"
+
+	timeUtils "github.com/ozontech/ch-rollup/internal/utils/time"
+	"github.com/ozontech/ch-rollup/pkg/database"
+)
+
+const (
+	rollUpAuditLogTableDefinition = `
+			CREATE TABLE IF NOT EXISTS rollup_audit_log(
+				database String,
+				table String,
+				after_sec UInt64,
+				interval_sec UInt64,
+				interval_calendar String,
+				window_from DateTime,
+				window_to DateTime,
+				partitions Array(String),
+				run_id String,
+				created_at DateTime
+			) ENGINE = %s ORDER BY (database, table, created_at);
+	`
+)
+
+// auditLog is a record of window reprocessed by RunRange.
+type auditLog struct {
+	metaInfoKey
+	Window     timeUtils.Range
+	Partitions []string
+	RunID      string
+	CreatedAt  time.Time
+}
+
+// RunRange rolls up the window [from, to) with RunOptions on current database.Cluster, whatever meta info says,
+// like Run does for the window after latest roll up. It's used to reprocess data after a mistake in expressions,
+// arrival of late data or change of Interval. From and to must be aligned to partitions.
+// Meta info is not changed, each replaced window is recorded at rollup_audit_log with Report.RunID instead.
+func (s *RollUp) RunRange(ctx context.Context, opts RunOptions, from, to time.Time) (Report, error) {
+	opts.window = &timeUtils.Range{
+		From: from,
+		To:   to,
+	}
+
+	return s.Run(ctx, opts)
+}
+
+// rollUpRangeOnShard rolls up the window of RunRange on the shard.
+func rollUpRangeOnShard(ctx context.Context, shard database.Shard, opts RunOptions, runID string, prepared func(), report *ShardReport) error {
+	window := *opts.window
+
+	partitionPeriod := opts.partitionPeriod()
+	if !partitionPeriod.isBoundary(window.From, opts.location) || !partitionPeriod.isBoundary(window.To, opts.location) {
+		return fmt.Errorf("%w: partition is %s", errWindowNotAligned, partitionPeriod.String())
+	}
+
+	if err := shard.Exec(ctx, serviceTableDefinition(rollUpAuditLogTableDefinition, "rollup_audit_log", opts.Replicated)); err != nil {
+		return fmt.Errorf("failed to create audit log table: %w", err)
+	}
+
+	report.Window = TimeRange(window)
+
+	return rollUpOnShard(ctx, shard, opts, runID, window, prepared, report)
+}
+
+func newAuditLog(opts RunOptions, runID string, window timeUtils.Range, partitions []string) auditLog {
+	return auditLog{
+		metaInfoKey: newMetaInfoKey(opts),
+		Window:      window,
+		Partitions:  partitions,
+		RunID:       runID,
+		CreatedAt:   timeNow(),
+	}
+}
+
+func addAuditLogOnShard(ctx context.Context, shard database.Shard, auditLog auditLog) error {
+	ib := sqlbuilder.NewInsertBuilder().InsertInto("rollup_audit_log")
+	ib.Cols("database", "table", "after_sec", "interval_sec", "interval_calendar", "window_from", "window_to", "partitions", "run_id", "created_at")
+	ib.Values(
+		auditLog.Database,
+		auditLog.Table,
+		timeUtils.SecondsFromDuration(auditLog.After),
+		timeUtils.SecondsFromDuration(auditLog.Interval),
+		auditLog.CalendarInterval.String(),
+		auditLog.Window.From,
+		auditLog.Window.To,
+		auditLog.Partitions,
+		auditLog.RunID,
+		auditLog.CreatedAt,
+	)
+
+	sql, args := ib.BuildWithFlavor(sqlbuilder.ClickHouse)
+
+	if err := shard.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("failed to add audit log: %w", err)
+	}
+
+	return nil
+}
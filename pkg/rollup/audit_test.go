@@ -0,0 +1,244 @@
+// Copyright 2025 LLC "Ozon Technologies".
+// SPDX-License-Identifier: Apache-2.0
+
+package rollup
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	"github.com/ozontech/ch-rollup/pkg/database"
+	"github.com/ozontech/ch-rollup/pkg/database/mock"
+	"github.com/ozontech/ch-rollup/pkg/types"
+)
+
+//nolint:paralleltest
+func TestRollUp_RunRange(t *testing.T) {
+	defaultNewUniqueID := newUniqueID
+
+	defer func() {
+		timeNow = time.Now
+		newUniqueID = defaultNewUniqueID
+	}()
+
+	const (
+		testDatabase     = "test_database"
+		testTable        = "test_table"
+		testTempTable    = "test_temp_table"
+		testPartitionKey = time.Hour * 24
+		testInterval     = time.Hour
+		testAfter        = time.Hour * 24
+		testCopyInterval = time.Hour
+
+		testShardName = "test-shard"
+		testPartition = "test-partition"
+		testRunID     = "test-run-id"
+
+		testRowsBefore  = 1440
+		testBytesBefore = 4096
+		testRowsAfter   = 24
+		testBytesAfter  = 512
+	)
+
+	var (
+		testColumns = []types.ColumnSetting{
+			{
+				Name: "test",
+			},
+			{
+				Name:         "test_time",
+				IsRollUpTime: true,
+			},
+		}
+
+		testOpts = RunOptions{
+			Database:     testDatabase,
+			Table:        testTable,
+			TempTable:    testTempTable,
+			PartitionKey: testPartitionKey,
+			Columns:      testColumns,
+			Interval:     testInterval,
+			After:        testAfter,
+			CopyInterval: testCopyInterval,
+		}
+
+		testFrom        = time.Date(2024, time.May, 10, 0, 0, 0, 0, time.UTC)
+		testTo          = time.Date(2024, time.May, 11, 0, 0, 0, 0, time.UTC)
+		testCurrentTime = time.Date(2024, time.June, 25, 10, 0, 0, 0, time.UTC)
+	)
+
+	timeNow = func() time.Time {
+		return testCurrentTime
+	}
+
+	newUniqueID = func() string {
+		return testRunID
+	}
+
+	expectPrepare := func(ctrl *gomock.Controller, clusterMock *mock.MockCluster, shardMock *mock.MockShard) {
+		clusterMock.EXPECT().Shards(gomock.Any()).Return([]database.Shard{shardMock}, nil)
+		shardMock.EXPECT().Name().Return(testShardName)
+		expectPartitionKey(ctrl, shardMock, testDatabase, testTable, "toYYYYMMDD(test_time)")
+		expectTableColumns(ctrl, shardMock, testDatabase, testTable, testColumns)
+		expectExpressionTypes(ctrl, shardMock, testDatabase, testTable, testColumns)
+		expectTimeColumnType(ctrl, shardMock, testDatabase, testTable, "test_time", "DateTime")
+		expectServerTimezone(ctrl, shardMock, "UTC")
+	}
+
+	tests := []struct {
+		name        string
+		prepareMock func(ctrl *gomock.Controller) database.Cluster
+		from        time.Time
+		to          time.Time
+		want        Report
+		wantErr     bool
+	}{
+		{
+			name: "Ok",
+			prepareMock: func(ctrl *gomock.Controller) database.Cluster {
+				clusterMock := mock.NewMockCluster(ctrl)
+				shardMock := mock.NewMockShard(ctrl)
+
+				expectPrepare(ctrl, clusterMock, shardMock)
+
+				shardMock.EXPECT().Exec(gomock.Any(), serviceTableDefinition(rollUpAuditLogTableDefinition, "rollup_audit_log", false))
+				shardMock.EXPECT().Exec(gomock.Any(), `CREATE TABLE "test_database"."test_temp_table" AS "test_database"."test_table"`)
+
+				shardMock.EXPECT().Exec(
+					gomock.Any(),
+					`INSERT INTO "test_database"."test_temp_table" ("test", "test_time") SELECT "test", toStartOfInterval("test_time", INTERVAL 3600 SECOND) as "test_time" FROM "test_database"."test_table" WHERE "test_table"."test_time" >= ? AND "test_table"."test_time" < ? GROUP BY "test", "test_time"`,
+					gomock.Any(),
+					gomock.Any(),
+				).Times(24)
+
+				rowsMock := mock.NewMockRows(ctrl)
+
+				rowsMock.EXPECT().Next().Return(true)
+				rowsMock.EXPECT().Scan(gomock.Any()).SetArg(0, testPartition)
+				rowsMock.EXPECT().Next()
+				rowsMock.EXPECT().Err()
+				rowsMock.EXPECT().Close()
+
+				shardMock.EXPECT().Query(
+					gomock.Any(),
+					"SELECT partition FROM system.parts WHERE database = ? AND table = ? AND active = ? GROUP BY partition",
+					testDatabase,
+					testTempTable,
+					1,
+				).Return(rowsMock, nil)
+
+				expectPartsStats(ctrl, shardMock, testDatabase, testTable, []string{testPartition}, testRowsBefore, testBytesBefore)
+				expectPartsStats(ctrl, shardMock, testDatabase, testTempTable, []string{testPartition}, testRowsAfter, testBytesAfter)
+
+				shardMock.EXPECT().Exec(
+					gomock.Any(),
+					`ALTER TABLE "test_database"."test_table" REPLACE PARTITION ? FROM "test_database"."test_temp_table"`,
+					testPartition,
+				)
+
+				// Meta info is not changed, the window is recorded at audit log.
+				shardMock.EXPECT().Exec(
+					gomock.Any(),
+					"INSERT INTO rollup_audit_log (database, table, after_sec, interval_sec, interval_calendar, window_from, window_to, partitions, run_id, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+					testDatabase,
+					testTable,
+					int(testAfter.Seconds()),
+					int(testInterval.Seconds()),
+					"",
+					testFrom,
+					testTo,
+					[]string{testPartition},
+					testRunID,
+					testCurrentTime,
+				)
+
+				shardMock.EXPECT().Exec(
+					gomock.Any(),
+					`DROP TABLE "test_database"."test_temp_table"`,
+				)
+
+				return clusterMock
+			},
+			from: testFrom,
+			to:   testTo,
+			want: Report{
+				Database: testDatabase,
+				Table:    testTable,
+				After:    testAfter,
+				Interval: testInterval,
+				RunID:    testRunID,
+				Shards: []ShardReport{
+					{
+						Shard: testShardName,
+						Window: TimeRange{
+							From: testFrom,
+							To:   testTo,
+						},
+						RowsRead:    testRowsBefore,
+						RowsWritten: testRowsAfter,
+						BytesBefore: testBytesBefore,
+						BytesAfter:  testBytesAfter,
+						Partitions:  []string{testPartition},
+						Durations: map[Stage]time.Duration{
+							StagePrepare: 0,
+							StageCopy:    0,
+							StageReplace: 0,
+							StageCommit:  0,
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "Not aligned to partitions",
+			prepareMock: func(ctrl *gomock.Controller) database.Cluster {
+				clusterMock := mock.NewMockCluster(ctrl)
+				shardMock := mock.NewMockShard(ctrl)
+
+				expectPrepare(ctrl, clusterMock, shardMock)
+
+				return clusterMock
+			},
+			from: testFrom.Add(time.Hour),
+			to:   testTo,
+			want: Report{
+				Database: testDatabase,
+				Table:    testTable,
+				After:    testAfter,
+				Interval: testInterval,
+				RunID:    testRunID,
+				Shards: []ShardReport{
+					{
+						Shard:     testShardName,
+						Durations: map[Stage]time.Duration{},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Bad time range",
+			prepareMock: func(ctrl *gomock.Controller) database.Cluster {
+				return mock.NewMockCluster(ctrl)
+			},
+			from:    testTo,
+			to:      testFrom,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			s := New(tt.prepareMock(ctrl))
+
+			got, err := s.RunRange(context.Background(), testOpts, tt.from, tt.to)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,366 @@
+// Copyright 2025 LLC "Ozon Technologies".
+// SPDX-License-Identifier: Apache-2.0
+
+package rollup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/huandu/go-sqlbuilder"
+	"golang.org/x/sync/errgroup"
+
+	databaseUtils "github.com/ozontech/ch-rollup/internal/utils/database"
+	sqlUtils "github.com/ozontech/ch-rollup/internal/utils/sql"
+	timeUtils "github.com/ozontech/ch-rollup/internal/utils/time"
+	"github.com/ozontech/ch-rollup/pkg/database"
+	"github.com/ozontech/ch-rollup/pkg/types"
+)
+
+const (
+	rollUpBackupInfoTableDefinition = `
+			CREATE TABLE IF NOT EXISTS rollup_backup_info(
+				run_id String,
+				database String,
+				table String,
+				backup_table String,
+				after_sec UInt64,
+				interval_sec UInt64,
+				window_from DateTime,
+				window_to DateTime,
+				partitions Array(String),
+				replicated Bool,
+				expires_at DateTime,
+				interval_calendar String,
+				run_range Bool
+			) ENGINE = %s ORDER BY (database, table, run_id);
+	`
+)
+
+// ErrBackupNotFound is returned by Restore when there is no backup of the run on any shard.
+var ErrBackupNotFound = errors.New("backup not found")
+
+var errInvalidBackupInfo = errors.New("invalid backup info")
+
+type backupInfo struct {
+	RunID       string
+	Database    string
+	Table       string
+	BackupTable string
+	After       time.Duration
+	Interval    time.Duration
+	Window      timeUtils.Range
+	// CalendarInterval is set instead of Interval.
+	CalendarInterval types.CalendarInterval
+	Partitions       []string
+	Replicated       bool
+	ExpiresAt        time.Time
+	// RunRange is set for backups of RunRange, it doesn't change meta info, so Restore doesn't reset it.
+	RunRange bool
+}
+
+func getBackupTable(table, runID string) string {
+	return table + "_backup_" + runID
+}
+
+// backupOnShard copies partitions of origin table to the backup table of the run
+// and saves backup info, so partitions can be restored by Restore.
+// Backup table is created only if createTable is set, otherwise partitions are added to existing one.
+func backupOnShard(ctx context.Context, shard database.Shard, opts RunOptions, runID string, window timeUtils.Range, partitions []string, createTable bool) (err error) {
+	targetDatabase, targetTable := opts.targetDatabase(), opts.targetTable()
+	backupTable := getBackupTable(targetTable, runID)
+
+	if createTable {
+		if err = shard.Exec(ctx, serviceTableDefinition(rollUpBackupInfoTableDefinition, "rollup_backup_info", opts.Replicated)); err != nil {
+			return fmt.Errorf("failed to create backup info table: %w", err)
+		}
+
+		if err = createTableAsOrigin(ctx, shard, opts, backupTable); err != nil {
+			return err
+		}
+
+		defer func() {
+			if err != nil {
+				// Incomplete backup is useless.
+				_ = databaseUtils.DropTable(ctx, shard, targetDatabase, backupTable)
+			}
+		}()
+	}
+
+	// REPLACE PARTITION copies data, so origin partitions stay untouched.
+	if err = replacePartitionsOnShard(ctx, shard, targetDatabase, targetTable, backupTable, partitions, opts.Replicated); err != nil {
+		return fmt.Errorf("failed to backup partitions from %s.%s to %s.%s: %w", targetDatabase, targetTable, targetDatabase, backupTable, err)
+	}
+
+	return addBackupInfoOnShard(ctx, shard, backupInfo{
+		RunID:       runID,
+		Database:    targetDatabase,
+		Table:       targetTable,
+		BackupTable: backupTable,
+		After:       opts.After,
+		Interval:    opts.Interval,
+		Window:      window,
+		Partitions:  partitions,
+		Replicated:  opts.Replicated,
+		ExpiresAt:   timeNow().Add(opts.BackupRetention),
+		RunRange:    opts.window != nil,
+
+		CalendarInterval: opts.CalendarInterval,
+	})
+}
+
+func addBackupInfoOnShard(ctx context.Context, shard database.Shard, info backupInfo) error {
+	ib := sqlbuilder.NewInsertBuilder().InsertInto("rollup_backup_info")
+	ib.Cols("run_id", "database", "table", "backup_table", "after_sec", "interval_sec", "window_from", "window_to", "partitions", "replicated", "expires_at", "interval_calendar", "run_range")
+	ib.Values(
+		info.RunID,
+		info.Database,
+		info.Table,
+		info.BackupTable,
+		timeUtils.SecondsFromDuration(info.After),
+		timeUtils.SecondsFromDuration(info.Interval),
+		info.Window.From,
+		info.Window.To,
+		info.Partitions,
+		info.Replicated,
+		info.ExpiresAt,
+		info.CalendarInterval.String(),
+		info.RunRange,
+	)
+
+	sql, args := ib.BuildWithFlavor(sqlbuilder.ClickHouse)
+
+	return shard.Exec(ctx, sql, args...)
+}
+
+// dropExpiredBackupsOnShard drops backup tables of the table with expired retention.
+func dropExpiredBackupsOnShard(ctx context.Context, shard database.Shard, databaseName, table string) error {
+	expired, err := getExpiredBackupsOnShard(ctx, shard, databaseName, table)
+	if err != nil {
+		if isUnknownTable(err) {
+			// There were no backups yet.
+			return nil
+		}
+
+		return fmt.Errorf("failed to get expired backups: %w", err)
+	}
+
+	for _, info := range expired {
+		err = databaseUtils.DropTable(ctx, shard, databaseName, info.BackupTable)
+		if err != nil && !isUnknownTable(err) {
+			return err
+		}
+
+		err = shard.Exec(ctx, "ALTER TABLE rollup_backup_info DELETE WHERE run_id = ? SETTINGS mutations_sync = 2", info.RunID)
+		if err != nil {
+			return fmt.Errorf("failed to delete info of backup %s: %w", info.RunID, err)
+		}
+	}
+
+	return nil
+}
+
+func getExpiredBackupsOnShard(ctx context.Context, shard database.Shard, databaseName, table string) ([]backupInfo, error) {
+	sb := sqlbuilder.NewSelectBuilder().From("rollup_backup_info")
+	sb.Select("run_id", "backup_table")
+	sb.Where(
+		sb.Equal("database", databaseName),
+		sb.Equal("table", table),
+		sb.LessEqualThan("expires_at", timeNow()),
+	)
+
+	sql, args := sb.BuildWithFlavor(sqlbuilder.ClickHouse)
+
+	rows, err := shard.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []backupInfo
+
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		var info backupInfo
+
+		if err = rows.Scan(&info.RunID, &info.BackupTable); err != nil {
+			return nil, err
+		}
+
+		result = append(result, info)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Restore puts partitions replaced by the run with runID back from backup on every shard.
+// Meta info is reset to the start of the restored window, so the data will be rolled up again by next Run.
+// Meta info is kept for runs of RunRange, they don't change it.
+// Restore must be called before next roll ups of the same table, otherwise their results will be overwritten.
+func (s *RollUp) Restore(ctx context.Context, runID string) error {
+	if s == nil || s.cluster == nil {
+		return errNotInitialized
+	}
+
+	shards, err := s.cluster.Shards(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get shards: %w", err)
+	}
+
+	restored := make([]bool, len(shards))
+
+	g, gCtx := errgroup.WithContext(ctx)
+	for i, shard := range shards {
+		g.Go(func() error {
+			ok, err := restoreOnShard(gCtx, shard, runID)
+			if err != nil {
+				return fmt.Errorf("failed to restore backup %s on %s: %w", runID, shard.Name(), err)
+			}
+
+			restored[i] = ok
+
+			return nil
+		})
+	}
+
+	if err = g.Wait(); err != nil {
+		return err
+	}
+
+	for _, ok := range restored {
+		if ok {
+			return nil
+		}
+	}
+
+	return ErrBackupNotFound
+}
+
+// restoreOnShard returns false if there is no backup of the run on the shard.
+func restoreOnShard(ctx context.Context, shard database.Shard, runID string) (bool, error) {
+	infos, err := getBackupInfosOnShard(ctx, shard, runID)
+	if err != nil {
+		if isUnknownTable(err) {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("failed to get backup info: %w", err)
+	}
+
+	if len(infos) == 0 {
+		return false, nil
+	}
+
+	// Each commit window of the run has its own backup info.
+	restoreFrom := infos[0].Window.From
+
+	for _, info := range infos {
+		if sqlUtils.ValidateEntityName(info.Database) != nil || sqlUtils.ValidateEntityName(info.Table) != nil || sqlUtils.ValidateEntityName(info.BackupTable) != nil {
+			return false, errInvalidBackupInfo
+		}
+
+		if err = replacePartitionsOnShard(ctx, shard, info.Database, info.BackupTable, info.Table, info.Partitions, info.Replicated); err != nil {
+			return false, fmt.Errorf("failed to restore partitions from %s.%s to %s.%s: %w", info.Database, info.BackupTable, info.Database, info.Table, err)
+		}
+
+		if info.Window.From.Before(restoreFrom) {
+			restoreFrom = info.Window.From
+		}
+	}
+
+	// Window of RunRange is behind latest roll up, resetting meta info to it would roll up data after it again.
+	if infos[0].RunRange {
+		return true, nil
+	}
+
+	err = deleteMetaInfoAfterOnShard(
+		ctx,
+		shard,
+		metaInfoKey{
+			Database: infos[0].Database,
+			Table:    infos[0].Table,
+			After:    infos[0].After,
+			Interval: infos[0].Interval,
+
+			CalendarInterval: infos[0].CalendarInterval,
+		},
+		restoreFrom,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to reset meta info: %w", err)
+	}
+
+	return true, nil
+}
+
+func getBackupInfosOnShard(ctx context.Context, shard database.Shard, runID string) ([]backupInfo, error) {
+	sb := sqlbuilder.NewSelectBuilder().From("rollup_backup_info")
+	sb.Select("database", "table", "backup_table", "after_sec", "interval_sec", "window_from", "partitions", "replicated", "interval_calendar", "run_range")
+	sb.Where(sb.Equal("run_id", runID))
+
+	sql, args := sb.BuildWithFlavor(sqlbuilder.ClickHouse)
+
+	rows, err := shard.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []backupInfo
+
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		var (
+			info                  = backupInfo{RunID: runID}
+			afterSec, intervalSec uint64
+			calendarInterval      string
+		)
+
+		err = rows.Scan(
+			&info.Database,
+			&info.Table,
+			&info.BackupTable,
+			&afterSec,
+			&intervalSec,
+			&info.Window.From,
+			&info.Partitions,
+			&info.Replicated,
+			&calendarInterval,
+			&info.RunRange,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if info.CalendarInterval, err = parseCalendarInterval(calendarInterval); err != nil {
+			return nil, fmt.Errorf("%w: %w", errInvalidBackupInfo, err)
+		}
+
+		info.After = time.Duration(afterSec) * time.Second
+		info.Interval = time.Duration(intervalSec) * time.Second
+
+		result = append(result, info)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func isUnknownTable(err error) bool {
+	var queryError database.QueryError
+
+	return errors.As(err, &queryError) && queryError.Type == database.ErrUnknownTable
+}
@@ -0,0 +1,387 @@
+// Copyright 2025 LLC "Ozon Technologies".
+// SPDX-License-Identifier: Apache-2.0
+
+package rollup
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	timeUtils "github.com/ozontech/ch-rollup/internal/utils/time"
+	"github.com/ozontech/ch-rollup/pkg/database"
+	"github.com/ozontech/ch-rollup/pkg/database/mock"
+)
+
+func Test_backupOnShard(t *testing.T) {
+	t.Parallel()
+
+	const (
+		testDatabase  = "test_database"
+		testTable     = "test_table"
+		testRunID     = "test_run"
+		testPartition = "test-partition"
+		testRetention = time.Hour * 24 * 7
+	)
+
+	var (
+		errTest = errors.New("test")
+
+		testWindow = timeUtils.Range{
+			From: time.Date(2024, time.June, 23, 0, 0, 0, 0, time.UTC),
+			To:   time.Date(2024, time.June, 24, 0, 0, 0, 0, time.UTC),
+		}
+	)
+
+	tests := []struct {
+		name        string
+		prepareMock func(shard *mock.MockShard)
+		createTable bool
+		runRange    bool
+		wantErr     bool
+	}{
+		{
+			name: "Ok",
+			prepareMock: func(shard *mock.MockShard) {
+				gomock.InOrder(
+					shard.EXPECT().Exec(gomock.Any(), serviceTableDefinition(rollUpBackupInfoTableDefinition, "rollup_backup_info", false)),
+					shard.EXPECT().Exec(gomock.Any(), `CREATE TABLE "test_database"."test_table_backup_test_run" AS "test_database"."test_table"`),
+					shard.EXPECT().Exec(
+						gomock.Any(),
+						`ALTER TABLE "test_database"."test_table_backup_test_run" REPLACE PARTITION ? FROM "test_database"."test_table"`,
+						testPartition,
+					),
+					shard.EXPECT().Exec(
+						gomock.Any(),
+						"INSERT INTO rollup_backup_info (run_id, database, table, backup_table, after_sec, interval_sec, window_from, window_to, partitions, replicated, expires_at, interval_calendar, run_range) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+						testRunID,
+						testDatabase,
+						testTable,
+						"test_table_backup_test_run",
+						86400,
+						3600,
+						testWindow.From,
+						testWindow.To,
+						[]string{testPartition},
+						false,
+						gomock.Any(),
+						"",
+						false,
+					),
+				)
+			},
+			createTable: true,
+		},
+		{
+			name: "Ok with existing backup table",
+			prepareMock: func(shard *mock.MockShard) {
+				gomock.InOrder(
+					shard.EXPECT().Exec(
+						gomock.Any(),
+						`ALTER TABLE "test_database"."test_table_backup_test_run" REPLACE PARTITION ? FROM "test_database"."test_table"`,
+						testPartition,
+					),
+					shard.EXPECT().Exec(gomock.Any(), gomock.Any(), gomock.Any()),
+				)
+			},
+		},
+		{
+			name: "Ok run range",
+			prepareMock: func(shard *mock.MockShard) {
+				gomock.InOrder(
+					shard.EXPECT().Exec(
+						gomock.Any(),
+						`ALTER TABLE "test_database"."test_table_backup_test_run" REPLACE PARTITION ? FROM "test_database"."test_table"`,
+						testPartition,
+					),
+					shard.EXPECT().Exec(
+						gomock.Any(),
+						gomock.Any(),
+						testRunID,
+						testDatabase,
+						testTable,
+						"test_table_backup_test_run",
+						86400,
+						3600,
+						testWindow.From,
+						testWindow.To,
+						[]string{testPartition},
+						false,
+						gomock.Any(),
+						"",
+						true,
+					),
+				)
+			},
+			runRange: true,
+		},
+		{
+			name: "Failed to create backup table",
+			prepareMock: func(shard *mock.MockShard) {
+				gomock.InOrder(
+					shard.EXPECT().Exec(gomock.Any(), serviceTableDefinition(rollUpBackupInfoTableDefinition, "rollup_backup_info", false)),
+					shard.EXPECT().Exec(gomock.Any(), `CREATE TABLE "test_database"."test_table_backup_test_run" AS "test_database"."test_table"`).Return(errTest),
+				)
+			},
+			createTable: true,
+			wantErr:     true,
+		},
+		{
+			name: "Failed to copy partitions drops backup table",
+			prepareMock: func(shard *mock.MockShard) {
+				gomock.InOrder(
+					shard.EXPECT().Exec(gomock.Any(), serviceTableDefinition(rollUpBackupInfoTableDefinition, "rollup_backup_info", false)),
+					shard.EXPECT().Exec(gomock.Any(), `CREATE TABLE "test_database"."test_table_backup_test_run" AS "test_database"."test_table"`),
+					shard.EXPECT().Exec(
+						gomock.Any(),
+						`ALTER TABLE "test_database"."test_table_backup_test_run" REPLACE PARTITION ? FROM "test_database"."test_table"`,
+						testPartition,
+					).Return(errTest),
+					shard.EXPECT().Exec(gomock.Any(), `DROP TABLE "test_database"."test_table_backup_test_run"`),
+				)
+			},
+			createTable: true,
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctrl := gomock.NewController(t)
+
+			shardMock := mock.NewMockShard(ctrl)
+			tt.prepareMock(shardMock)
+
+			opts := RunOptions{
+				Database:        testDatabase,
+				Table:           testTable,
+				After:           time.Hour * 24,
+				Interval:        time.Hour,
+				BackupRetention: testRetention,
+			}
+			if tt.runRange {
+				opts.window = &testWindow
+			}
+
+			err := backupOnShard(
+				context.Background(),
+				shardMock,
+				opts,
+				testRunID,
+				testWindow,
+				[]string{testPartition},
+				tt.createTable,
+			)
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
+
+func Test_dropExpiredBackupsOnShard(t *testing.T) {
+	t.Parallel()
+
+	const (
+		testDatabase = "test_database"
+		testTable    = "test_table"
+
+		selectQuery = "SELECT run_id, backup_table FROM rollup_backup_info WHERE database = ? AND table = ? AND expires_at <= ?"
+		deleteQuery = "ALTER TABLE rollup_backup_info DELETE WHERE run_id = ? SETTINGS mutations_sync = 2"
+	)
+
+	tests := []struct {
+		name        string
+		prepareMock func(ctrl *gomock.Controller, shard *mock.MockShard)
+		wantErr     bool
+	}{
+		{
+			name: "Ok",
+			prepareMock: func(ctrl *gomock.Controller, shard *mock.MockShard) {
+				rowsMock := mock.NewMockRows(ctrl)
+
+				rowsMock.EXPECT().Next().Return(true)
+				rowsMock.EXPECT().Scan(gomock.Any()).DoAndReturn(func(dest ...any) error {
+					*dest[0].(*string) = "test_run"
+					*dest[1].(*string) = "test_table_backup_test_run"
+
+					return nil
+				})
+				rowsMock.EXPECT().Next()
+				rowsMock.EXPECT().Err()
+				rowsMock.EXPECT().Close()
+
+				gomock.InOrder(
+					shard.EXPECT().Query(gomock.Any(), selectQuery, testDatabase, testTable, gomock.Any()).Return(rowsMock, nil),
+					shard.EXPECT().Exec(gomock.Any(), `DROP TABLE "test_database"."test_table_backup_test_run"`),
+					shard.EXPECT().Exec(gomock.Any(), deleteQuery, "test_run"),
+				)
+			},
+		},
+		{
+			name: "No backups yet",
+			prepareMock: func(_ *gomock.Controller, shard *mock.MockShard) {
+				shard.EXPECT().Query(gomock.Any(), selectQuery, testDatabase, testTable, gomock.Any()).Return(nil, database.QueryError{
+					Type: database.ErrUnknownTable,
+				})
+			},
+		},
+		{
+			name: "Failed to get expired backups",
+			prepareMock: func(_ *gomock.Controller, shard *mock.MockShard) {
+				shard.EXPECT().Query(gomock.Any(), selectQuery, testDatabase, testTable, gomock.Any()).Return(nil, errors.New("test"))
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctrl := gomock.NewController(t)
+
+			shardMock := mock.NewMockShard(ctrl)
+			tt.prepareMock(ctrl, shardMock)
+
+			err := dropExpiredBackupsOnShard(context.Background(), shardMock, testDatabase, testTable)
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
+
+func TestRollUp_Restore(t *testing.T) {
+	t.Parallel()
+
+	const (
+		testRunID     = "test_run"
+		testPartition = "test-partition"
+
+		selectQuery = "SELECT database, table, backup_table, after_sec, interval_sec, window_from, partitions, replicated, interval_calendar, run_range FROM rollup_backup_info WHERE run_id = ?"
+	)
+
+	testWindowFrom := time.Date(2024, time.June, 23, 0, 0, 0, 0, time.UTC)
+
+	expectBackupInfo := func(ctrl *gomock.Controller, shard *mock.MockShard, runRange bool, windowsFrom ...time.Time) {
+		rowsMock := mock.NewMockRows(ctrl)
+
+		for _, windowFrom := range windowsFrom {
+			rowsMock.EXPECT().Next().Return(true)
+			rowsMock.EXPECT().Scan(gomock.Any()).DoAndReturn(func(dest ...any) error {
+				*dest[0].(*string) = "test_database"
+				*dest[1].(*string) = "test_table"
+				*dest[2].(*string) = "test_table_backup_test_run"
+				*dest[3].(*uint64) = 86400
+				*dest[4].(*uint64) = 3600
+				*dest[5].(*time.Time) = windowFrom
+				*dest[6].(*[]string) = []string{testPartition}
+				*dest[7].(*bool) = true
+				*dest[9].(*bool) = runRange
+
+				return nil
+			})
+		}
+
+		rowsMock.EXPECT().Next()
+		rowsMock.EXPECT().Err()
+		rowsMock.EXPECT().Close()
+
+		shard.EXPECT().Query(gomock.Any(), selectQuery, testRunID).Return(rowsMock, nil)
+	}
+
+	tests := []struct {
+		name        string
+		prepareMock func(ctrl *gomock.Controller) database.Cluster
+		wantErr     error
+	}{
+		{
+			name: "Ok",
+			prepareMock: func(ctrl *gomock.Controller) database.Cluster {
+				clusterMock := mock.NewMockCluster(ctrl)
+				firstShardMock := mock.NewMockShard(ctrl)
+				secondShardMock := mock.NewMockShard(ctrl)
+
+				clusterMock.EXPECT().Shards(gomock.Any()).Return([]database.Shard{firstShardMock, secondShardMock}, nil)
+
+				// Two commit windows were backed up on the first shard.
+				expectBackupInfo(ctrl, firstShardMock, false, testWindowFrom.Add(time.Hour*24), testWindowFrom)
+				gomock.InOrder(
+					firstShardMock.EXPECT().Exec(
+						gomock.Any(),
+						`ALTER TABLE "test_database"."test_table" REPLACE PARTITION ? FROM "test_database"."test_table_backup_test_run" SETTINGS alter_sync = 2`,
+						testPartition,
+					).Times(2),
+					firstShardMock.EXPECT().Exec(
+						gomock.Any(),
+						"ALTER TABLE rollup_meta_info DELETE WHERE database = ? AND table = ? AND after_sec = ? AND interval_sec = ? AND roll_ups_at > ? SETTINGS mutations_sync = 2",
+						"test_database",
+						"test_table",
+						86400,
+						3600,
+						testWindowFrom,
+					),
+				)
+
+				// Roll up was skipped on the second shard.
+				expectBackupInfo(ctrl, secondShardMock, false)
+
+				return clusterMock
+			},
+		},
+		{
+			name: "Ok run range keeps meta info",
+			prepareMock: func(ctrl *gomock.Controller) database.Cluster {
+				clusterMock := mock.NewMockCluster(ctrl)
+				shardMock := mock.NewMockShard(ctrl)
+
+				clusterMock.EXPECT().Shards(gomock.Any()).Return([]database.Shard{shardMock}, nil)
+
+				expectBackupInfo(ctrl, shardMock, true, testWindowFrom)
+				// Meta info isn't deleted.
+				shardMock.EXPECT().Exec(
+					gomock.Any(),
+					`ALTER TABLE "test_database"."test_table" REPLACE PARTITION ? FROM "test_database"."test_table_backup_test_run" SETTINGS alter_sync = 2`,
+					testPartition,
+				)
+
+				return clusterMock
+			},
+		},
+		{
+			name: "Backup not found",
+			prepareMock: func(ctrl *gomock.Controller) database.Cluster {
+				clusterMock := mock.NewMockCluster(ctrl)
+				shardMock := mock.NewMockShard(ctrl)
+
+				clusterMock.EXPECT().Shards(gomock.Any()).Return([]database.Shard{shardMock}, nil)
+
+				expectBackupInfo(ctrl, shardMock, false)
+
+				return clusterMock
+			},
+			wantErr: ErrBackupNotFound,
+		},
+		{
+			name: "Not initialized",
+			prepareMock: func(_ *gomock.Controller) database.Cluster {
+				return nil
+			},
+			wantErr: errNotInitialized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctrl := gomock.NewController(t)
+
+			s := &RollUp{
+				cluster: tt.prepareMock(ctrl),
+			}
+
+			assert.ErrorIs(t, s.Restore(context.Background(), testRunID), tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,355 @@
+// Copyright 2025 LLC "Ozon Technologies".
+// SPDX-License-Identifier: Apache-2.0
+
+package rollup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/huandu/go-sqlbuilder"
+	"golang.org/x/sync/errgroup"
+
+	sqlUtils "github.com/ozontech/ch-rollup/internal/utils/sql"
+	timeUtils "github.com/ozontech/ch-rollup/internal/utils/time"
+	"github.com/ozontech/ch-rollup/pkg/database"
+	"github.com/ozontech/ch-rollup/pkg/types"
+)
+
+var (
+	errBadTimeRange = errors.New("from must be before to")
+	errBadStep      = errors.New("step must be greater than 0 for raw data segments")
+	errNoSegments   = errors.New("segments must not be empty")
+)
+
+// Resolutions describes resolution of the table data by shards.
+type Resolutions struct {
+	Shards []ShardResolutions
+}
+
+// ShardResolutions describes resolution of the table data on the shard.
+type ShardResolutions struct {
+	Shard string
+	// Segments cover requested time range in order of time without gaps.
+	Segments []ResolutionSegment
+}
+
+// ResolutionSegment is a time range of the table data at one resolution.
+type ResolutionSegment struct {
+	TimeRange
+	// Interval is a roll up interval of the data. Zero Interval and CalendarInterval mean raw data.
+	Interval time.Duration
+	// CalendarInterval is set instead of Interval for data rolled up in calendar units.
+	CalendarInterval types.CalendarInterval
+	// Partial is set when only rows matching RollUpSetting.Where are rolled up, other rows are raw.
+	Partial bool
+}
+
+// IsRaw reports whether data of the segment is not rolled up.
+func (s ResolutionSegment) IsRaw() bool {
+	return s.Interval == 0 && s.CalendarInterval.IsZero()
+}
+
+// resolutionLevel is a roll up setting of the table with time range rolled up by it.
+type resolutionLevel struct {
+	types.RollUpSetting
+	RolledUp timeUtils.Range
+}
+
+// Resolutions returns resolution segments of the task table in the time range on each shard of current database.Cluster.
+// They are built from meta info of roll up settings that replace data of the table, the one with greater After wins
+// where rolled up ranges overlap. Time not rolled up by any setting is raw data.
+func (s *RollUp) Resolutions(ctx context.Context, task types.Task, r TimeRange) (Resolutions, error) {
+	if s == nil || s.cluster == nil {
+		return Resolutions{}, errNotInitialized
+	}
+
+	if err := task.Validate(); err != nil {
+		return Resolutions{}, fmt.Errorf("failed to validate task: %w", err)
+	}
+
+	if !r.From.Before(r.To) {
+		return Resolutions{}, errBadTimeRange
+	}
+
+	shards, err := s.cluster.Shards(ctx)
+	if err != nil {
+		return Resolutions{}, fmt.Errorf("failed to get shards: %w", err)
+	}
+
+	result := Resolutions{
+		Shards: make([]ShardResolutions, len(shards)),
+	}
+
+	g, eCtx := errgroup.WithContext(ctx)
+	for i, shard := range shards {
+		g.Go(func() error {
+			levels, err := getResolutionLevelsOnShard(eCtx, shard, task)
+			if err != nil {
+				return fmt.Errorf("failed to get resolutions on %s: %w", shard.Name(), err)
+			}
+
+			result.Shards[i] = ShardResolutions{
+				Shard:    shard.Name(),
+				Segments: buildResolutionSegments(levels, timeUtils.Range{From: r.From, To: r.To}),
+			}
+
+			return nil
+		})
+	}
+
+	if err = g.Wait(); err != nil {
+		return Resolutions{}, err
+	}
+
+	return result, nil
+}
+
+// getResolutionLevelsOnShard returns roll up settings of the task that replace data of the table and were run on the shard.
+func getResolutionLevelsOnShard(ctx context.Context, shard database.Shard, task types.Task) ([]resolutionLevel, error) {
+	var result []resolutionLevel
+
+	for _, rollUpSetting := range task.RollUpSettings {
+		// Data rolled up to other table doesn't change resolution of the table.
+		if rollUpSetting.TargetTable != "" || rollUpSetting.TargetDatabase != "" {
+			continue
+		}
+
+		rolledUp, err := getRolledUpRangeByKeyOnShard(ctx, shard, metaInfoKey{
+			Database:         task.Database,
+			Table:            task.Table,
+			After:            rollUpSetting.After,
+			Interval:         rollUpSetting.Interval,
+			CalendarInterval: rollUpSetting.CalendarInterval,
+		})
+		if err != nil {
+			if isMetaInfoNotFound(err) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		result = append(result, resolutionLevel{
+			RollUpSetting: rollUpSetting,
+			RolledUp:      rolledUp,
+		})
+	}
+
+	return result, nil
+}
+
+// buildResolutionSegments splits the time range by rolled up ranges of levels.
+// Where rolled up ranges overlap, the level with greater After wins, because it rolls up older data later.
+func buildResolutionSegments(levels []resolutionLevel, r timeUtils.Range) []ResolutionSegment {
+	bounds := []time.Time{r.From, r.To}
+
+	for _, level := range levels {
+		for _, bound := range []time.Time{level.RolledUp.From, level.RolledUp.To} {
+			if bound.After(r.From) && bound.Before(r.To) {
+				bounds = append(bounds, bound)
+			}
+		}
+	}
+
+	slices.SortFunc(bounds, time.Time.Compare)
+	bounds = slices.CompactFunc(bounds, time.Time.Equal)
+
+	var result []ResolutionSegment
+
+	for i := 0; i+1 < len(bounds); i++ {
+		segment := ResolutionSegment{
+			TimeRange: TimeRange{From: bounds[i], To: bounds[i+1]},
+		}
+
+		var after time.Duration
+
+		for _, level := range levels {
+			covers := !segment.From.Before(level.RolledUp.From) && !segment.To.After(level.RolledUp.To)
+			if !covers || level.After < after {
+				continue
+			}
+
+			after = level.After
+			segment.Interval = level.Interval
+			segment.CalendarInterval = level.CalendarInterval
+			segment.Partial = level.Where != ""
+		}
+
+		// Adjacent segments of the same resolution are merged.
+		if last := len(result) - 1; last >= 0 && sameResolution(result[last], segment) {
+			result[last].To = segment.To
+			continue
+		}
+
+		result = append(result, segment)
+	}
+
+	return result
+}
+
+func sameResolution(a, b ResolutionSegment) bool {
+	return a.Interval == b.Interval && a.CalendarInterval == b.CalendarInterval && a.Partial == b.Partial
+}
+
+// ResolutionQueryOptions defines query generated by ResolutionQuery.
+type ResolutionQueryOptions struct {
+	Database string
+	Table    string
+	// TimeColumn is a time column of the table.
+	TimeColumn string
+	// TimeColumnType is a type of TimeColumn. Default: DateTime.
+	TimeColumnType types.TimeColumnType
+	// Value is an aggregate expression calculated for each step, like 'countMerge(hits)'.
+	Value string
+	// Step is a minimal step of the query. Step of rolled up segment is rounded up to a multiple of its interval,
+	// so values are not split between steps, and step over Date column to a multiple of a day.
+	// It must be set for raw data segments.
+	Step time.Duration
+	// Rate makes Value divided by length of the step in seconds, so values of steps of different length are comparable.
+	Rate bool
+	// Where is an optional predicate of rows.
+	Where string
+}
+
+func (opts ResolutionQueryOptions) validate() error {
+	if err := sqlUtils.ValidateEntityName(opts.Database); err != nil {
+		return fmt.Errorf("failed to validate database: %w", err)
+	}
+
+	if err := sqlUtils.ValidateEntityName(opts.Table); err != nil {
+		return fmt.Errorf("failed to validate table name: %w", err)
+	}
+
+	if err := sqlUtils.ValidateEntityName(opts.TimeColumn); err != nil {
+		return fmt.Errorf("failed to validate timeColumn: %w", err)
+	}
+
+	if opts.TimeColumnType != "" {
+		if err := opts.TimeColumnType.Validate(); err != nil {
+			return fmt.Errorf("failed to validate timeColumnType: %w", err)
+		}
+	}
+
+	if err := sqlUtils.ValidateExpression(opts.Value, sqlUtils.ExpressionOptions{}); err != nil {
+		return fmt.Errorf("failed to validate value: %w", err)
+	}
+
+	if opts.Where != "" {
+		if err := sqlUtils.ValidateExpression(opts.Where, sqlUtils.ExpressionOptions{}); err != nil {
+			return fmt.Errorf("failed to validate where: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// ResolutionQuery returns SELECT of "time" and "value" columns ordered by time over the segments,
+// each segment is bucketed by its own step. Segments usually come from Resolutions.
+func ResolutionQuery(segments []ResolutionSegment, opts ResolutionQueryOptions) (string, []any, error) {
+	if err := opts.validate(); err != nil {
+		return "", nil, err
+	}
+
+	if len(segments) == 0 {
+		return "", nil, errNoSegments
+	}
+
+	var (
+		queries []string
+		args    []any
+	)
+
+	for _, segment := range segments {
+		if segment.IsRaw() && opts.Step <= 0 {
+			return "", nil, errBadStep
+		}
+
+		sql, segmentArgs := generateSegmentQuery(segment, opts)
+
+		queries = append(queries, sql)
+		args = append(args, segmentArgs...)
+	}
+
+	return fmt.Sprintf("SELECT * FROM (%s) ORDER BY time", strings.Join(queries, " UNION ALL ")), args, nil
+}
+
+// generateSegmentQuery returns SELECT of values of the segment bucketed by its step.
+func generateSegmentQuery(segment ResolutionSegment, opts ResolutionQueryOptions) (string, []any) {
+	step, calendarStep := opts.Step, segment.CalendarInterval
+	if calendarStep.IsZero() {
+		step = segmentStep(segment, opts)
+	}
+
+	bucketOpts := generateRollUpStatementOptions{
+		Interval:         step,
+		CalendarInterval: calendarStep,
+		TimeColumnType:   opts.TimeColumnType,
+	}
+
+	column := sqlUtils.QuotedDatabaseEntity(opts.Table, opts.TimeColumn)
+	bucket := generateBucketTimeStatement(column, bucketOpts)
+
+	value := opts.Value
+	if opts.Rate {
+		value = fmt.Sprintf("(%s) / %d", value, timeUtils.SecondsFromDuration(step))
+
+		if !calendarStep.IsZero() {
+			value = fmt.Sprintf(
+				"(%s) / dateDiff('second', %s, %s + INTERVAL %d %s)",
+				opts.Value,
+				bucket,
+				bucket,
+				calendarStep.Units(),
+				strings.ToUpper(string(calendarStep.Unit)),
+			)
+		}
+	}
+
+	from, to := timeColumnRange(timeUtils.Range{From: segment.From, To: segment.To}, RunOptions{TimeColumnType: opts.TimeColumnType})
+
+	sb := sqlbuilder.NewSelectBuilder()
+	sb.Select(sb.As(bucket, "time"), sb.As(value, "value"))
+	sb.From(sqlUtils.QuotedDatabaseEntity(opts.Database, opts.Table))
+	sb.Where(
+		sb.GreaterEqualThan(column, from),
+		sb.LessThan(column, to),
+	)
+
+	if opts.Where != "" {
+		sb.Where(fmt.Sprintf("(%s)", opts.Where))
+	}
+
+	sb.GroupBy("time")
+
+	return sb.BuildWithFlavor(sqlbuilder.ClickHouse)
+}
+
+// segmentStep returns Step rounded up to a multiple of interval of the segment, so values of rolled up intervals
+// are not split between steps, and to a multiple of a day for Date time column.
+func segmentStep(segment ResolutionSegment, opts ResolutionQueryOptions) time.Duration {
+	step := opts.Step
+
+	if segment.Interval > 0 {
+		step = roundUpDuration(step, segment.Interval)
+	}
+
+	if opts.TimeColumnType == types.TimeColumnDate {
+		step = roundUpDuration(step, day)
+	}
+
+	return step
+}
+
+// roundUpDuration returns the least positive multiple of unit that is not less than d.
+func roundUpDuration(d, unit time.Duration) time.Duration {
+	if d <= unit {
+		return unit
+	}
+
+	return (d + unit - 1) / unit * unit
+}
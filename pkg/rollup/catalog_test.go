@@ -0,0 +1,379 @@
+// Copyright 2025 LLC "Ozon Technologies".
+// SPDX-License-Identifier: Apache-2.0
+
+package rollup
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	timeUtils "github.com/ozontech/ch-rollup/internal/utils/time"
+	"github.com/ozontech/ch-rollup/pkg/database"
+	"github.com/ozontech/ch-rollup/pkg/database/mock"
+	"github.com/ozontech/ch-rollup/pkg/types"
+)
+
+func TestRollUp_Resolutions(t *testing.T) {
+	t.Parallel()
+
+	const (
+		testShardName = "test-shard"
+
+		rangeQuery = "SELECT min(roll_ups_at), max(roll_ups_at) FROM rollup_meta_info WHERE database = ? AND table = ? AND after_sec = ? AND interval_sec = ? GROUP BY database, table, after_sec, interval_sec"
+	)
+
+	var (
+		testTask = types.Task{
+			Database: "test_database",
+			Table:    "test_table",
+			RollUpSettings: []types.RollUpSetting{
+				{After: time.Hour * 24, Interval: time.Hour},
+				{After: time.Hour * 24 * 7, Interval: time.Hour * 24},
+				{After: time.Hour * 24, Interval: time.Minute, TargetTable: "test_archive"},
+			},
+			ColumnSettings: []types.ColumnSetting{
+				{Name: "test"},
+				{Name: "test_time", IsRollUpTime: true},
+			},
+		}
+
+		day = func(d int) time.Time {
+			return time.Date(2025, time.January, d, 0, 0, 0, 0, time.UTC)
+		}
+
+		testRange = TimeRange{From: day(1), To: day(20)}
+	)
+
+	expectRange := func(ctrl *gomock.Controller, shardMock *mock.MockShard, after, interval time.Duration) *mock.MockRow {
+		rowMock := mock.NewMockRow(ctrl)
+		shardMock.EXPECT().QueryRow(
+			gomock.Any(),
+			rangeQuery,
+			"test_database",
+			"test_table",
+			int(after.Seconds()),
+			int(interval.Seconds()),
+		).Return(rowMock)
+
+		return rowMock
+	}
+
+	scanRange := func(r timeUtils.Range) func(dest ...any) error {
+		return func(dest ...any) error {
+			*dest[0].(*time.Time) = r.From //nolint:forcetypeassert
+			*dest[1].(*time.Time) = r.To   //nolint:forcetypeassert
+
+			return nil
+		}
+	}
+
+	tests := []struct {
+		name        string
+		prepareMock func(ctrl *gomock.Controller) database.Cluster
+		task        types.Task
+		r           TimeRange
+		want        Resolutions
+		wantErr     bool
+	}{
+		{
+			name: "Ok",
+			prepareMock: func(ctrl *gomock.Controller) database.Cluster {
+				clusterMock := mock.NewMockCluster(ctrl)
+				shardMock := mock.NewMockShard(ctrl)
+
+				clusterMock.EXPECT().Shards(gomock.Any()).Return([]database.Shard{shardMock}, nil)
+				shardMock.EXPECT().Name().Return(testShardName)
+
+				expectRange(ctrl, shardMock, time.Hour*24, time.Hour).EXPECT().
+					Scan(gomock.Any(), gomock.Any()).DoAndReturn(scanRange(timeUtils.Range{From: day(5), To: day(15)}))
+				expectRange(ctrl, shardMock, time.Hour*24*7, time.Hour*24).EXPECT().
+					Scan(gomock.Any(), gomock.Any()).DoAndReturn(scanRange(timeUtils.Range{From: day(5), To: day(10)}))
+
+				return clusterMock
+			},
+			task: testTask,
+			r:    testRange,
+			want: Resolutions{
+				Shards: []ShardResolutions{
+					{
+						Shard: testShardName,
+						Segments: []ResolutionSegment{
+							{TimeRange: TimeRange{From: day(1), To: day(5)}},
+							{TimeRange: TimeRange{From: day(5), To: day(10)}, Interval: time.Hour * 24},
+							{TimeRange: TimeRange{From: day(10), To: day(15)}, Interval: time.Hour},
+							{TimeRange: TimeRange{From: day(15), To: day(20)}},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "Ok without roll ups",
+			prepareMock: func(ctrl *gomock.Controller) database.Cluster {
+				clusterMock := mock.NewMockCluster(ctrl)
+				shardMock := mock.NewMockShard(ctrl)
+
+				clusterMock.EXPECT().Shards(gomock.Any()).Return([]database.Shard{shardMock}, nil)
+				shardMock.EXPECT().Name().Return(testShardName)
+
+				expectRange(ctrl, shardMock, time.Hour*24, time.Hour).EXPECT().
+					Scan(gomock.Any(), gomock.Any()).Return(sql.ErrNoRows)
+				expectRange(ctrl, shardMock, time.Hour*24*7, time.Hour*24).EXPECT().
+					Scan(gomock.Any(), gomock.Any()).Return(sql.ErrNoRows)
+
+				return clusterMock
+			},
+			task: testTask,
+			r:    testRange,
+			want: Resolutions{
+				Shards: []ShardResolutions{
+					{
+						Shard:    testShardName,
+						Segments: []ResolutionSegment{{TimeRange: testRange}},
+					},
+				},
+			},
+		},
+		{
+			name: "Failed to get meta info",
+			prepareMock: func(ctrl *gomock.Controller) database.Cluster {
+				clusterMock := mock.NewMockCluster(ctrl)
+				shardMock := mock.NewMockShard(ctrl)
+
+				clusterMock.EXPECT().Shards(gomock.Any()).Return([]database.Shard{shardMock}, nil)
+				shardMock.EXPECT().Name().Return(testShardName)
+
+				expectRange(ctrl, shardMock, time.Hour*24, time.Hour).EXPECT().
+					Scan(gomock.Any(), gomock.Any()).Return(errors.New("test"))
+
+				return clusterMock
+			},
+			task:    testTask,
+			r:       testRange,
+			wantErr: true,
+		},
+		{
+			name: "Bad time range",
+			prepareMock: func(ctrl *gomock.Controller) database.Cluster {
+				return mock.NewMockCluster(ctrl)
+			},
+			task:    testTask,
+			r:       TimeRange{From: day(20), To: day(1)},
+			wantErr: true,
+		},
+		{
+			name: "Bad task",
+			prepareMock: func(ctrl *gomock.Controller) database.Cluster {
+				return mock.NewMockCluster(ctrl)
+			},
+			r:       testRange,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctrl := gomock.NewController(t)
+
+			s := &RollUp{
+				cluster: tt.prepareMock(ctrl),
+			}
+
+			got, err := s.Resolutions(context.Background(), tt.task, tt.r)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_buildResolutionSegments(t *testing.T) {
+	t.Parallel()
+
+	hour := func(h int) time.Time {
+		return time.Date(2025, time.January, 1, h, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name   string
+		levels []resolutionLevel
+		r      timeUtils.Range
+		want   []ResolutionSegment
+	}{
+		{
+			name: "Raw",
+			r:    timeUtils.Range{From: hour(0), To: hour(10)},
+			want: []ResolutionSegment{
+				{TimeRange: TimeRange{From: hour(0), To: hour(10)}},
+			},
+		},
+		{
+			name: "Clipped by range",
+			levels: []resolutionLevel{
+				{
+					RollUpSetting: types.RollUpSetting{Interval: time.Minute, Where: "service_tier = 'low'"},
+					RolledUp:      timeUtils.Range{From: hour(0), To: hour(20)},
+				},
+			},
+			r: timeUtils.Range{From: hour(5), To: hour(10)},
+			want: []ResolutionSegment{
+				{TimeRange: TimeRange{From: hour(5), To: hour(10)}, Interval: time.Minute, Partial: true},
+			},
+		},
+		{
+			name: "Greater after wins",
+			levels: []resolutionLevel{
+				{
+					RollUpSetting: types.RollUpSetting{After: time.Hour * 24 * 30, CalendarInterval: types.CalendarInterval{Unit: types.CalendarMonth, Count: 1}},
+					RolledUp:      timeUtils.Range{From: hour(2), To: hour(4)},
+				},
+				{
+					RollUpSetting: types.RollUpSetting{After: time.Hour, Interval: time.Minute},
+					RolledUp:      timeUtils.Range{From: hour(2), To: hour(8)},
+				},
+			},
+			r: timeUtils.Range{From: hour(0), To: hour(10)},
+			want: []ResolutionSegment{
+				{TimeRange: TimeRange{From: hour(0), To: hour(2)}},
+				{TimeRange: TimeRange{From: hour(2), To: hour(4)}, CalendarInterval: types.CalendarInterval{Unit: types.CalendarMonth, Count: 1}},
+				{TimeRange: TimeRange{From: hour(4), To: hour(8)}, Interval: time.Minute},
+				{TimeRange: TimeRange{From: hour(8), To: hour(10)}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, buildResolutionSegments(tt.levels, tt.r))
+		})
+	}
+}
+
+func TestResolutionQuery(t *testing.T) {
+	t.Parallel()
+
+	var (
+		from = time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+		mid  = time.Date(2025, time.January, 2, 0, 0, 0, 0, time.UTC)
+		to   = time.Date(2025, time.January, 3, 0, 0, 0, 0, time.UTC)
+
+		testOpts = ResolutionQueryOptions{
+			Database:   "test_database",
+			Table:      "test_table",
+			TimeColumn: "test_time",
+			Value:      "sum(hits)",
+			Step:       time.Minute,
+		}
+	)
+
+	tests := []struct {
+		name     string
+		segments []ResolutionSegment
+		opts     ResolutionQueryOptions
+		want     string
+		wantArgs []any
+		wantErr  bool
+	}{
+		{
+			name: "Ok",
+			segments: []ResolutionSegment{
+				{TimeRange: TimeRange{From: from, To: mid}, Interval: time.Hour},
+				{TimeRange: TimeRange{From: mid, To: to}},
+			},
+			opts:     testOpts,
+			want:     `SELECT * FROM (SELECT toStartOfInterval("test_table"."test_time", INTERVAL 3600 SECOND) AS time, sum(hits) AS value FROM "test_database"."test_table" WHERE "test_table"."test_time" >= ? AND "test_table"."test_time" < ? GROUP BY time UNION ALL SELECT toStartOfInterval("test_table"."test_time", INTERVAL 60 SECOND) AS time, sum(hits) AS value FROM "test_database"."test_table" WHERE "test_table"."test_time" >= ? AND "test_table"."test_time" < ? GROUP BY time) ORDER BY time`,
+			wantArgs: []any{from, mid, mid, to},
+		},
+		{
+			name: "Ok rate",
+			segments: []ResolutionSegment{
+				{TimeRange: TimeRange{From: from, To: to}, Interval: time.Hour},
+			},
+			opts: func() ResolutionQueryOptions {
+				opts := testOpts
+				opts.Rate = true
+				opts.Where = "service = 'api'"
+
+				return opts
+			}(),
+			want:     `SELECT * FROM (SELECT toStartOfInterval("test_table"."test_time", INTERVAL 3600 SECOND) AS time, (sum(hits)) / 3600 AS value FROM "test_database"."test_table" WHERE "test_table"."test_time" >= ? AND "test_table"."test_time" < ? AND (service = 'api') GROUP BY time) ORDER BY time`,
+			wantArgs: []any{from, to},
+		},
+		{
+			name: "Step is rounded up to interval",
+			segments: []ResolutionSegment{
+				{TimeRange: TimeRange{From: from, To: to}, Interval: time.Minute},
+			},
+			opts: func() ResolutionQueryOptions {
+				opts := testOpts
+				opts.Step = 90 * time.Second
+
+				return opts
+			}(),
+			want:     `SELECT * FROM (SELECT toStartOfInterval("test_table"."test_time", INTERVAL 120 SECOND) AS time, sum(hits) AS value FROM "test_database"."test_table" WHERE "test_table"."test_time" >= ? AND "test_table"."test_time" < ? GROUP BY time) ORDER BY time`,
+			wantArgs: []any{from, to},
+		},
+		{
+			name: "Step over Date column is at least a day",
+			segments: []ResolutionSegment{
+				{TimeRange: TimeRange{From: from, To: to}},
+			},
+			opts: func() ResolutionQueryOptions {
+				opts := testOpts
+				opts.TimeColumnType = types.TimeColumnDate
+				opts.Step = time.Hour
+
+				return opts
+			}(),
+			want:     `SELECT * FROM (SELECT toStartOfInterval("test_table"."test_time", INTERVAL 1 DAY) AS time, sum(hits) AS value FROM "test_database"."test_table" WHERE "test_table"."test_time" >= ? AND "test_table"."test_time" < ? GROUP BY time) ORDER BY time`,
+			wantArgs: []any{from.Format(time.DateOnly), to.Format(time.DateOnly)},
+		},
+		{
+			name: "Raw segment without step",
+			segments: []ResolutionSegment{
+				{TimeRange: TimeRange{From: from, To: to}},
+			},
+			opts: func() ResolutionQueryOptions {
+				opts := testOpts
+				opts.Step = 0
+
+				return opts
+			}(),
+			wantErr: true,
+		},
+		{
+			name:    "Without segments",
+			opts:    testOpts,
+			wantErr: true,
+		},
+		{
+			name: "Bad value",
+			segments: []ResolutionSegment{
+				{TimeRange: TimeRange{From: from, To: to}},
+			},
+			opts: func() ResolutionQueryOptions {
+				opts := testOpts
+				opts.Value = "sum(hits) FROM other_table"
+
+				return opts
+			}(),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, gotArgs, err := ResolutionQuery(tt.segments, tt.opts)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantArgs, gotArgs)
+		})
+	}
+}
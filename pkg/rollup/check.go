@@ -0,0 +1,149 @@
+// Copyright 2025 LLC "Ozon Technologies".
+// SPDX-License-Identifier: Apache-2.0
+
+package rollup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/huandu/go-sqlbuilder"
+
+	sliceUtils "github.com/ozontech/ch-rollup/internal/utils/slice"
+	sqlUtils "github.com/ozontech/ch-rollup/internal/utils/sql"
+	timeUtils "github.com/ozontech/ch-rollup/internal/utils/time"
+	"github.com/ozontech/ch-rollup/pkg/database"
+	"github.com/ozontech/ch-rollup/pkg/types"
+)
+
+// ErrCheckFailed is returned by Run when rolled up data doesn't pass checks.
+// Origin data stays untouched in this case.
+var ErrCheckFailed = errors.New("check failed")
+
+// CheckResult is a calculated values of the check.
+type CheckResult struct {
+	Name   string
+	Source float64
+	Target float64
+}
+
+func (r CheckResult) passed(tolerance float64) bool {
+	return math.Abs(r.Source-r.Target) <= tolerance*math.Abs(r.Source)
+}
+
+// verifyOnShard runs checks of rolled up data at temp table against origin data of the window.
+func verifyOnShard(ctx context.Context, shard database.Shard, opts RunOptions, window timeUtils.Range, report *ShardReport) error {
+	if len(opts.Checks) == 0 && !opts.CheckTimeBounds {
+		return nil
+	}
+
+	defer report.measure(StageVerify)()
+
+	if opts.CheckTimeBounds {
+		if err := checkTimeBoundsOnShard(ctx, shard, opts, window); err != nil {
+			return err
+		}
+	}
+
+	if len(opts.Checks) == 0 {
+		return nil
+	}
+
+	results, err := calculateChecksOnShard(ctx, shard, opts, window)
+	if err != nil {
+		return err
+	}
+
+	report.Checks = results
+
+	for i, result := range results {
+		if !result.passed(opts.Checks[i].Tolerance) {
+			return fmt.Errorf("%w: '%s': source %v, target %v", ErrCheckFailed, result.Name, result.Source, result.Target)
+		}
+	}
+
+	return nil
+}
+
+func checkTimeBoundsOnShard(ctx context.Context, shard database.Shard, opts RunOptions, window timeUtils.Range) error {
+	timeColumn := sqlUtils.QuotedEntity(getTimeColumnName(opts.Columns))
+	from, to := timeColumnRange(window, opts)
+
+	sb := sqlbuilder.NewSelectBuilder()
+	sb.Select("count()")
+	sb.From(sqlUtils.QuotedDatabaseEntity(opts.targetDatabase(), opts.TempTable))
+	sb.Where(
+		sb.Or(
+			sb.LessThan(timeColumn, from),
+			sb.GreaterEqualThan(timeColumn, to),
+		),
+	)
+
+	sql, args := sb.BuildWithFlavor(sqlbuilder.ClickHouse)
+
+	var outOfWindow uint64
+	if err := shard.QueryRow(ctx, sql, args...).Scan(&outOfWindow); err != nil {
+		return fmt.Errorf("failed to check time bounds of %s.%s: %w", opts.targetDatabase(), opts.TempTable, err)
+	}
+
+	if outOfWindow > 0 {
+		return fmt.Errorf("%w: %d rolled up rows are out of window [%s, %s)", ErrCheckFailed, outOfWindow, window.From, window.To)
+	}
+
+	return nil
+}
+
+func calculateChecksOnShard(ctx context.Context, shard database.Shard, opts RunOptions, window timeUtils.Range) ([]CheckResult, error) {
+	results := sliceUtils.ConvertFunc(opts.Checks, func(check types.Check) CheckResult {
+		return CheckResult{
+			Name: check.Name,
+		}
+	})
+
+	sourceValues := make([]any, 0, len(results))
+	targetValues := make([]any, 0, len(results))
+
+	for i := range results {
+		sourceValues = append(sourceValues, &results[i].Source)
+		targetValues = append(targetValues, &results[i].Target)
+	}
+
+	sb := newCheckSelectBuilder(opts.Checks, func(check types.Check) string {
+		return check.Source
+	})
+	sb.From(sqlUtils.QuotedDatabaseEntity(opts.Database, opts.Table))
+	sb.Where(generateTimeRangeConditions(sb, opts.Table, opts.Columns, opts.location, timeRangeArgs(window, opts))...)
+
+	sql, args := sb.BuildWithFlavor(sqlbuilder.ClickHouse)
+
+	if err := shard.QueryRow(ctx, sql, args...).Scan(sourceValues...); err != nil {
+		return nil, fmt.Errorf("failed to calculate checks on %s.%s: %w", opts.Database, opts.Table, err)
+	}
+
+	sb = newCheckSelectBuilder(opts.Checks, func(check types.Check) string {
+		if check.Target == "" {
+			return check.Source
+		}
+
+		return check.Target
+	})
+	sb.From(sqlUtils.QuotedDatabaseEntity(opts.targetDatabase(), opts.TempTable))
+
+	sql, args = sb.BuildWithFlavor(sqlbuilder.ClickHouse)
+
+	if err := shard.QueryRow(ctx, sql, args...).Scan(targetValues...); err != nil {
+		return nil, fmt.Errorf("failed to calculate checks on %s.%s: %w", opts.targetDatabase(), opts.TempTable, err)
+	}
+
+	return results, nil
+}
+
+func newCheckSelectBuilder(checks []types.Check, expression func(check types.Check) string) *sqlbuilder.SelectBuilder {
+	return sqlbuilder.NewSelectBuilder().Select(
+		sliceUtils.ConvertFunc(checks, func(check types.Check) string {
+			return fmt.Sprintf("toFloat64(%s)", expression(check))
+		})...,
+	)
+}
@@ -0,0 +1,183 @@
+// Copyright 2025 LLC "Ozon Technologies".
+// SPDX-License-Identifier: Apache-2.0
+
+package rollup
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	timeUtils "github.com/ozontech/ch-rollup/internal/utils/time"
+	"github.com/ozontech/ch-rollup/pkg/database/mock"
+	"github.com/ozontech/ch-rollup/pkg/types"
+)
+
+func Test_verifyOnShard(t *testing.T) {
+	t.Parallel()
+
+	const (
+		testDatabase  = "test_database"
+		testTable     = "test_table"
+		testTempTable = "test_temp_table"
+
+		sourceQuery     = `SELECT toFloat64(count()), toFloat64(sum(value)) FROM "test_database"."test_table" WHERE "test_table"."test_time" >= ? AND "test_table"."test_time" < ?`
+		targetQuery     = `SELECT toFloat64(countMerge(counter)), toFloat64(sum(value)) FROM "test_database"."test_temp_table"`
+		timeBoundsQuery = `SELECT count() FROM "test_database"."test_temp_table" WHERE ("test_time" < ? OR "test_time" >= ?)`
+	)
+
+	var (
+		errTest = errors.New("test")
+
+		testWindow = timeUtils.Range{
+			From: time.Date(2024, time.June, 23, 0, 0, 0, 0, time.UTC),
+			To:   time.Date(2024, time.June, 24, 0, 0, 0, 0, time.UTC),
+		}
+
+		testColumns = []types.ColumnSetting{
+			{
+				Name:       "counter",
+				Expression: "countMergeState(counter)",
+			},
+			{
+				Name: "value",
+			},
+			{
+				Name:         "test_time",
+				IsRollUpTime: true,
+			},
+		}
+
+		testChecks = []types.Check{
+			{
+				Name:   "rows",
+				Source: "count()",
+				Target: "countMerge(counter)",
+			},
+			{
+				Name:      "value",
+				Source:    "sum(value)",
+				Tolerance: 0.01,
+			},
+		}
+	)
+
+	expectValues := func(ctrl *gomock.Controller, shard *mock.MockShard, query string, values []float64, args ...any) {
+		rowMock := mock.NewMockRow(ctrl)
+		rowMock.EXPECT().Scan(gomock.Any()).DoAndReturn(func(dest ...any) error {
+			for i, value := range values {
+				*dest[i].(*float64) = value
+			}
+
+			return nil
+		})
+
+		shard.EXPECT().QueryRow(gomock.Any(), query, args...).Return(rowMock)
+	}
+
+	tests := []struct {
+		name            string
+		prepareMock     func(ctrl *gomock.Controller, shard *mock.MockShard)
+		checks          []types.Check
+		checkTimeBounds bool
+		want            []CheckResult
+		wantErr         error
+	}{
+		{
+			name:        "No checks",
+			prepareMock: func(_ *gomock.Controller, _ *mock.MockShard) {},
+		},
+		{
+			name: "Ok",
+			prepareMock: func(ctrl *gomock.Controller, shard *mock.MockShard) {
+				expectValues(ctrl, shard, sourceQuery, []float64{1440, 100}, testWindow.From, testWindow.To)
+				expectValues(ctrl, shard, targetQuery, []float64{1440, 100.5})
+			},
+			checks: testChecks,
+			want: []CheckResult{
+				{Name: "rows", Source: 1440, Target: 1440},
+				{Name: "value", Source: 100, Target: 100.5},
+			},
+		},
+		{
+			name: "Check failed",
+			prepareMock: func(ctrl *gomock.Controller, shard *mock.MockShard) {
+				expectValues(ctrl, shard, sourceQuery, []float64{1440, 100}, testWindow.From, testWindow.To)
+				expectValues(ctrl, shard, targetQuery, []float64{1380, 100})
+			},
+			checks: testChecks,
+			want: []CheckResult{
+				{Name: "rows", Source: 1440, Target: 1380},
+				{Name: "value", Source: 100, Target: 100},
+			},
+			wantErr: ErrCheckFailed,
+		},
+		{
+			name: "Failed to calculate source",
+			prepareMock: func(ctrl *gomock.Controller, shard *mock.MockShard) {
+				rowMock := mock.NewMockRow(ctrl)
+				rowMock.EXPECT().Scan(gomock.Any(), gomock.Any()).Return(errTest)
+
+				shard.EXPECT().QueryRow(gomock.Any(), sourceQuery, testWindow.From, testWindow.To).Return(rowMock)
+			},
+			checks:  testChecks,
+			wantErr: errTest,
+		},
+		{
+			name: "Time bounds ok",
+			prepareMock: func(ctrl *gomock.Controller, shard *mock.MockShard) {
+				rowMock := mock.NewMockRow(ctrl)
+				rowMock.EXPECT().Scan(gomock.Any()).SetArg(0, uint64(0))
+
+				shard.EXPECT().QueryRow(gomock.Any(), timeBoundsQuery, testWindow.From, testWindow.To).Return(rowMock)
+			},
+			checkTimeBounds: true,
+		},
+		{
+			name: "Time bounds failed",
+			prepareMock: func(ctrl *gomock.Controller, shard *mock.MockShard) {
+				rowMock := mock.NewMockRow(ctrl)
+				rowMock.EXPECT().Scan(gomock.Any()).SetArg(0, uint64(2))
+
+				shard.EXPECT().QueryRow(gomock.Any(), timeBoundsQuery, testWindow.From, testWindow.To).Return(rowMock)
+			},
+			checks:          testChecks,
+			checkTimeBounds: true,
+			wantErr:         ErrCheckFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctrl := gomock.NewController(t)
+
+			shardMock := mock.NewMockShard(ctrl)
+			tt.prepareMock(ctrl, shardMock)
+
+			report := newShardReport("test-shard")
+
+			err := verifyOnShard(
+				context.Background(),
+				shardMock,
+				RunOptions{
+					Database:        testDatabase,
+					Table:           testTable,
+					TempTable:       testTempTable,
+					Columns:         testColumns,
+					Checks:          tt.checks,
+					CheckTimeBounds: tt.checkTimeBounds,
+				},
+				testWindow,
+				&report,
+			)
+
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, tt.want, report.Checks)
+		})
+	}
+}
@@ -0,0 +1,305 @@
+// Copyright 2025 LLC "Ozon Technologies".
+// SPDX-License-Identifier: Apache-2.0
+
+package rollup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/huandu/go-sqlbuilder"
+
+	sliceUtils "github.com/ozontech/ch-rollup/internal/utils/slice"
+	sqlUtils "github.com/ozontech/ch-rollup/internal/utils/sql"
+	"github.com/ozontech/ch-rollup/pkg/database"
+	"github.com/ozontech/ch-rollup/pkg/types"
+)
+
+var (
+	errAutoTimeColumnNotFound = errors.New("time column not found at sorting key, set isRollUpTime at columns")
+	errUnknownColumn          = errors.New("column not found at the table or it can't be inserted")
+	errUnresolvedColumn       = errors.New("column is neither at sorting key nor aggregate function, set it at columns")
+)
+
+// aggregateFunctionTypeRegexp matches AggregateFunction(f, T...) and SimpleAggregateFunction(f, T) types.
+var aggregateFunctionTypeRegexp = regexp.MustCompile(`^(AggregateFunction|SimpleAggregateFunction)\((.+)\)$`)
+
+// tableColumn is a column of the table.
+type tableColumn struct {
+	Name        string
+	Type        string
+	DefaultKind string
+}
+
+// insertable reports whether value of the column can be inserted.
+// MATERIALIZED, ALIAS and EPHEMERAL columns are calculated by the table.
+func (c tableColumn) insertable() bool {
+	return c.DefaultKind == "" || c.DefaultKind == "DEFAULT"
+}
+
+// insertableColumnNames returns names of columns that can be inserted to the table.
+func insertableColumnNames(columns []tableColumn) []string {
+	return sliceUtils.ConvertFuncWithSkip(columns, func(column tableColumn) (string, bool) {
+		return column.Name, column.insertable()
+	})
+}
+
+// resolveColumns sets RunOptions.Columns by schema of target table, if RunOptions.AutoColumns is set.
+// Configured columns override generated ones.
+func resolveColumns(ctx context.Context, shard database.Shard, opts *RunOptions) error {
+	if !opts.AutoColumns {
+		return nil
+	}
+
+	targetDatabase, targetTable := opts.targetDatabase(), opts.targetTable()
+
+	sortingKey, err := getSortingKeyOnShard(ctx, shard, targetDatabase, targetTable)
+	if err != nil {
+		return fmt.Errorf("failed to get sorting key of %s.%s: %w", targetDatabase, targetTable, err)
+	}
+
+	columns, err := getTableColumnsOnShard(ctx, shard, targetDatabase, targetTable)
+	if err != nil {
+		return fmt.Errorf("failed to get columns of %s.%s: %w", targetDatabase, targetTable, err)
+	}
+
+	sourceColumns := columns
+	if !opts.inPlace() {
+		if sourceColumns, err = getTableColumnsOnShard(ctx, shard, opts.Database, opts.Table); err != nil {
+			return fmt.Errorf("failed to get columns of %s.%s: %w", opts.Database, opts.Table, err)
+		}
+	}
+
+	overrides := opts.Columns
+	if opts.ResolutionColumn != "" {
+		// Resolution column is filled by roll up, so it's excluded from generated columns.
+		overrides = append(slices.Clone(overrides), types.ColumnSetting{Name: opts.ResolutionColumn, IsReset: true})
+	}
+
+	result, err := generateAutoColumns(columns, sourceColumns, keyColumnNames(sortingKey), overrides)
+	if err != nil {
+		return fmt.Errorf("failed to generate columns of %s.%s: %w", targetDatabase, targetTable, err)
+	}
+
+	result = slices.DeleteFunc(result, func(column types.ColumnSetting) bool { return column.Name == opts.ResolutionColumn })
+
+	for _, column := range result {
+		if err = column.Validate(); err != nil {
+			return fmt.Errorf("failed to validate column '%s': %w", column.Name, err)
+		}
+	}
+
+	opts.Columns = result
+
+	return nil
+}
+
+func getSortingKeyOnShard(ctx context.Context, shard database.Shard, databaseName, table string) (string, error) {
+	var sortingKey string
+
+	err := shard.QueryRow(
+		ctx,
+		"SELECT sorting_key FROM system.tables WHERE database = ? AND name = ?",
+		databaseName,
+		table,
+	).Scan(&sortingKey)
+	if err != nil {
+		return "", err
+	}
+
+	return sortingKey, nil
+}
+
+// getTableColumnsOnShard returns columns of the table in order of the table.
+func getTableColumnsOnShard(ctx context.Context, shard database.Shard, databaseName, table string) ([]tableColumn, error) {
+	sb := sqlbuilder.NewSelectBuilder().From("system.columns")
+
+	sb.Select("name", "type", "default_kind")
+	sb.Where(
+		sb.Equal("database", databaseName),
+		sb.Equal("table", table),
+	)
+	sb.OrderBy("position")
+
+	sql, args := sb.BuildWithFlavor(sqlbuilder.ClickHouse)
+
+	rows, err := shard.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var result []tableColumn
+
+	for rows.Next() {
+		var column tableColumn
+
+		if err = rows.Scan(&column.Name, &column.Type, &column.DefaultKind); err != nil {
+			return nil, err
+		}
+
+		result = append(result, column)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// generateAutoColumns returns column settings of the table columns:
+// key columns are grouped by, aggregate function columns are merged and time column is the first time column of the key.
+// Source columns define whether aggregate function states are merged or calculated from plain values.
+func generateAutoColumns(columns, sourceColumns []tableColumn, keyColumns []string, overrides []types.ColumnSetting) ([]types.ColumnSetting, error) {
+	overridden := make(map[string]types.ColumnSetting, len(overrides))
+	for _, column := range overrides {
+		overridden[column.Name] = column
+	}
+
+	sourceTypes := make(map[string]string, len(sourceColumns))
+	for _, column := range sourceColumns {
+		sourceTypes[column.Name] = column.Type
+	}
+
+	timeColumnName := getTimeColumnName(overrides)
+	if timeColumnName == "" {
+		timeColumnName = findKeyTimeColumn(columns, keyColumns)
+	}
+
+	if timeColumnName == "" {
+		return nil, errAutoTimeColumnNotFound
+	}
+
+	result := make([]types.ColumnSetting, 0, len(columns))
+
+	for _, column := range columns {
+		if !column.insertable() {
+			continue
+		}
+
+		if setting, ok := overridden[column.Name]; ok {
+			result = append(result, setting)
+			delete(overridden, column.Name)
+
+			continue
+		}
+
+		switch {
+		case column.Name == timeColumnName:
+			result = append(result, types.ColumnSetting{Name: column.Name, IsRollUpTime: true})
+		case slices.Contains(keyColumns, column.Name):
+			result = append(result, types.ColumnSetting{Name: column.Name})
+		default:
+			expression, ok := aggregateColumnExpression(column.Name, column.Type, sourceTypes[column.Name])
+			if !ok {
+				return nil, fmt.Errorf("%w: '%s' of type '%s'", errUnresolvedColumn, column.Name, column.Type)
+			}
+
+			result = append(result, types.ColumnSetting{Name: column.Name, Expression: expression})
+		}
+	}
+
+	for _, column := range overrides {
+		if _, ok := overridden[column.Name]; ok {
+			return nil, fmt.Errorf("%w: '%s'", errUnknownColumn, column.Name)
+		}
+	}
+
+	return result, nil
+}
+
+// findKeyTimeColumn returns the first key column of DateTime, DateTime64 or Date type.
+// Unix time columns can't be told apart from numbers, so they must be configured.
+func findKeyTimeColumn(columns []tableColumn, keyColumns []string) string {
+	for _, key := range keyColumns {
+		index := slices.IndexFunc(columns, func(column tableColumn) bool { return column.Name == key })
+		if index < 0 {
+			continue
+		}
+
+		switch timeColumnType, _ := parseTimeColumnType(columns[index].Type); timeColumnType {
+		case types.TimeColumnDateTime, types.TimeColumnDateTime64, types.TimeColumnDate:
+			return key
+		}
+	}
+
+	return ""
+}
+
+// aggregateColumnExpression returns roll up expression of AggregateFunction or SimpleAggregateFunction column.
+// AggregateFunction states are merged, if source column has the same type, otherwise they are calculated from source values.
+func aggregateColumnExpression(name, columnType, sourceType string) (string, bool) {
+	kind, function, ok := columnAggregateFunction(columnType)
+	if !ok {
+		return "", false
+	}
+
+	// Parametric functions like quantiles(0.5, 0.9) keep parameters after combinator.
+	parameters := ""
+	if call := functionCallRegexp.FindStringSubmatch(function); call != nil {
+		function, parameters = call[1], "("+call[2]+")"
+	}
+
+	if kind == "SimpleAggregateFunction" {
+		return fmt.Sprintf("%s%s(%s)", function, parameters, sqlUtils.QuotedEntity(name)), true
+	}
+
+	combinator := "State"
+	if sourceType == columnType {
+		combinator = "MergeState"
+	}
+
+	return fmt.Sprintf("%s%s%s(%s)", function, combinator, parameters, sqlUtils.QuotedEntity(name)), true
+}
+
+// columnAggregateFunction returns kind of AggregateFunction or SimpleAggregateFunction column type
+// and its function with parameters, like quantiles(0.5, 0.9).
+func columnAggregateFunction(columnType string) (string, string, bool) {
+	match := aggregateFunctionTypeRegexp.FindStringSubmatch(columnType)
+	if match == nil {
+		return "", "", false
+	}
+
+	args := splitTopLevel(match[2])
+	if len(args) > 1 {
+		// Version of aggregate function state can precede the function.
+		if _, err := strconv.Atoi(args[0]); err == nil {
+			args = args[1:]
+		}
+	}
+
+	return match[1], args[0], true
+}
+
+// keyColumnNames returns names of columns used by sorting key expression in order of appearance.
+func keyColumnNames(expression string) []string {
+	var result []string
+
+	for _, element := range splitTopLevel(strings.TrimSpace(expression)) {
+		if call := functionCallRegexp.FindStringSubmatch(element); call != nil {
+			for _, name := range keyColumnNames(call[2]) {
+				if !slices.Contains(result, name) {
+					result = append(result, name)
+				}
+			}
+
+			continue
+		}
+
+		name := unquoteIdentifier(element)
+		if sqlUtils.ValidateEntityName(name) == nil && !slices.Contains(result, name) {
+			result = append(result, name)
+		}
+	}
+
+	return result
+}
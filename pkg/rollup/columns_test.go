@@ -0,0 +1,243 @@
+// Copyright 2025 LLC "Ozon Technologies".
+// SPDX-License-Identifier: Apache-2.0
+
+package rollup
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	"github.com/ozontech/ch-rollup/pkg/database/mock"
+	"github.com/ozontech/ch-rollup/pkg/types"
+)
+
+func Test_keyColumnNames(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		expression string
+		want       []string
+	}{
+		{
+			name:       "Columns",
+			expression: "service, event_time",
+			want:       []string{"service", "event_time"},
+		},
+		{
+			name:       "Functions",
+			expression: "(`service`, toStartOfHour(event_time, 'UTC'), service)",
+			want:       []string{"service", "event_time"},
+		},
+		{
+			name:       "Empty",
+			expression: "tuple()",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, keyColumnNames(tt.expression))
+		})
+	}
+}
+
+func Test_generateAutoColumns(t *testing.T) {
+	t.Parallel()
+
+	testColumns := []tableColumn{
+		{Name: "service", Type: "LowCardinality(String)"},
+		{Name: "event_date", Type: "Date"},
+		{Name: "event_time", Type: "DateTime('UTC')"},
+		{Name: "hits", Type: "AggregateFunction(count)"},
+		{Name: "latency", Type: "AggregateFunction(quantiles(0.5, 0.9), Float64)"},
+		{Name: "bytes", Type: "SimpleAggregateFunction(sum, UInt64)"},
+		{Name: "hour", Type: "UInt8", DefaultKind: "MATERIALIZED"},
+	}
+
+	tests := []struct {
+		name          string
+		sourceColumns []tableColumn
+		keyColumns    []string
+		overrides     []types.ColumnSetting
+		want          []types.ColumnSetting
+		wantErr       error
+	}{
+		{
+			name:       "Ok",
+			keyColumns: []string{"service", "event_time"},
+			overrides: []types.ColumnSetting{
+				{Name: "event_date", DerivedFromTime: "toDate"},
+			},
+			want: []types.ColumnSetting{
+				{Name: "service"},
+				{Name: "event_date", DerivedFromTime: "toDate"},
+				{Name: "event_time", IsRollUpTime: true},
+				{Name: "hits", Expression: `countMergeState("hits")`},
+				{Name: "latency", Expression: `quantilesMergeState(0.5, 0.9)("latency")`},
+				{Name: "bytes", Expression: `sum("bytes")`},
+			},
+		},
+		{
+			name: "Plain source columns",
+			sourceColumns: []tableColumn{
+				{Name: "hits", Type: "UInt64"},
+				{Name: "latency", Type: "Float64"},
+				{Name: "bytes", Type: "UInt64"},
+			},
+			keyColumns: []string{"service", "event_date", "event_time"},
+			overrides: []types.ColumnSetting{
+				{Name: "event_time", IsRollUpTime: true},
+			},
+			want: []types.ColumnSetting{
+				{Name: "service"},
+				{Name: "event_date"},
+				{Name: "event_time", IsRollUpTime: true},
+				{Name: "hits", Expression: `countState("hits")`},
+				{Name: "latency", Expression: `quantilesState(0.5, 0.9)("latency")`},
+				{Name: "bytes", Expression: `sum("bytes")`},
+			},
+		},
+		{
+			name:       "Time column not found",
+			keyColumns: []string{"service"},
+			wantErr:    errAutoTimeColumnNotFound,
+		},
+		{
+			name:       "Unresolved column",
+			keyColumns: []string{"event_time"},
+			wantErr:    errUnresolvedColumn,
+		},
+		{
+			name:       "Unknown column",
+			keyColumns: []string{"service", "event_date", "event_time"},
+			overrides: []types.ColumnSetting{
+				{Name: "unknown", Expression: "any(unknown)"},
+			},
+			wantErr: errUnknownColumn,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			sourceColumns := tt.sourceColumns
+			if sourceColumns == nil {
+				sourceColumns = testColumns
+			}
+
+			got, err := generateAutoColumns(testColumns, sourceColumns, tt.keyColumns, tt.overrides)
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// scanTableColumn fills name and type of tableColumn at Rows.Scan.
+func scanTableColumn(name, columnType string) func(dest ...any) error {
+	return func(dest ...any) error {
+		*dest[0].(*string) = name
+		*dest[1].(*string) = columnType
+		*dest[2].(*string) = ""
+
+		return nil
+	}
+}
+
+func Test_resolveColumns(t *testing.T) {
+	t.Parallel()
+
+	const (
+		testDatabase = "test_database"
+		testTable    = "test_table"
+
+		columnsQuery = "SELECT name, type, default_kind FROM system.columns WHERE database = ? AND table = ? ORDER BY position"
+	)
+
+	tests := []struct {
+		name        string
+		prepareMock func(ctrl *gomock.Controller, shard *mock.MockShard)
+		want        []types.ColumnSetting
+		wantErr     bool
+	}{
+		{
+			name: "Ok",
+			prepareMock: func(ctrl *gomock.Controller, shard *mock.MockShard) {
+				rowMock := mock.NewMockRow(ctrl)
+				rowMock.EXPECT().Scan(gomock.Any()).SetArg(0, "service, event_time")
+
+				rowsMock := mock.NewMockRows(ctrl)
+
+				gomock.InOrder(
+					rowsMock.EXPECT().Next().Return(true),
+					rowsMock.EXPECT().Scan(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(scanTableColumn("service", "String")),
+					rowsMock.EXPECT().Next().Return(true),
+					rowsMock.EXPECT().Scan(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(scanTableColumn("event_time", "DateTime")),
+					rowsMock.EXPECT().Next().Return(true),
+					rowsMock.EXPECT().Scan(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(scanTableColumn("hits", "AggregateFunction(count)")),
+					rowsMock.EXPECT().Next(),
+				)
+				rowsMock.EXPECT().Err()
+				rowsMock.EXPECT().Close()
+
+				gomock.InOrder(
+					shard.EXPECT().QueryRow(gomock.Any(), "SELECT sorting_key FROM system.tables WHERE database = ? AND name = ?", testDatabase, testTable).Return(rowMock),
+					shard.EXPECT().Query(gomock.Any(), columnsQuery, testDatabase, testTable).Return(rowsMock, nil),
+				)
+			},
+			want: []types.ColumnSetting{
+				{Name: "service"},
+				{Name: "event_time", IsRollUpTime: true},
+				{Name: "hits", Expression: `countMergeState("hits")`},
+			},
+		},
+		{
+			name: "Failed to get columns",
+			prepareMock: func(ctrl *gomock.Controller, shard *mock.MockShard) {
+				rowMock := mock.NewMockRow(ctrl)
+				rowMock.EXPECT().Scan(gomock.Any()).SetArg(0, "service, event_time")
+
+				shard.EXPECT().QueryRow(gomock.Any(), "SELECT sorting_key FROM system.tables WHERE database = ? AND name = ?", testDatabase, testTable).Return(rowMock)
+				shard.EXPECT().Query(gomock.Any(), columnsQuery, testDatabase, testTable).Return(nil, errors.New("test"))
+			},
+			wantErr: true,
+		},
+		{
+			name: "Failed to get sorting key",
+			prepareMock: func(ctrl *gomock.Controller, shard *mock.MockShard) {
+				rowMock := mock.NewMockRow(ctrl)
+				rowMock.EXPECT().Scan(gomock.Any()).Return(errors.New("test"))
+
+				shard.EXPECT().QueryRow(gomock.Any(), "SELECT sorting_key FROM system.tables WHERE database = ? AND name = ?", testDatabase, testTable).Return(rowMock)
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctrl := gomock.NewController(t)
+
+			shardMock := mock.NewMockShard(ctrl)
+			tt.prepareMock(ctrl, shardMock)
+
+			opts := RunOptions{
+				Database:    testDatabase,
+				Table:       testTable,
+				AutoColumns: true,
+			}
+
+			err := resolveColumns(context.Background(), shardMock, &opts)
+			assert.Equal(t, tt.wantErr, err != nil)
+
+			if !tt.wantErr {
+				assert.Equal(t, tt.want, opts.Columns)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2025 LLC "Ozon Technologies".
+// SPDX-License-Identifier: Apache-2.0
+
+package rollup
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ShardError is an error of roll up on the shard.
+type ShardError struct {
+	Shard string
+	Err   error
+}
+
+func (e ShardError) Error() string {
+	return fmt.Sprintf("failed to run roll up on %s: %s", e.Shard, e.Err.Error())
+}
+
+func (e ShardError) Unwrap() error {
+	return e.Err
+}
+
+// ShardErrors contains errors of all failed shards.
+// It's returned by Run with RunOptions.ContinueOnShardError.
+type ShardErrors []ShardError
+
+func (e ShardErrors) Error() string {
+	messages := make([]string, 0, len(e))
+
+	for _, shardError := range e {
+		messages = append(messages, shardError.Error())
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+func (e ShardErrors) Unwrap() []error {
+	result := make([]error, 0, len(e))
+
+	for _, shardError := range e {
+		result = append(result, shardError)
+	}
+
+	return result
+}
+
+// Shard returns error of the shard with name or nil if the shard wasn't failed.
+func (e ShardErrors) Shard(name string) error {
+	for _, shardError := range e {
+		if shardError.Shard == name {
+			return shardError.Err
+		}
+	}
+
+	return nil
+}
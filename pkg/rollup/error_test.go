@@ -0,0 +1,52 @@
+// Copyright 2025 LLC "Ozon Technologies".
+// SPDX-License-Identifier: Apache-2.0
+
+package rollup
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShardError(t *testing.T) {
+	t.Parallel()
+
+	testErr := errors.New("test error")
+	shardErr := ShardError{
+		Shard: "test-shard",
+		Err:   testErr,
+	}
+
+	assert.Equal(t, "failed to run roll up on test-shard: test error", shardErr.Error())
+	assert.Equal(t, true, errors.Is(shardErr, testErr))
+}
+
+func TestShardErrors(t *testing.T) {
+	t.Parallel()
+
+	firstErr := errors.New("first error")
+	secondErr := errors.New("second error")
+
+	shardErrors := ShardErrors{
+		{
+			Shard: "first-shard",
+			Err:   firstErr,
+		},
+		{
+			Shard: "second-shard",
+			Err:   secondErr,
+		},
+	}
+
+	assert.Equal(t, "failed to run roll up on first-shard: first error; failed to run roll up on second-shard: second error", shardErrors.Error())
+	assert.Equal(t, true, errors.Is(shardErrors, firstErr))
+	assert.Equal(t, true, errors.Is(shardErrors, secondErr))
+	assert.Equal(t, secondErr, shardErrors.Shard("second-shard"))
+	assert.Nil(t, shardErrors.Shard("unknown-shard"))
+
+	var shardError ShardError
+	assert.Equal(t, true, errors.As(shardErrors, &shardError))
+	assert.Equal(t, "first-shard", shardError.Shard)
+}
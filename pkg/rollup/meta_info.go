@@ -5,12 +5,15 @@ package rollup
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"time"
 
 	"github.com/huandu/go-sqlbuilder"
 
 	timeUtils "github.com/ozontech/ch-rollup/internal/utils/time"
 	"github.com/ozontech/ch-rollup/pkg/database"
+	"github.com/ozontech/ch-rollup/pkg/types"
 )
 
 type metaInfo struct {
@@ -19,6 +22,8 @@ type metaInfo struct {
 	After     time.Duration
 	Interval  time.Duration
 	RollUpsAt time.Time
+	// CalendarInterval is saved with zero Interval.
+	CalendarInterval types.CalendarInterval
 }
 
 type metaInfoKey struct {
@@ -26,13 +31,70 @@ type metaInfoKey struct {
 	Table    string
 	After    time.Duration
 	Interval time.Duration
+	// CalendarInterval is set instead of Interval.
+	CalendarInterval types.CalendarInterval
+}
+
+// addMetaInfoCalendarColumn adds interval_calendar column to meta info table created by previous versions.
+const addMetaInfoCalendarColumn = "ALTER TABLE rollup_meta_info ADD COLUMN IF NOT EXISTS interval_calendar String"
+
+// migrateMetaInfoOnShard adds columns of calendar intervals to meta info table, if it exists.
+func migrateMetaInfoOnShard(ctx context.Context, shard database.Shard) error {
+	if err := shard.Exec(ctx, addMetaInfoCalendarColumn); err != nil && !isUnknownTable(err) {
+		return err
+	}
+
+	return nil
+}
+
+// hasMetaInfoCalendarColumnOnShard reports whether meta info table has column of calendar intervals.
+// Meta info table created by previous versions doesn't have it until migrateMetaInfoOnShard.
+func hasMetaInfoCalendarColumnOnShard(ctx context.Context, shard database.Shard) (bool, error) {
+	var count uint64
+
+	err := shard.QueryRow(
+		ctx,
+		"SELECT count() FROM system.columns WHERE database = currentDatabase() AND table = 'rollup_meta_info' AND name = 'interval_calendar'",
+	).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
 }
 
 func getLatestRollUpByKeyOnShard(ctx context.Context, shard database.Shard, key metaInfoKey) (time.Time, error) {
 	var rollUpsAt time.Time
 
+	sql, args := newMetaInfoSelectBuilder(key, "max(roll_ups_at)").BuildWithFlavor(sqlbuilder.ClickHouse)
+
+	err := shard.QueryRow(ctx, sql, args...).Scan(&rollUpsAt)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return rollUpsAt, nil
+}
+
+// getRolledUpRangeByKeyOnShard returns time range rolled up by the key: from the first saved roll up,
+// which is a starting point of roll ups, to the latest one.
+func getRolledUpRangeByKeyOnShard(ctx context.Context, shard database.Shard, key metaInfoKey) (timeUtils.Range, error) {
+	var result timeUtils.Range
+
+	sql, args := newMetaInfoSelectBuilder(key, "min(roll_ups_at)", "max(roll_ups_at)").BuildWithFlavor(sqlbuilder.ClickHouse)
+
+	err := shard.QueryRow(ctx, sql, args...).Scan(&result.From, &result.To)
+	if err != nil {
+		return timeUtils.Range{}, err
+	}
+
+	return result, nil
+}
+
+// newMetaInfoSelectBuilder returns select of aggregates of meta info of the key.
+func newMetaInfoSelectBuilder(key metaInfoKey, aggregates ...string) *sqlbuilder.SelectBuilder {
 	sb := sqlbuilder.NewSelectBuilder().From("rollup_meta_info")
-	sb.Select("max(roll_ups_at)")
+	sb.Select(aggregates...)
 	sb.Where(
 		sb.Equal("database", key.Database),
 		sb.Equal("table", key.Table),
@@ -41,28 +103,68 @@ func getLatestRollUpByKeyOnShard(ctx context.Context, shard database.Shard, key
 	)
 	sb.GroupBy("database", "table", "after_sec", "interval_sec")
 
-	sql, args := sb.BuildWithFlavor(sqlbuilder.ClickHouse)
-
-	err := shard.QueryRow(ctx, sql, args...).Scan(&rollUpsAt)
-	if err != nil {
-		return time.Time{}, err
+	if !key.CalendarInterval.IsZero() {
+		// Meta info of calendar intervals has zero interval_sec, so it doesn't mix with duration ones.
+		sb.Where(sb.Equal("interval_calendar", key.CalendarInterval.String()))
+		sb.GroupBy("interval_calendar")
 	}
 
-	return rollUpsAt, nil
+	return sb
+}
+
+// isMetaInfoNotFound reports whether err means that there was no roll up yet.
+func isMetaInfoNotFound(err error) bool {
+	return errors.Is(err, sql.ErrNoRows) || isUnknownTable(err)
 }
 
 func addMetaInfoOnShard(ctx context.Context, shard database.Shard, metaInfo metaInfo) error {
 	ib := sqlbuilder.NewInsertBuilder().InsertInto("rollup_meta_info")
-	ib.Cols("database", "table", "after_sec", "interval_sec", "roll_ups_at")
-	ib.Values(
+	cols := []string{"database", "table", "after_sec", "interval_sec", "roll_ups_at"}
+	values := []any{
 		metaInfo.Database,
 		metaInfo.Table,
 		timeUtils.SecondsFromDuration(metaInfo.After),
 		timeUtils.SecondsFromDuration(metaInfo.Interval),
 		metaInfo.RollUpsAt,
-	)
+	}
+
+	if !metaInfo.CalendarInterval.IsZero() {
+		cols = append(cols, "interval_calendar")
+		values = append(values, metaInfo.CalendarInterval.String())
+	}
+
+	ib.Cols(cols...)
+	ib.Values(values...)
 
 	sql, args := ib.BuildWithFlavor(sqlbuilder.ClickHouse)
 
 	return shard.Exec(ctx, sql, args...)
 }
+
+// deleteMetaInfoAfterOnShard deletes meta info of roll ups made after the time,
+// so next roll up starts from it.
+func deleteMetaInfoAfterOnShard(ctx context.Context, shard database.Shard, key metaInfoKey, after time.Time) error {
+	b := sqlbuilder.Build(
+		"ALTER TABLE rollup_meta_info DELETE WHERE database = $? AND table = $? AND after_sec = $? AND interval_sec = $? AND roll_ups_at > $? SETTINGS mutations_sync = 2",
+		key.Database,
+		key.Table,
+		timeUtils.SecondsFromDuration(key.After),
+		timeUtils.SecondsFromDuration(key.Interval),
+		after,
+	)
+
+	if !key.CalendarInterval.IsZero() {
+		b = sqlbuilder.Build(
+			"ALTER TABLE rollup_meta_info DELETE WHERE database = $? AND table = $? AND after_sec = $? AND interval_sec = 0 AND interval_calendar = $? AND roll_ups_at > $? SETTINGS mutations_sync = 2",
+			key.Database,
+			key.Table,
+			timeUtils.SecondsFromDuration(key.After),
+			key.CalendarInterval.String(),
+			after,
+		)
+	}
+
+	sql, args := b.BuildWithFlavor(sqlbuilder.ClickHouse)
+
+	return shard.Exec(ctx, sql, args...)
+}
@@ -12,7 +12,9 @@ import (
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/mock/gomock"
 
+	"github.com/ozontech/ch-rollup/pkg/database"
 	"github.com/ozontech/ch-rollup/pkg/database/mock"
+	"github.com/ozontech/ch-rollup/pkg/types"
 )
 
 func Test_getLatestRollUpByKeyOnShard(t *testing.T) {
@@ -61,6 +63,37 @@ func Test_getLatestRollUpByKeyOnShard(t *testing.T) {
 			},
 			want: testTime,
 		},
+		{
+			name: "Ok calendar interval",
+			args: args{
+				prepareMock: func(ctrl *gomock.Controller, shard *mock.MockShard) {
+					rowMock := mock.NewMockRow(ctrl)
+
+					rowMock.EXPECT().Scan(gomock.Any()).SetArg(0, testTime).Return(nil)
+
+					shard.
+						EXPECT().
+						QueryRow(
+							gomock.Any(),
+							"SELECT max(roll_ups_at) FROM rollup_meta_info WHERE database = ? AND table = ? AND after_sec = ? AND interval_sec = ? AND interval_calendar = ? GROUP BY database, table, after_sec, interval_sec, interval_calendar",
+							"test_database",
+							"test_table",
+							3600,
+							0,
+							"1 month",
+						).
+						Return(rowMock)
+				},
+				key: metaInfoKey{
+					Database: "test_database",
+					Table:    "test_table",
+					After:    time.Hour,
+
+					CalendarInterval: types.CalendarInterval{Unit: types.CalendarMonth},
+				},
+			},
+			want: testTime,
+		},
 		{
 			name: "Error",
 			args: args{
@@ -151,6 +184,34 @@ func Test_addMetaInfoOnShard(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "Ok calendar interval",
+			args: args{
+				prepareShardMock: func(shard *mock.MockShard) {
+					shard.
+						EXPECT().
+						Exec(
+							gomock.Any(),
+							"INSERT INTO rollup_meta_info (database, table, after_sec, interval_sec, roll_ups_at, interval_calendar) VALUES (?, ?, ?, ?, ?, ?)",
+							"test_database",
+							"test_table",
+							3600,
+							0,
+							testTime,
+							"3 month",
+						).
+						Return(nil)
+				},
+				metaInfo: metaInfo{
+					Database:  "test_database",
+					Table:     "test_table",
+					After:     time.Hour,
+					RollUpsAt: testTime,
+
+					CalendarInterval: types.CalendarInterval{Unit: types.CalendarMonth, Count: 3},
+				},
+			},
+		},
 		{
 			name: "Error",
 			args: args{
@@ -198,3 +259,37 @@ func Test_addMetaInfoOnShard(t *testing.T) {
 		})
 	}
 }
+
+func Test_migrateMetaInfoOnShard(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		execErr error
+		wantErr bool
+	}{
+		{
+			name: "Ok",
+		},
+		{
+			name:    "No table",
+			execErr: database.QueryError{Type: database.ErrUnknownTable},
+		},
+		{
+			name:    "Error",
+			execErr: errors.New("test-error"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctrl := gomock.NewController(t)
+			shardMock := mock.NewMockShard(ctrl)
+			shardMock.EXPECT().Exec(gomock.Any(), addMetaInfoCalendarColumn).Return(tt.execErr)
+
+			assert.Equal(t, tt.wantErr, migrateMetaInfoOnShard(context.Background(), shardMock) != nil)
+		})
+	}
+}
@@ -0,0 +1,308 @@
+// Copyright 2025 LLC "Ozon Technologies".
+// SPDX-License-Identifier: Apache-2.0
+
+package rollup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	databaseUtils "github.com/ozontech/ch-rollup/internal/utils/database"
+	sqlUtils "github.com/ozontech/ch-rollup/internal/utils/sql"
+	"github.com/ozontech/ch-rollup/pkg/database"
+	"github.com/ozontech/ch-rollup/pkg/types"
+)
+
+const (
+	day  = 24 * time.Hour
+	week = 7 * day
+)
+
+var (
+	errUnsupportedPartitionKey = errors.New("unsupported partition key")
+	errPartitionKeyMismatch    = errors.New("partitionKey doesn't match partition key of the table")
+	errReplicatedMismatch      = errors.New("replicated doesn't match engine of the table")
+)
+
+// partitionKeyFunctions are functions of time column that define partition granularity.
+var partitionKeyFunctions = map[string]time.Duration{
+	"toYYYYMMDD":    day,
+	"toDate":        day,
+	"toDate32":      day,
+	"toStartOfDay":  day,
+	"toStartOfHour": time.Hour,
+	"toMonday":      week,
+}
+
+// calendarPartitionKeyFunctions are functions of time column that make partitions of months, quarters or years.
+var calendarPartitionKeyFunctions = map[string]types.CalendarUnit{
+	"toYYYYMM":           types.CalendarMonth,
+	"toStartOfMonth":     types.CalendarMonth,
+	"toRelativeMonthNum": types.CalendarMonth,
+	"toStartOfQuarter":   types.CalendarQuarter,
+	"toStartOfYear":      types.CalendarYear,
+	"toYear":             types.CalendarYear,
+}
+
+var intervalUnits = map[string]time.Duration{
+	"SECOND": time.Second,
+	"MINUTE": time.Minute,
+	"HOUR":   time.Hour,
+	"DAY":    day,
+	"WEEK":   week,
+}
+
+var calendarIntervalUnits = map[string]types.CalendarUnit{
+	"MONTH":   types.CalendarMonth,
+	"QUARTER": types.CalendarQuarter,
+	"YEAR":    types.CalendarYear,
+}
+
+var (
+	functionCallRegexp = regexp.MustCompile(`^(\w+)\((.*)\)$`)
+	intervalRegexp     = regexp.MustCompile(`(?i)^INTERVAL\s+(\d+)\s+(\w+?)S?$`)
+	// ClickHouse formats 'INTERVAL 1 HOUR' as 'toIntervalHour(1)' at system.tables.
+	intervalFunctionRegexp = regexp.MustCompile(`^toInterval(\w+)\((\d+)\)$`)
+)
+
+// resolvePartitionKey reads partition key of the table and sets RunOptions.PartitionKey or RunOptions.CalendarPartitionKey,
+// if they are not set, or checks that configured one matches partition key of the table.
+// It also checks that RunOptions.Replicated matches engine of the table.
+func resolvePartitionKey(ctx context.Context, shard database.Shard, opts *RunOptions) error {
+	// Partitions of target table are replaced, so roll up window is aligned to them.
+	targetDatabase, targetTable := opts.targetDatabase(), opts.targetTable()
+
+	expression, engine, err := getPartitionKeyOnShard(ctx, shard, targetDatabase, targetTable)
+	if err != nil {
+		return fmt.Errorf("failed to get partition key of %s.%s: %w", targetDatabase, targetTable, err)
+	}
+
+	// Temp table of replicated table must get its own replication path, and service tables are replicated too.
+	if databaseUtils.IsReplicatedEngine(engine) != opts.Replicated {
+		return fmt.Errorf("%w: replicated is %t, but engine of %s.%s is '%s'", errReplicatedMismatch, opts.Replicated, targetDatabase, targetTable, engine)
+	}
+
+	configured := opts.partitionPeriod()
+
+	partitionKey, timezone, err := parsePartitionKey(expression, opts.Columns, opts.TimeColumnType)
+	if err != nil {
+		if !configured.isZero() {
+			// We can't check it, so we trust configured one.
+			return nil
+		}
+
+		return fmt.Errorf("failed to infer partition key of %s.%s: %w", targetDatabase, targetTable, err)
+	}
+
+	opts.partitionTimezone = timezone
+
+	if configured.isZero() {
+		opts.PartitionKey, opts.CalendarPartitionKey = partitionKey.duration, partitionKey.calendar
+		return nil
+	}
+
+	if configured != partitionKey {
+		return fmt.Errorf("%w: configured %s, but %s.%s is partitioned by '%s'", errPartitionKeyMismatch, configured, targetDatabase, targetTable, expression)
+	}
+
+	return nil
+}
+
+// getPartitionKeyOnShard returns partition key and engine definition of the table.
+func getPartitionKeyOnShard(ctx context.Context, shard database.Shard, databaseName, table string) (partitionKey, engineFull string, err error) {
+	err = shard.QueryRow(
+		ctx,
+		"SELECT partition_key, engine_full FROM system.tables WHERE database = ? AND name = ?",
+		databaseName,
+		table,
+	).Scan(&partitionKey, &engineFull)
+	if err != nil {
+		return "", "", err
+	}
+
+	return partitionKey, engineFull, nil
+}
+
+// parsePartitionKey returns partition granularity of PARTITION BY expression by time column and timezone
+// of partitions boundaries, if it's set at the expression. Time column can be an argument of function, bare Date column
+// or be replaced by column derived from it by ColumnSetting.DerivedFromTime.
+// Expression can be a tuple, other elements of it don't affect granularity in time.
+func parsePartitionKey(expression string, columns []types.ColumnSetting, timeColumnType types.TimeColumnType) (period, string, error) {
+	timeColumn := getTimeColumnName(columns)
+
+	derivedColumns := make(map[string]string)
+	for _, column := range getDerivedTimeColumns(columns) {
+		derivedColumns[column.Name] = column.DerivedFromTime
+	}
+
+	for _, element := range splitTopLevel(strings.TrimSpace(expression)) {
+		// Bare column is an argument without function.
+		function, args := "", []string{element}
+		if match := functionCallRegexp.FindStringSubmatch(element); match != nil {
+			function, args = match[1], splitTopLevel(match[2])
+		}
+
+		if len(args) == 0 {
+			continue
+		}
+
+		column := unquoteIdentifier(args[0])
+
+		// Bare derived column is partitioned by its function of time column.
+		if derivedFunction, ok := derivedColumns[column]; ok {
+			column = timeColumn
+
+			if function == "" {
+				function, args = derivedFunction, []string{timeColumn}
+			}
+		}
+
+		if column != timeColumn {
+			continue
+		}
+
+		if partitionKey, ok := parsePartitionFunction(function, args, timeColumnType); ok {
+			return partitionKey, parsePartitionTimezone(function, args), nil
+		}
+	}
+
+	return period{}, "", fmt.Errorf("%w: '%s'", errUnsupportedPartitionKey, expression)
+}
+
+// parsePartitionFunction returns partition granularity of function of time column.
+func parsePartitionFunction(function string, args []string, timeColumnType types.TimeColumnType) (period, bool) {
+	if function == "" {
+		// Each value of bare Date column is a day, bare DateTime column makes too small partitions.
+		return newPeriod(day, types.CalendarInterval{}), timeColumnType == types.TimeColumnDate
+	}
+
+	if unit, ok := calendarPartitionKeyFunctions[function]; ok {
+		return newPeriod(0, types.CalendarInterval{Unit: unit}), true
+	}
+
+	if partitionKey, ok := partitionKeyFunctions[function]; ok {
+		return newPeriod(partitionKey, types.CalendarInterval{}), true
+	}
+
+	if function == "toStartOfInterval" && len(args) > 1 {
+		return parseInterval(args[1])
+	}
+
+	return period{}, false
+}
+
+// parsePartitionTimezone returns timezone argument of partition function, like 'Europe/Moscow' of toYYYYMMDD(t, 'Europe/Moscow').
+func parsePartitionTimezone(function string, args []string) string {
+	index := 1
+	if function == "toStartOfInterval" {
+		index = 2
+	}
+
+	if len(args) <= index {
+		return ""
+	}
+
+	timezone := args[index]
+	if len(timezone) < 2 || timezone[0] != '\'' || sqlUtils.QuotedEnd(timezone, '\'') != len(timezone) {
+		return ""
+	}
+
+	return timezone[1 : len(timezone)-1]
+}
+
+// parseInterval parses 'INTERVAL 1 HOUR' and 'toIntervalHour(1)' expressions.
+func parseInterval(expression string) (period, bool) {
+	var unitName, countValue string
+
+	if match := intervalRegexp.FindStringSubmatch(expression); match != nil {
+		countValue, unitName = match[1], match[2]
+	} else if match = intervalFunctionRegexp.FindStringSubmatch(expression); match != nil {
+		unitName, countValue = match[1], match[2]
+	} else {
+		return period{}, false
+	}
+
+	count, err := strconv.Atoi(countValue)
+	if err != nil || count <= 0 {
+		return period{}, false
+	}
+
+	if unit, ok := calendarIntervalUnits[strings.ToUpper(unitName)]; ok {
+		return newPeriod(0, types.CalendarInterval{Unit: unit, Count: count}), true
+	}
+
+	unit, ok := intervalUnits[strings.ToUpper(unitName)]
+	if !ok {
+		return period{}, false
+	}
+
+	return newPeriod(unit*time.Duration(count), types.CalendarInterval{}), true
+}
+
+// splitTopLevel splits tuple or arguments list by commas that are not inside of parentheses.
+func splitTopLevel(expression string) []string {
+	if strings.HasPrefix(expression, "(") && strings.HasSuffix(expression, ")") && closingParenthesis(expression) == len(expression)-1 {
+		expression = expression[1 : len(expression)-1]
+	}
+
+	var (
+		result []string
+		depth  int
+		start  int
+	)
+
+	for i, r := range expression {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				result = append(result, strings.TrimSpace(expression[start:i]))
+				start = i + 1
+			}
+		}
+	}
+
+	if rest := strings.TrimSpace(expression[start:]); rest != "" {
+		result = append(result, rest)
+	}
+
+	return result
+}
+
+// closingParenthesis returns index of parenthesis that closes the first one.
+func closingParenthesis(expression string) int {
+	depth := 0
+
+	for i, r := range expression {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+func unquoteIdentifier(identifier string) string {
+	if len(identifier) > 1 {
+		first, last := identifier[0], identifier[len(identifier)-1]
+		if first == last && (first == '`' || first == '"') {
+			return identifier[1 : len(identifier)-1]
+		}
+	}
+
+	return identifier
+}
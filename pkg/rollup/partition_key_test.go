@@ -0,0 +1,310 @@
+// Copyright 2025 LLC "Ozon Technologies".
+// SPDX-License-Identifier: Apache-2.0
+
+package rollup
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	"github.com/ozontech/ch-rollup/pkg/database/mock"
+	"github.com/ozontech/ch-rollup/pkg/types"
+)
+
+func Test_parsePartitionKey(t *testing.T) {
+	t.Parallel()
+
+	testColumns := []types.ColumnSetting{
+		{Name: "event_time", IsRollUpTime: true},
+		{Name: "event_date", DerivedFromTime: "toDate"},
+		{Name: "event_hour", DerivedFromTime: "toStartOfHour"},
+		{Name: "event_at", DerivedFromTime: "toDateTime"},
+	}
+
+	tests := []struct {
+		name           string
+		expression     string
+		timeColumnType types.TimeColumnType
+		want           period
+		wantTimezone   string
+		wantErr        error
+	}{
+		{
+			name:       "Day",
+			expression: "toYYYYMMDD(event_time)",
+			want:       period{duration: time.Hour * 24},
+		},
+		{
+			name:         "Day with timezone",
+			expression:   "toDate(event_time, 'Europe/Moscow')",
+			want:         period{duration: time.Hour * 24},
+			wantTimezone: "Europe/Moscow",
+		},
+		{
+			name:         "Interval with timezone",
+			expression:   "toStartOfInterval(event_time, toIntervalHour(6), 'Asia/Yekaterinburg')",
+			want:         period{duration: time.Hour * 6},
+			wantTimezone: "Asia/Yekaterinburg",
+		},
+		{
+			name:           "Bare Date column",
+			expression:     "event_time",
+			timeColumnType: types.TimeColumnDate,
+			want:           period{duration: time.Hour * 24},
+		},
+		{
+			name:           "Bare DateTime column",
+			expression:     "event_time",
+			timeColumnType: types.TimeColumnDateTime,
+			wantErr:        errUnsupportedPartitionKey,
+		},
+		{
+			name:       "Bare derived column",
+			expression: "(region, `event_hour`)",
+			want:       period{duration: time.Hour},
+		},
+		{
+			name:       "Function of derived column",
+			expression: "toYYYYMMDD(event_date)",
+			want:       period{duration: time.Hour * 24},
+		},
+		{
+			name:       "Bare derived column of unsupported function",
+			expression: "event_at",
+			wantErr:    errUnsupportedPartitionKey,
+		},
+		{
+			name:       "Hour",
+			expression: "toStartOfHour(event_time)",
+			want:       period{duration: time.Hour},
+		},
+		{
+			name:       "Week",
+			expression: "toMonday(`event_time`)",
+			want:       period{duration: time.Hour * 24 * 7},
+		},
+		{
+			name:       "Interval",
+			expression: "toStartOfInterval(event_time, INTERVAL 6 HOUR)",
+			want:       period{duration: time.Hour * 6},
+		},
+		{
+			name:       "Formatted interval",
+			expression: "toStartOfInterval(event_time, toIntervalDay(2))",
+			want:       period{duration: time.Hour * 48},
+		},
+		{
+			name:       "Tuple",
+			expression: "(region, toYYYYMMDD(event_time))",
+			want:       period{duration: time.Hour * 24},
+		},
+		{
+			name:       "Month",
+			expression: "toYYYYMM(event_time)",
+			want:       period{calendar: types.CalendarInterval{Unit: types.CalendarMonth, Count: 1}},
+		},
+		{
+			name:       "Quarter",
+			expression: "toStartOfQuarter(event_time)",
+			want:       period{calendar: types.CalendarInterval{Unit: types.CalendarQuarter, Count: 1}},
+		},
+		{
+			name:       "Calendar interval",
+			expression: "toStartOfInterval(event_time, toIntervalMonth(6))",
+			want:       period{calendar: types.CalendarInterval{Unit: types.CalendarMonth, Count: 6}},
+		},
+		{
+			name:       "Other column",
+			expression: "toYYYYMMDD(created_at)",
+			wantErr:    errUnsupportedPartitionKey,
+		},
+		{
+			name:       "Unknown function",
+			expression: "intDiv(toUnixTimestamp(event_time), 3600)",
+			wantErr:    errUnsupportedPartitionKey,
+		},
+		{
+			name:       "Empty",
+			expression: "",
+			wantErr:    errUnsupportedPartitionKey,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, gotTimezone, err := parsePartitionKey(tt.expression, testColumns, tt.timeColumnType)
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantTimezone, gotTimezone)
+		})
+	}
+}
+
+func Test_resolvePartitionKey(t *testing.T) {
+	t.Parallel()
+
+	const (
+		testDatabase = "test_database"
+		testTable    = "test_table"
+	)
+
+	testColumns := []types.ColumnSetting{
+		{
+			Name:         "test_time",
+			IsRollUpTime: true,
+		},
+	}
+
+	tests := []struct {
+		name           string
+		tablePartition string
+		tableEngine    string
+		tableErr       error
+		replicated     bool
+		partitionKey   time.Duration
+		calendarKey    types.CalendarInterval
+		want           time.Duration
+		wantCalendar   types.CalendarInterval
+		wantTimezone   string
+		wantErr        bool
+	}{
+		{
+			name:           "Inferred",
+			tablePartition: "toYYYYMMDD(test_time)",
+			want:           time.Hour * 24,
+		},
+		{
+			name:           "Matches",
+			tablePartition: "toStartOfHour(test_time)",
+			partitionKey:   time.Hour,
+			want:           time.Hour,
+		},
+		{
+			name:           "Mismatch",
+			tablePartition: "toYYYYMMDD(test_time)",
+			partitionKey:   time.Hour,
+			wantErr:        true,
+		},
+		{
+			name:           "Unsupported with configured",
+			tablePartition: "intDiv(toUnixTimestamp(test_time), 3600)",
+			partitionKey:   time.Hour,
+			want:           time.Hour,
+		},
+		{
+			name:           "Unsupported without configured",
+			tablePartition: "intDiv(toUnixTimestamp(test_time), 3600)",
+			wantErr:        true,
+		},
+		{
+			name:           "Inferred calendar",
+			tablePartition: "toYYYYMM(test_time)",
+			wantCalendar:   types.CalendarInterval{Unit: types.CalendarMonth, Count: 1},
+		},
+		{
+			name:           "Matches calendar",
+			tablePartition: "toYYYYMM(test_time)",
+			calendarKey:    types.CalendarInterval{Unit: types.CalendarMonth},
+			wantCalendar:   types.CalendarInterval{Unit: types.CalendarMonth},
+		},
+		{
+			name:           "Matches calendar week",
+			tablePartition: "toMonday(test_time)",
+			calendarKey:    types.CalendarInterval{Unit: types.CalendarWeek},
+			wantCalendar:   types.CalendarInterval{Unit: types.CalendarWeek},
+		},
+		{
+			name:           "Calendar mismatch",
+			tablePartition: "toYYYYMMDD(test_time)",
+			calendarKey:    types.CalendarInterval{Unit: types.CalendarMonth},
+			wantErr:        true,
+		},
+		{
+			name:           "Inferred with timezone",
+			tablePartition: "toYYYYMMDD(test_time, 'Europe/Moscow')",
+			want:           time.Hour * 24,
+			wantTimezone:   "Europe/Moscow",
+		},
+		{
+			name:           "Replicated",
+			tablePartition: "toYYYYMMDD(test_time)",
+			tableEngine:    "ReplicatedMergeTree('/clickhouse/tables/{shard}/test_table', '{replica}') PARTITION BY toYYYYMMDD(test_time) ORDER BY test_time",
+			replicated:     true,
+			want:           time.Hour * 24,
+		},
+		{
+			name:           "Replicated engine without replicated",
+			tablePartition: "toYYYYMMDD(test_time)",
+			tableEngine:    "ReplicatedMergeTree('/clickhouse/tables/{shard}/test_table', '{replica}') PARTITION BY toYYYYMMDD(test_time) ORDER BY test_time",
+			wantErr:        true,
+		},
+		{
+			name:           "Replicated without replicated engine",
+			tablePartition: "toYYYYMMDD(test_time)",
+			replicated:     true,
+			wantErr:        true,
+		},
+		{
+			name:     "Failed to get partition key",
+			tableErr: errors.New("test"),
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctrl := gomock.NewController(t)
+
+			tableEngine := tt.tableEngine
+			if tableEngine == "" {
+				tableEngine = "MergeTree PARTITION BY " + tt.tablePartition + " ORDER BY test_time"
+			}
+
+			rowMock := mock.NewMockRow(ctrl)
+			if tt.tableErr != nil {
+				rowMock.EXPECT().Scan(gomock.Any(), gomock.Any()).Return(tt.tableErr)
+			} else {
+				rowMock.EXPECT().Scan(gomock.Any(), gomock.Any()).DoAndReturn(func(dest ...any) error {
+					*dest[0].(*string) = tt.tablePartition
+					*dest[1].(*string) = tableEngine
+
+					return nil
+				})
+			}
+
+			shardMock := mock.NewMockShard(ctrl)
+			shardMock.EXPECT().QueryRow(
+				gomock.Any(),
+				"SELECT partition_key, engine_full FROM system.tables WHERE database = ? AND name = ?",
+				testDatabase,
+				testTable,
+			).Return(rowMock)
+
+			opts := RunOptions{
+				Database:     testDatabase,
+				Table:        testTable,
+				PartitionKey: tt.partitionKey,
+				Columns:      testColumns,
+				Replicated:   tt.replicated,
+
+				CalendarPartitionKey: tt.calendarKey,
+			}
+
+			err := resolvePartitionKey(context.Background(), shardMock, &opts)
+			assert.Equal(t, tt.wantErr, err != nil)
+
+			if !tt.wantErr {
+				assert.Equal(t, tt.want, opts.PartitionKey)
+				assert.Equal(t, tt.wantCalendar, opts.CalendarPartitionKey)
+				assert.Equal(t, tt.wantTimezone, opts.partitionTimezone)
+			}
+		})
+	}
+}
@@ -6,10 +6,13 @@ package rollup
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/huandu/go-sqlbuilder"
 
+	sliceUtils "github.com/ozontech/ch-rollup/internal/utils/slice"
 	sqlUtils "github.com/ozontech/ch-rollup/internal/utils/sql"
+	timeUtils "github.com/ozontech/ch-rollup/internal/utils/time"
 	"github.com/ozontech/ch-rollup/pkg/database"
 )
 
@@ -24,6 +27,38 @@ func getPartitionsOnShard(ctx context.Context, shard database.Shard, databaseNam
 	)
 	sb.GroupBy("partition")
 
+	return queryPartitionsOnShard(ctx, shard, sb)
+}
+
+type partsStats struct {
+	Rows  uint64
+	Bytes uint64
+}
+
+// getPartsStatsOnShard returns number of rows and bytes on disk of table partitions.
+func getPartsStatsOnShard(ctx context.Context, shard database.Shard, databaseName, tableName string, partitions []string) (partsStats, error) {
+	sb := sqlbuilder.NewSelectBuilder().From("system.parts")
+
+	sb.Select("sum(rows)", "sum(bytes_on_disk)")
+	sb.Where(
+		sb.Equal("database", databaseName),
+		sb.Equal("table", tableName),
+		sb.Equal("active", 1),
+		sb.In("partition", sliceUtils.ConvertFunc(partitions, func(elem string) any { return elem })...),
+	)
+
+	sql, args := sb.BuildWithFlavor(sqlbuilder.ClickHouse)
+
+	var result partsStats
+
+	if err := shard.QueryRow(ctx, sql, args...).Scan(&result.Rows, &result.Bytes); err != nil {
+		return partsStats{}, err
+	}
+
+	return result, nil
+}
+
+func queryPartitionsOnShard(ctx context.Context, shard database.Shard, sb *sqlbuilder.SelectBuilder) ([]string, error) {
 	sql, args := sb.BuildWithFlavor(sqlbuilder.ClickHouse)
 
 	rows, err := shard.Query(ctx, sql, args...)
@@ -55,12 +90,18 @@ func getPartitionsOnShard(ctx context.Context, shard database.Shard, databaseNam
 }
 
 // replacePartitionsOnShard replaces partitions on shard.
+// If waitReplicas is set, each replace waits until all replicas of 'to' table execute it.
 // Arguments must be sanitized.
-func replacePartitionsOnShard(ctx context.Context, shard database.Shard, databaseName, from, to string, partitions []string) error {
+func replacePartitionsOnShard(ctx context.Context, shard database.Shard, databaseName, from, to string, partitions []string, waitReplicas bool) error {
+	format := "ALTER TABLE $? REPLACE PARTITION $? FROM $?"
+	if waitReplicas {
+		format += " SETTINGS alter_sync = 2"
+	}
+
 	// TODO: generate multistatement query.
 	for _, partition := range partitions {
 		b := sqlbuilder.Build(
-			"ALTER TABLE $? REPLACE PARTITION $? FROM $?",
+			format,
 			sqlbuilder.Raw(sqlUtils.QuotedDatabaseEntity(databaseName, to)),
 			partition,
 			sqlbuilder.Raw(sqlUtils.QuotedDatabaseEntity(databaseName, from)),
@@ -76,3 +117,99 @@ func replacePartitionsOnShard(ctx context.Context, shard database.Shard, databas
 
 	return nil
 }
+
+// getPartitionsWithinOnShard returns partitions of table with all rows inside of the time range by min-max index of parts.
+// Parts of partition key by DateTime column have min-max time, parts of partition key by Date column have min-max date
+// that is compared with dates of the range at the location. Partitions without time in partition key are never returned.
+func getPartitionsWithinOnShard(ctx context.Context, shard database.Shard, databaseName, tableName string, r timeUtils.Range, location *time.Location) ([]string, error) {
+	if location == nil {
+		location = time.UTC
+	}
+
+	sb := sqlbuilder.NewSelectBuilder().From("system.parts")
+
+	sb.Select("partition")
+	sb.Where(
+		sb.Equal("database", databaseName),
+		sb.Equal("table", tableName),
+		sb.Equal("active", 1),
+	)
+	sb.GroupBy("partition")
+	sb.Having(
+		sb.Or(
+			sb.And(
+				"min(min_time) > 0",
+				sb.GreaterEqualThan("min(min_time)", r.From),
+				sb.LessThan("max(max_time)", r.To),
+			),
+			sb.And(
+				"min(min_date) > '1970-01-01'",
+				sb.GreaterEqualThan("min(min_date)", r.From.In(location).Format(time.DateOnly)),
+				// Rows of the last date are before the end of range only if the date is before date of the end.
+				sb.LessThan("max(max_date)", r.To.In(location).Format(time.DateOnly)),
+			),
+		),
+	)
+
+	return queryPartitionsOnShard(ctx, shard, sb)
+}
+
+// getPartitionsOverlappingOnShard returns partitions of table with parts that may contain rows inside of the time range
+// by min-max index of parts, so the table data is not read. Dates of parts of partition key by Date column are compared
+// with dates of the range at the location. Partitions without time in partition key are never returned.
+func getPartitionsOverlappingOnShard(ctx context.Context, shard database.Shard, databaseName, tableName string, r timeUtils.Range, location *time.Location) ([]string, error) {
+	if location == nil {
+		location = time.UTC
+	}
+
+	sb := sqlbuilder.NewSelectBuilder().From("system.parts")
+
+	sb.Select("partition")
+	sb.Where(
+		sb.Equal("database", databaseName),
+		sb.Equal("table", tableName),
+		sb.Equal("active", 1),
+		sb.Or(
+			sb.And(
+				"min_time > 0",
+				sb.LessThan("min_time", r.To),
+				sb.GreaterEqualThan("max_time", r.From),
+			),
+			sb.And(
+				"min_date > '1970-01-01'",
+				// The end of range is exclusive, so the last date of the range is the date of its last nanosecond.
+				sb.LessEqualThan("min_date", r.To.Add(-time.Nanosecond).In(location).Format(time.DateOnly)),
+				sb.GreaterEqualThan("max_date", r.From.In(location).Format(time.DateOnly)),
+			),
+		),
+	)
+	sb.GroupBy("partition")
+
+	return queryPartitionsOnShard(ctx, shard, sb)
+}
+
+// dropPartitionsOnShard drops partitions on shard.
+// If waitReplicas is set, each drop waits until all replicas of the table execute it.
+// Arguments must be sanitized.
+func dropPartitionsOnShard(ctx context.Context, shard database.Shard, databaseName, tableName string, partitions []string, waitReplicas bool) error {
+	format := "ALTER TABLE $? DROP PARTITION $?"
+	if waitReplicas {
+		format += " SETTINGS alter_sync = 2"
+	}
+
+	for _, partition := range partitions {
+		b := sqlbuilder.Build(
+			format,
+			sqlbuilder.Raw(sqlUtils.QuotedDatabaseEntity(databaseName, tableName)),
+			partition,
+		)
+
+		sql, args := b.BuildWithFlavor(sqlbuilder.ClickHouse)
+
+		if err := shard.Exec(ctx, sql, args...); err != nil {
+			return fmt.Errorf("failed to drop partition: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -7,10 +7,12 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/mock/gomock"
 
+	timeUtils "github.com/ozontech/ch-rollup/internal/utils/time"
 	"github.com/ozontech/ch-rollup/pkg/database/mock"
 )
 
@@ -185,6 +187,7 @@ func Test_replacePartitionsOnShard(t *testing.T) {
 		from             string
 		to               string
 		partitions       []string
+		waitReplicas     bool
 	}
 	tests := []struct {
 		name    string
@@ -232,6 +235,27 @@ func Test_replacePartitionsOnShard(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "Ok with wait replicas",
+			args: args{
+				prepareShardMock: func(shard *mock.MockShard) {
+					shard.
+						EXPECT().
+						Exec(
+							gomock.Any(),
+							generatedQuery+" SETTINGS alter_sync = 2",
+							testPartition,
+						).Return(nil)
+				},
+				database: testDatabase,
+				from:     testTableFrom,
+				to:       testTableTo,
+				partitions: []string{
+					testPartition,
+				},
+				waitReplicas: true,
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -247,8 +271,84 @@ func Test_replacePartitionsOnShard(t *testing.T) {
 			assert.Equal(
 				t,
 				tt.wantErr,
-				replacePartitionsOnShard(context.Background(), shardMock, tt.args.database, tt.args.from, tt.args.to, tt.args.partitions) != nil,
+				replacePartitionsOnShard(context.Background(), shardMock, tt.args.database, tt.args.from, tt.args.to, tt.args.partitions, tt.args.waitReplicas) != nil,
 			)
 		})
 	}
 }
+
+func Test_getPartitionsOverlappingOnShard(t *testing.T) {
+	t.Parallel()
+
+	const (
+		generatedQuery = "SELECT partition FROM system.parts WHERE database = ? AND table = ? AND active = ? AND ((min_time > 0 AND min_time < ? AND max_time >= ?) OR (min_date > '1970-01-01' AND min_date <= ? AND max_date >= ?)) GROUP BY partition"
+
+		testDatabase  = "test_database"
+		testTable     = "test_table"
+		testPartition = "test-partition"
+	)
+
+	var (
+		testFrom   = time.Date(2024, time.June, 23, 0, 0, 0, 0, time.UTC)
+		testTo     = time.Date(2024, time.June, 24, 0, 0, 0, 0, time.UTC)
+		testMoscow = time.FixedZone("Europe/Moscow", 3*60*60)
+	)
+
+	tests := []struct {
+		name        string
+		location    *time.Location
+		prepareMock func(ctrl *gomock.Controller, shard *mock.MockShard)
+		want        []string
+		wantErr     bool
+	}{
+		{
+			name: "Ok",
+			prepareMock: func(ctrl *gomock.Controller, shard *mock.MockShard) {
+				rowsMock := mock.NewMockRows(ctrl)
+
+				rowsMock.EXPECT().Next().Return(true)
+				rowsMock.EXPECT().Scan(gomock.Any()).SetArg(0, testPartition)
+				rowsMock.EXPECT().Next()
+				rowsMock.EXPECT().Err()
+				rowsMock.EXPECT().Close()
+
+				shard.EXPECT().Query(gomock.Any(), generatedQuery, testDatabase, testTable, 1, testTo, testFrom, "2024-06-23", "2024-06-23").Return(rowsMock, nil)
+			},
+			want: []string{testPartition},
+		},
+		{
+			name:     "Ok dates at location",
+			location: testMoscow,
+			prepareMock: func(ctrl *gomock.Controller, shard *mock.MockShard) {
+				rowsMock := mock.NewMockRows(ctrl)
+
+				rowsMock.EXPECT().Next()
+				rowsMock.EXPECT().Err()
+				rowsMock.EXPECT().Close()
+
+				shard.EXPECT().Query(gomock.Any(), generatedQuery, testDatabase, testTable, 1, testTo, testFrom, "2024-06-24", "2024-06-23").Return(rowsMock, nil)
+			},
+		},
+		{
+			name: "Error at Query()",
+			prepareMock: func(_ *gomock.Controller, shard *mock.MockShard) {
+				shard.EXPECT().Query(gomock.Any(), generatedQuery, testDatabase, testTable, 1, testTo, testFrom, "2024-06-23", "2024-06-23").Return(nil, errors.New("test-error"))
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctrl := gomock.NewController(t)
+			shardMock := mock.NewMockShard(ctrl)
+
+			tt.prepareMock(ctrl, shardMock)
+
+			got, err := getPartitionsOverlappingOnShard(context.Background(), shardMock, testDatabase, testTable, timeUtils.Range{From: testFrom, To: testTo}, tt.location)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
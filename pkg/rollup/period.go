@@ -0,0 +1,93 @@
+// Copyright 2025 LLC "Ozon Technologies".
+// SPDX-License-Identifier: Apache-2.0
+
+package rollup
+
+import (
+	"fmt"
+	"time"
+
+	timeUtils "github.com/ozontech/ch-rollup/internal/utils/time"
+	"github.com/ozontech/ch-rollup/pkg/types"
+)
+
+// monthsInCalendarUnit is a number of months in calendar units with uneven length.
+var monthsInCalendarUnit = map[types.CalendarUnit]int{
+	types.CalendarMonth:   1,
+	types.CalendarQuarter: 3,
+	types.CalendarYear:    12,
+}
+
+// period is a length of partitions or roll up intervals: fixed duration or calendar interval.
+// Weeks are always fixed duration, so equal periods are equal values.
+type period struct {
+	duration time.Duration
+	calendar types.CalendarInterval
+}
+
+func newPeriod(duration time.Duration, calendar types.CalendarInterval) period {
+	if calendar.Unit == types.CalendarWeek {
+		return period{duration: week * time.Duration(calendar.Units())}
+	}
+
+	if !calendar.IsZero() {
+		return period{calendar: types.CalendarInterval{Unit: calendar.Unit, Count: calendar.Units()}}
+	}
+
+	return period{duration: duration}
+}
+
+func (p period) isZero() bool {
+	return p.duration == 0 && p.calendar.IsZero()
+}
+
+// months returns length of period in months or 0, if it's fixed duration.
+func (p period) months() int {
+	return monthsInCalendarUnit[p.calendar.Unit] * p.calendar.Units()
+}
+
+// truncate returns start of the period that contains t in loc.
+func (p period) truncate(t time.Time, loc *time.Location) time.Time {
+	if months := p.months(); months > 0 {
+		return timeUtils.TruncateMonthsIn(t, months, loc)
+	}
+
+	return timeUtils.TruncateIn(t, p.duration, loc)
+}
+
+// isBoundary reports whether t is a start of the period in loc.
+func (p period) isBoundary(t time.Time, loc *time.Location) bool {
+	return p.truncate(t, loc).Equal(t)
+}
+
+// next returns start of the period that follows the period of t in loc.
+func (p period) next(t time.Time, loc *time.Location) time.Time {
+	if months := p.months(); months > 0 {
+		return timeUtils.NextMonthsIn(t, months, loc)
+	}
+
+	return timeUtils.NextIn(t, p.duration, loc)
+}
+
+func (p period) String() string {
+	if !p.calendar.IsZero() {
+		return p.calendar.String()
+	}
+
+	return p.duration.String()
+}
+
+// parseCalendarInterval parses types.CalendarInterval saved by its String method.
+func parseCalendarInterval(value string) (types.CalendarInterval, error) {
+	var result types.CalendarInterval
+
+	if value == "" {
+		return result, nil
+	}
+
+	if _, err := fmt.Sscanf(value, "%d %s", &result.Count, &result.Unit); err != nil {
+		return types.CalendarInterval{}, fmt.Errorf("failed to parse calendar interval '%s': %w", value, err)
+	}
+
+	return result, result.Validate()
+}
@@ -0,0 +1,202 @@
+// Copyright 2025 LLC "Ozon Technologies".
+// SPDX-License-Identifier: Apache-2.0
+
+package rollup
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	timeUtils "github.com/ozontech/ch-rollup/internal/utils/time"
+	"github.com/ozontech/ch-rollup/pkg/database"
+)
+
+// TimeRange represents [From, To) time range.
+type TimeRange struct {
+	From time.Time
+	To   time.Time
+}
+
+// Plan describes what Run will do with the same RunOptions.
+type Plan struct {
+	Shards []ShardPlan
+}
+
+// ShardPlan describes what Run will do on the shard.
+type ShardPlan struct {
+	Shard string
+	// FirstRun is set when there is no meta info for the roll up on the shard.
+	// In this case Run only saves RollUpTo as the latest roll up and doesn't touch data.
+	FirstRun bool
+	// UpToDate is set when data is already rolled up and Run will skip the shard.
+	UpToDate     bool
+	LatestRollUp time.Time
+	RollUpTo     time.Time
+	// CopyIntervals are intervals that will be used to execute Statement.
+	CopyIntervals []TimeRange
+	// CopyArgs are arguments of Statement for each of CopyIntervals: From and To of the interval
+	// in type of time column, then From and To of the interval for each DerivedFromTime column.
+	CopyArgs [][]any
+	// Statement is 'INSERT ... SELECT' statement that copies rolled up data to temp table.
+	// Its placeholders like types.PlaceholderWindowFrom are expanded by the whole window from LatestRollUp to RollUpTo,
+	// while Run with RunOptions.CommitPerPartition expands them by the window of each partition.
+	Statement string
+	// PassThroughStatement is 'INSERT ... SELECT' statement that copies rows not matching RunOptions.Where as is.
+	// It's set only for in place roll up with Where and executed with the same CopyArgs as Statement.
+	PassThroughStatement string
+	// Partitions of the origin table that will be replaced, by min-max index of their parts.
+	Partitions []string
+}
+
+// Plan returns what Run will do with RunOptions on each shard of current database.Cluster.
+// It doesn't make any changes at the cluster.
+func (s *RollUp) Plan(ctx context.Context, opts RunOptions) (Plan, error) {
+	if s == nil || s.cluster == nil {
+		return Plan{}, errNotInitialized
+	}
+
+	opts.setDefaults()
+
+	if err := opts.validate(); err != nil {
+		return Plan{}, fmt.Errorf("failed to validate options: %w", err)
+	}
+
+	shards, err := s.cluster.Shards(ctx)
+	if err != nil {
+		return Plan{}, fmt.Errorf("failed to get shards: %w", err)
+	}
+
+	// Plan fails on the same mistakes in columns as Run does.
+	shardErrors, err := preflightOnShards(ctx, shards, &opts)
+	if err != nil {
+		return Plan{}, fmt.Errorf("failed to check columns: %w", err)
+	}
+
+	for i, shardErr := range shardErrors {
+		if shardErr != nil {
+			shardErrors[i] = ShardError{
+				Shard: shards[i].Name(),
+				Err:   shardErr,
+			}
+		}
+	}
+
+	if err = collectShardErrors(shardErrors); err != nil {
+		return Plan{}, err
+	}
+
+	result := Plan{
+		Shards: make([]ShardPlan, len(shards)),
+	}
+
+	g, eCtx := errgroup.WithContext(ctx)
+	for i, shard := range shards {
+		g.Go(func() error {
+			shardPlan, err := planOnShard(eCtx, shard, opts)
+			if err != nil {
+				return fmt.Errorf("failed to plan roll up on %s: %w", shard.Name(), err)
+			}
+
+			result.Shards[i] = shardPlan
+
+			return nil
+		})
+	}
+
+	if err = g.Wait(); err != nil {
+		return Plan{}, err
+	}
+
+	return result, nil
+}
+
+func planOnShard(ctx context.Context, shard database.Shard, opts RunOptions) (ShardPlan, error) {
+	result := ShardPlan{
+		Shard: shard.Name(),
+	}
+
+	if err := resolveColumns(ctx, shard, &opts); err != nil {
+		return ShardPlan{}, err
+	}
+
+	if err := resolveTimeColumnType(ctx, shard, &opts); err != nil {
+		return ShardPlan{}, err
+	}
+
+	if err := resolvePartitionKey(ctx, shard, &opts); err != nil {
+		return ShardPlan{}, err
+	}
+
+	if err := resolveLocation(ctx, shard, &opts); err != nil {
+		return ShardPlan{}, err
+	}
+
+	latestRollUp, err := getPlannedLatestRollUpOnShard(ctx, shard, opts)
+	if err != nil {
+		if !isMetaInfoNotFound(err) {
+			return ShardPlan{}, err
+		}
+
+		result.FirstRun = true
+		result.RollUpTo, err = getFirstRollUpAtOnShard(ctx, shard, opts)
+		if err != nil {
+			return ShardPlan{}, err
+		}
+
+		return result, nil
+	}
+
+	result.LatestRollUp = latestRollUp
+	result.RollUpTo = getRollUpTo(opts)
+
+	if result.RollUpTo.Compare(latestRollUp) != 1 {
+		result.UpToDate = true
+		return result, nil
+	}
+
+	if !opts.partitionPeriod().isBoundary(latestRollUp, opts.location) {
+		return ShardPlan{}, fmt.Errorf("%w: %s, partition is %s", errLatestNotAligned, latestRollUp, opts.partitionPeriod())
+	}
+
+	window := timeUtils.Range{From: latestRollUp, To: result.RollUpTo}
+
+	for _, commitWindow := range getCommitWindows(window, opts) {
+		for _, interval := range getCopyIntervals(commitWindow, opts) {
+			result.CopyIntervals = append(result.CopyIntervals, TimeRange{From: interval.From, To: interval.To})
+			result.CopyArgs = append(result.CopyArgs, timeRangeArgs(interval, opts))
+		}
+	}
+
+	// Placeholders of window are expanded by the whole window, Run expands them by each commit window.
+	statementOpts := newRollUpStatementOptions(opts, window)
+	result.Statement = generateRollUpStatement(statementOpts)
+	result.PassThroughStatement = generatePassThroughStatement(statementOpts)
+
+	result.Partitions, err = getPartitionsOverlappingOnShard(ctx, shard, opts.targetDatabase(), opts.targetTable(), window, opts.location)
+	if err != nil {
+		return ShardPlan{}, fmt.Errorf("failed to get %s.%s partitions: %w", opts.targetDatabase(), opts.targetTable(), err)
+	}
+
+	return result, nil
+}
+
+// getPlannedLatestRollUpOnShard returns latest roll up of RunOptions without migration of meta info table,
+// which Run does for calendar intervals. Not migrated meta info table has no roll ups in calendar units.
+func getPlannedLatestRollUpOnShard(ctx context.Context, shard database.Shard, opts RunOptions) (time.Time, error) {
+	if !opts.CalendarInterval.IsZero() {
+		migrated, err := hasMetaInfoCalendarColumnOnShard(ctx, shard)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to check meta info table: %w", err)
+		}
+
+		if !migrated {
+			return time.Time{}, sql.ErrNoRows
+		}
+	}
+
+	return getLatestRollUpByKeyOnShard(ctx, shard, newMetaInfoKey(opts))
+}
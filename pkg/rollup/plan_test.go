@@ -0,0 +1,434 @@
+// Copyright 2025 LLC "Ozon Technologies".
+// SPDX-License-Identifier: Apache-2.0
+
+package rollup
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+	"go.uber.org/mock/gomock"
+
+	"github.com/ozontech/ch-rollup/pkg/database"
+	"github.com/ozontech/ch-rollup/pkg/database/mock"
+	"github.com/ozontech/ch-rollup/pkg/types"
+)
+
+//nolint:paralleltest
+func TestRollUp_Plan(t *testing.T) {
+	defer func() {
+		timeNow = time.Now
+	}()
+
+	const (
+		testDatabase     = "test_database"
+		testTable        = "test_table"
+		testTempTable    = "test_temp_table"
+		testPartitionKey = time.Hour * 24
+		testInterval     = time.Hour
+		testAfter        = time.Hour * 24
+		testCopyInterval = time.Hour * 12
+
+		testShardName = "test-shard"
+		testPartition = "test-partition"
+
+		testStatement = `INSERT INTO "test_database"."test_temp_table" ("test", "test_time") SELECT "test", toStartOfInterval("test_time", INTERVAL 3600 SECOND) as "test_time" FROM "test_database"."test_table" WHERE "test_table"."test_time" >= ? AND "test_table"."test_time" < ? GROUP BY "test", "test_time"`
+	)
+
+	var (
+		testColumns = []types.ColumnSetting{
+			{
+				Name: "test",
+			},
+			{
+				Name:         "test_time",
+				IsRollUpTime: true,
+			},
+		}
+
+		testOpts = RunOptions{
+			Database:     testDatabase,
+			Table:        testTable,
+			TempTable:    testTempTable,
+			PartitionKey: testPartitionKey,
+			Columns:      testColumns,
+			Interval:     testInterval,
+			After:        testAfter,
+			CopyInterval: testCopyInterval,
+		}
+
+		testPreviousRollup = time.Date(2024, time.June, 23, 0, 0, 0, 0, time.UTC)
+		testRollupTo       = time.Date(2024, time.June, 24, 0, 0, 0, 0, time.UTC)
+		testCurrentTime    = time.Date(2024, time.June, 25, 10, 0, 0, 0, time.UTC)
+	)
+
+	expectLatestRollUp := func(ctrl *gomock.Controller, shardMock *mock.MockShard) *mock.MockRow {
+		rowMock := mock.NewMockRow(ctrl)
+		shardMock.EXPECT().QueryRow(
+			gomock.Any(),
+			"SELECT max(roll_ups_at) FROM rollup_meta_info WHERE database = ? AND table = ? AND after_sec = ? AND interval_sec = ? GROUP BY database, table, after_sec, interval_sec",
+			testDatabase,
+			testTable,
+			int(testAfter.Seconds()),
+			int(testInterval.Seconds()),
+		).Return(rowMock)
+
+		return rowMock
+	}
+
+	tests := []struct {
+		name        string
+		prepareMock func(ctrl *gomock.Controller) database.Cluster
+		opts        RunOptions
+		want        Plan
+		wantErr     bool
+	}{
+		{
+			name: "Ok",
+			prepareMock: func(ctrl *gomock.Controller) database.Cluster {
+				clusterMock := mock.NewMockCluster(ctrl)
+				shardMock := mock.NewMockShard(ctrl)
+
+				clusterMock.EXPECT().Shards(gomock.Any()).Return([]database.Shard{shardMock}, nil)
+				shardMock.EXPECT().Name().Return(testShardName)
+				expectPartitionKey(ctrl, shardMock, testDatabase, testTable, "toYYYYMMDD(test_time)")
+				expectTableColumns(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectExpressionTypes(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectTimeColumnType(ctrl, shardMock, testDatabase, testTable, "test_time", "DateTime")
+				expectServerTimezone(ctrl, shardMock, "UTC")
+
+				expectLatestRollUp(ctrl, shardMock).EXPECT().Scan(gomock.Any()).SetArg(0, testPreviousRollup)
+
+				rowsMock := mock.NewMockRows(ctrl)
+
+				rowsMock.EXPECT().Next().Return(true)
+				rowsMock.EXPECT().Scan(gomock.Any()).SetArg(0, testPartition)
+				rowsMock.EXPECT().Next()
+				rowsMock.EXPECT().Err()
+				rowsMock.EXPECT().Close()
+
+				shardMock.EXPECT().Query(
+					gomock.Any(),
+					"SELECT partition FROM system.parts WHERE database = ? AND table = ? AND active = ? AND ((min_time > 0 AND min_time < ? AND max_time >= ?) OR (min_date > '1970-01-01' AND min_date <= ? AND max_date >= ?)) GROUP BY partition",
+					testDatabase,
+					testTable,
+					1,
+					testRollupTo,
+					testPreviousRollup,
+					"2024-06-23",
+					"2024-06-23",
+				).Return(rowsMock, nil)
+
+				return clusterMock
+			},
+			opts: testOpts,
+			want: Plan{
+				Shards: []ShardPlan{
+					{
+						Shard:        testShardName,
+						LatestRollUp: testPreviousRollup,
+						RollUpTo:     testRollupTo,
+						CopyIntervals: []TimeRange{
+							{
+								From: testPreviousRollup,
+								To:   testPreviousRollup.Add(testCopyInterval),
+							},
+							{
+								From: testPreviousRollup.Add(testCopyInterval),
+								To:   testRollupTo,
+							},
+						},
+						CopyArgs: [][]any{
+							{testPreviousRollup, testPreviousRollup.Add(testCopyInterval)},
+							{testPreviousRollup.Add(testCopyInterval), testRollupTo},
+						},
+						Statement:  testStatement,
+						Partitions: []string{testPartition},
+					},
+				},
+			},
+		},
+		{
+			name: "Up to date",
+			prepareMock: func(ctrl *gomock.Controller) database.Cluster {
+				clusterMock := mock.NewMockCluster(ctrl)
+				shardMock := mock.NewMockShard(ctrl)
+
+				clusterMock.EXPECT().Shards(gomock.Any()).Return([]database.Shard{shardMock}, nil)
+				shardMock.EXPECT().Name().Return(testShardName)
+				expectPartitionKey(ctrl, shardMock, testDatabase, testTable, "toYYYYMMDD(test_time)")
+				expectTableColumns(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectExpressionTypes(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectTimeColumnType(ctrl, shardMock, testDatabase, testTable, "test_time", "DateTime")
+				expectServerTimezone(ctrl, shardMock, "UTC")
+
+				expectLatestRollUp(ctrl, shardMock).EXPECT().Scan(gomock.Any()).SetArg(0, testRollupTo)
+
+				return clusterMock
+			},
+			opts: testOpts,
+			want: Plan{
+				Shards: []ShardPlan{
+					{
+						Shard:        testShardName,
+						UpToDate:     true,
+						LatestRollUp: testRollupTo,
+						RollUpTo:     testRollupTo,
+					},
+				},
+			},
+		},
+		{
+			name: "First run",
+			prepareMock: func(ctrl *gomock.Controller) database.Cluster {
+				clusterMock := mock.NewMockCluster(ctrl)
+				shardMock := mock.NewMockShard(ctrl)
+
+				clusterMock.EXPECT().Shards(gomock.Any()).Return([]database.Shard{shardMock}, nil)
+				shardMock.EXPECT().Name().Return(testShardName)
+				expectPartitionKey(ctrl, shardMock, testDatabase, testTable, "toYYYYMMDD(test_time)")
+				expectTableColumns(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectExpressionTypes(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectTimeColumnType(ctrl, shardMock, testDatabase, testTable, "test_time", "DateTime")
+				expectServerTimezone(ctrl, shardMock, "UTC")
+
+				expectLatestRollUp(ctrl, shardMock).EXPECT().Scan(gomock.Any()).Return(database.QueryError{Type: database.ErrUnknownTable})
+
+				return clusterMock
+			},
+			opts: testOpts,
+			want: Plan{
+				Shards: []ShardPlan{
+					{
+						Shard:    testShardName,
+						FirstRun: true,
+						RollUpTo: testCurrentTime.Truncate(testPartitionKey),
+					},
+				},
+			},
+		},
+		{
+			name: "First run without meta info",
+			prepareMock: func(ctrl *gomock.Controller) database.Cluster {
+				clusterMock := mock.NewMockCluster(ctrl)
+				shardMock := mock.NewMockShard(ctrl)
+
+				clusterMock.EXPECT().Shards(gomock.Any()).Return([]database.Shard{shardMock}, nil)
+				shardMock.EXPECT().Name().Return(testShardName)
+				expectPartitionKey(ctrl, shardMock, testDatabase, testTable, "toYYYYMMDD(test_time)")
+				expectTableColumns(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectExpressionTypes(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectTimeColumnType(ctrl, shardMock, testDatabase, testTable, "test_time", "DateTime")
+				expectServerTimezone(ctrl, shardMock, "UTC")
+
+				expectLatestRollUp(ctrl, shardMock).EXPECT().Scan(gomock.Any()).Return(sql.ErrNoRows)
+
+				return clusterMock
+			},
+			opts: testOpts,
+			want: Plan{
+				Shards: []ShardPlan{
+					{
+						Shard:    testShardName,
+						FirstRun: true,
+						RollUpTo: testCurrentTime.Truncate(testPartitionKey),
+					},
+				},
+			},
+		},
+		{
+			name: "First run with not migrated meta info",
+			prepareMock: func(ctrl *gomock.Controller) database.Cluster {
+				clusterMock := mock.NewMockCluster(ctrl)
+				shardMock := mock.NewMockShard(ctrl)
+
+				clusterMock.EXPECT().Shards(gomock.Any()).Return([]database.Shard{shardMock}, nil)
+				shardMock.EXPECT().Name().Return(testShardName)
+				expectPartitionKey(ctrl, shardMock, testDatabase, testTable, "toYYYYMM(test_time)")
+				expectTableColumns(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectExpressionTypes(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectTimeColumnType(ctrl, shardMock, testDatabase, testTable, "test_time", "DateTime")
+				expectServerTimezone(ctrl, shardMock, "UTC")
+
+				rowMock := mock.NewMockRow(ctrl)
+				rowMock.EXPECT().Scan(gomock.Any()).SetArg(0, uint64(0))
+				shardMock.EXPECT().QueryRow(
+					gomock.Any(),
+					"SELECT count() FROM system.columns WHERE database = currentDatabase() AND table = 'rollup_meta_info' AND name = 'interval_calendar'",
+				).Return(rowMock)
+
+				return clusterMock
+			},
+			opts: RunOptions{
+				Database:             testDatabase,
+				Table:                testTable,
+				TempTable:            testTempTable,
+				CalendarPartitionKey: types.CalendarInterval{Unit: types.CalendarMonth},
+				Columns:              testColumns,
+				CalendarInterval:     types.CalendarInterval{Unit: types.CalendarMonth},
+				After:                testAfter,
+				CopyInterval:         testCopyInterval,
+			},
+			want: Plan{
+				Shards: []ShardPlan{
+					{
+						Shard:    testShardName,
+						FirstRun: true,
+						RollUpTo: time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC),
+					},
+				},
+			},
+		},
+		{
+			name: "Not initialized",
+			prepareMock: func(_ *gomock.Controller) database.Cluster {
+				return nil
+			},
+			opts:    testOpts,
+			wantErr: true,
+		},
+		{
+			name: "Validation failed",
+			prepareMock: func(ctrl *gomock.Controller) database.Cluster {
+				return mock.NewMockCluster(ctrl)
+			},
+			opts:    RunOptions{},
+			wantErr: true,
+		},
+		{
+			name: "Failed to get shards",
+			prepareMock: func(ctrl *gomock.Controller) database.Cluster {
+				clusterMock := mock.NewMockCluster(ctrl)
+
+				clusterMock.EXPECT().Shards(gomock.Any()).Return(nil, errors.New("test-error"))
+
+				return clusterMock
+			},
+			opts:    testOpts,
+			wantErr: true,
+		},
+		{
+			name: "Column is not covered",
+			prepareMock: func(ctrl *gomock.Controller) database.Cluster {
+				clusterMock := mock.NewMockCluster(ctrl)
+				shardMock := mock.NewMockShard(ctrl)
+
+				clusterMock.EXPECT().Shards(gomock.Any()).Return([]database.Shard{shardMock}, nil)
+				expectTableColumns(ctrl, shardMock, testDatabase, testTable, append(slices.Clone(testColumns), types.ColumnSetting{Name: "test_lost"}))
+
+				return clusterMock
+			},
+			opts:    testOpts,
+			wantErr: true,
+		},
+		{
+			name: "Described columns mismatch",
+			prepareMock: func(ctrl *gomock.Controller) database.Cluster {
+				clusterMock := mock.NewMockCluster(ctrl)
+				shardMock := mock.NewMockShard(ctrl)
+
+				clusterMock.EXPECT().Shards(gomock.Any()).Return([]database.Shard{shardMock}, nil)
+				expectTableColumns(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectExpressionTypes(ctrl, shardMock, testDatabase, testTable, testColumns[1:])
+
+				return clusterMock
+			},
+			opts:    testOpts,
+			wantErr: true,
+		},
+		{
+			name: "Error on getLatestRollUpByKeyOnShard",
+			prepareMock: func(ctrl *gomock.Controller) database.Cluster {
+				clusterMock := mock.NewMockCluster(ctrl)
+				shardMock := mock.NewMockShard(ctrl)
+
+				clusterMock.EXPECT().Shards(gomock.Any()).Return([]database.Shard{shardMock}, nil)
+				shardMock.EXPECT().Name().Return(testShardName).Times(2)
+				expectPartitionKey(ctrl, shardMock, testDatabase, testTable, "toYYYYMMDD(test_time)")
+				expectTableColumns(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectExpressionTypes(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectTimeColumnType(ctrl, shardMock, testDatabase, testTable, "test_time", "DateTime")
+				expectServerTimezone(ctrl, shardMock, "UTC")
+
+				expectLatestRollUp(ctrl, shardMock).EXPECT().Scan(gomock.Any()).Return(errors.New("test-error"))
+
+				return clusterMock
+			},
+			opts:    testOpts,
+			wantErr: true,
+		},
+		{
+			name: "Latest roll up not aligned to partitions",
+			prepareMock: func(ctrl *gomock.Controller) database.Cluster {
+				clusterMock := mock.NewMockCluster(ctrl)
+				shardMock := mock.NewMockShard(ctrl)
+
+				clusterMock.EXPECT().Shards(gomock.Any()).Return([]database.Shard{shardMock}, nil)
+				shardMock.EXPECT().Name().Return(testShardName).Times(2)
+				expectPartitionKey(ctrl, shardMock, testDatabase, testTable, "toYYYYMMDD(test_time)")
+				expectTableColumns(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectExpressionTypes(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectTimeColumnType(ctrl, shardMock, testDatabase, testTable, "test_time", "DateTime")
+				expectServerTimezone(ctrl, shardMock, "UTC")
+
+				expectLatestRollUp(ctrl, shardMock).EXPECT().Scan(gomock.Any()).SetArg(0, testPreviousRollup.Add(-3*time.Hour))
+
+				return clusterMock
+			},
+			opts:    testOpts,
+			wantErr: true,
+		},
+		{
+			name: "Failed to get partitions",
+			prepareMock: func(ctrl *gomock.Controller) database.Cluster {
+				clusterMock := mock.NewMockCluster(ctrl)
+				shardMock := mock.NewMockShard(ctrl)
+
+				clusterMock.EXPECT().Shards(gomock.Any()).Return([]database.Shard{shardMock}, nil)
+				shardMock.EXPECT().Name().Return(testShardName).Times(2)
+				expectPartitionKey(ctrl, shardMock, testDatabase, testTable, "toYYYYMMDD(test_time)")
+				expectTableColumns(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectExpressionTypes(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectTimeColumnType(ctrl, shardMock, testDatabase, testTable, "test_time", "DateTime")
+				expectServerTimezone(ctrl, shardMock, "UTC")
+
+				expectLatestRollUp(ctrl, shardMock).EXPECT().Scan(gomock.Any()).SetArg(0, testPreviousRollup)
+
+				shardMock.EXPECT().Query(
+					gomock.Any(),
+					gomock.Any(),
+					gomock.Any(),
+				).Return(nil, errors.New("test-error"))
+
+				return clusterMock
+			},
+			opts:    testOpts,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		timeNow = func() time.Time {
+			return testCurrentTime
+		}
+
+		t.Run(tt.name, func(t *testing.T) {
+			defer goleak.VerifyNone(t)
+
+			ctrl := gomock.NewController(t)
+
+			s := &RollUp{
+				cluster: tt.prepareMock(ctrl),
+			}
+
+			got, err := s.Plan(context.Background(), tt.opts)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
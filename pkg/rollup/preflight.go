@@ -0,0 +1,357 @@
+// Copyright 2025 LLC "Ozon Technologies".
+// SPDX-License-Identifier: Apache-2.0
+
+package rollup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/multierr"
+	"golang.org/x/sync/errgroup"
+
+	timeUtils "github.com/ozontech/ch-rollup/internal/utils/time"
+	"github.com/ozontech/ch-rollup/pkg/database"
+	"github.com/ozontech/ch-rollup/pkg/types"
+)
+
+var (
+	errUncoveredColumn           = errors.New("column without default is not set at columns, set it or mark it with isReset")
+	errTimeColumnTypeMismatch    = errors.New("type of time column doesn't match timeColumnType")
+	errStructureMismatch         = errors.New("structure of the table differs from other shards")
+	errExpressionTypeMismatch    = errors.New("type of expression doesn't match type of column")
+	errAggregateFunctionMismatch = errors.New("aggregateFunction doesn't match function of the column")
+	errDescribedColumnsMismatch  = errors.New("described columns don't match columns of roll up statement")
+)
+
+var (
+	// lowCardinalityTypeRegexp matches LowCardinality(T), it's inserted from T.
+	lowCardinalityTypeRegexp = regexp.MustCompile(`^LowCardinality\((.+)\)$`)
+	// numericTypeRegexp matches types that ClickHouse converts to each other on insert.
+	numericTypeRegexp = regexp.MustCompile(`^(U?Int\d+|Float\d+|Decimal.*)$`)
+	// dateTimeTimezoneRegexp matches DateTime('tz') and DateTime64(p, 'tz'), timezone doesn't change stored value.
+	dateTimeTimezoneRegexp = regexp.MustCompile(`^(DateTime|DateTime64\(\d+)(?:\(|,\s*)'[^']*'\)$`)
+)
+
+// tableStructure is columns of tables read and written by roll up, it must be the same on all shards.
+type tableStructure struct {
+	Target []tableColumn
+	// Source is set only when roll up writes to other table.
+	Source []tableColumn
+}
+
+func (s tableStructure) equal(other tableStructure) bool {
+	return slices.Equal(s.Target, other.Target) && slices.Equal(s.Source, other.Source)
+}
+
+func getTableStructureOnShard(ctx context.Context, shard database.Shard, opts RunOptions) (tableStructure, error) {
+	var (
+		result tableStructure
+		err    error
+	)
+
+	targetDatabase, targetTable := opts.targetDatabase(), opts.targetTable()
+
+	if result.Target, err = getTableColumnsOnShard(ctx, shard, targetDatabase, targetTable); err != nil {
+		return tableStructure{}, fmt.Errorf("failed to get columns of %s.%s: %w", targetDatabase, targetTable, err)
+	}
+
+	if opts.inPlace() {
+		return result, nil
+	}
+
+	if result.Source, err = getTableColumnsOnShard(ctx, shard, opts.Database, opts.Table); err != nil {
+		return tableStructure{}, fmt.Errorf("failed to get columns of %s.%s: %w", opts.Database, opts.Table, err)
+	}
+
+	return result, nil
+}
+
+// preflightOnShards checks RunOptions.Columns against tables on all shards before roll up touches data.
+// It returns errors of shards which structure can't be read or differs from the first read one,
+// and error of columns that don't match the structure or which expressions have other type.
+// Columns generated by RunOptions.AutoColumns are set to opts, so all shards roll up the same columns.
+func preflightOnShards(ctx context.Context, shards []database.Shard, opts *RunOptions) ([]error, error) {
+	var (
+		structures  = make([]tableStructure, len(shards))
+		shardErrors = make([]error, len(shards))
+		g           errgroup.Group
+	)
+
+	if opts.MaxParallelShards > 0 {
+		g.SetLimit(opts.MaxParallelShards)
+	}
+
+	for i, shard := range shards {
+		g.Go(func() error {
+			structures[i], shardErrors[i] = getTableStructureOnShard(ctx, shard, *opts)
+			return nil
+		})
+	}
+
+	_ = g.Wait()
+
+	reference := -1
+
+	for i := range shards {
+		if shardErrors[i] != nil {
+			continue
+		}
+
+		if reference < 0 {
+			reference = i
+			continue
+		}
+
+		if !structures[i].equal(structures[reference]) {
+			shardErrors[i] = errStructureMismatch
+		}
+	}
+
+	if reference < 0 {
+		return shardErrors, nil
+	}
+
+	if err := resolveColumns(ctx, shards[reference], opts); err != nil {
+		return shardErrors, err
+	}
+
+	opts.AutoColumns = false
+
+	if err := validateColumnsStructure(*opts, structures[reference]); err != nil {
+		return shardErrors, err
+	}
+
+	if opts.Where != "" && opts.inPlace() {
+		opts.passThroughColumns = insertableColumnNames(structures[reference].Target)
+	}
+
+	opts.countUnsetResolution = opts.ResolutionColumn != "" && (structures[reference].Source == nil ||
+		slices.ContainsFunc(structures[reference].Source, func(column tableColumn) bool { return column.Name == opts.ResolutionColumn }))
+
+	// Statement depends on type of time column, each shard resolves it the same way before roll up.
+	statementOpts := *opts
+	if err := resolveStatementOptions(&statementOpts, structures[reference]); err != nil {
+		return shardErrors, err
+	}
+
+	// Structure is the same on all shards, so are types of expressions.
+	return shardErrors, validateExpressionTypesOnShard(ctx, shards[reference], statementOpts, structures[reference])
+}
+
+// resolveStatementOptions sets type of time column of source table from the structure and location of configured
+// timezone, so roll up statement is described as it will be run.
+func resolveStatementOptions(opts *RunOptions, structure tableStructure) error {
+	source := structure.Source
+	if source == nil {
+		source = structure.Target
+	}
+
+	if opts.TimeColumnType == "" {
+		timeColumnName := getTimeColumnName(opts.Columns)
+
+		index := slices.IndexFunc(source, func(column tableColumn) bool { return column.Name == timeColumnName })
+		if index < 0 {
+			return fmt.Errorf("%w: '%s' of %s.%s", errUnknownColumn, timeColumnName, opts.Database, opts.Table)
+		}
+
+		timeColumnType, err := parseTimeColumnType(source[index].Type)
+		if err != nil {
+			return fmt.Errorf("failed to check time column '%s': %w", timeColumnName, err)
+		}
+
+		opts.TimeColumnType = timeColumnType
+
+		if err = validateTimeColumnInterval(*opts); err != nil {
+			return err
+		}
+	}
+
+	if opts.Timezone != "" && opts.Timezone != types.TimezoneAuto {
+		location, err := time.LoadLocation(opts.Timezone)
+		if err != nil {
+			return fmt.Errorf("failed to load timezone: %w", err)
+		}
+
+		opts.location = location
+	}
+
+	return nil
+}
+
+// validateColumnsStructure checks that columns exist at the tables, all columns without default are covered
+// and time column has supported type.
+func validateColumnsStructure(opts RunOptions, structure tableStructure) error {
+	targetColumns := make(map[string]tableColumn, len(structure.Target))
+	for _, column := range structure.Target {
+		targetColumns[column.Name] = column
+	}
+
+	configured := make(map[string]bool, len(opts.Columns))
+
+	if opts.ResolutionColumn != "" {
+		if err := validateResolutionColumn(opts, targetColumns); err != nil {
+			return err
+		}
+
+		configured[opts.ResolutionColumn] = true
+	}
+
+	for _, column := range opts.Columns {
+		targetColumn, ok := targetColumns[column.Name]
+		if !ok || !targetColumn.insertable() {
+			return fmt.Errorf("%w: '%s' of %s.%s", errUnknownColumn, column.Name, opts.targetDatabase(), opts.targetTable())
+		}
+
+		configured[column.Name] = true
+
+		if column.AggregateFunction != "" {
+			if _, function, ok := columnAggregateFunction(targetColumn.Type); ok && !sameAggregateFunction(function, column.AggregateFunction) {
+				return fmt.Errorf("%w: column '%s' is %s, but %s configured", errAggregateFunctionMismatch, column.Name, targetColumn.Type, column.AggregateFunction)
+			}
+		}
+
+		// Columns without expression are read from source table as is.
+		if structure.Source == nil || column.Expression != "" || column.DerivedFromTime != "" || column.IsReset {
+			continue
+		}
+
+		if !slices.ContainsFunc(structure.Source, func(sourceColumn tableColumn) bool { return sourceColumn.Name == column.Name }) {
+			return fmt.Errorf("%w: '%s' of %s.%s", errUnknownColumn, column.Name, opts.Database, opts.Table)
+		}
+	}
+
+	for _, column := range structure.Target {
+		if column.DefaultKind == "" && !configured[column.Name] {
+			return fmt.Errorf("%w: '%s'", errUncoveredColumn, column.Name)
+		}
+	}
+
+	timeColumn := targetColumns[getTimeColumnName(opts.Columns)]
+
+	timeColumnType, err := parseTimeColumnType(timeColumn.Type)
+	if err != nil {
+		return fmt.Errorf("failed to check time column '%s': %w", timeColumn.Name, err)
+	}
+
+	if opts.TimeColumnType != "" && opts.TimeColumnType != timeColumnType {
+		return fmt.Errorf("%w: '%s' is %s, but %s configured", errTimeColumnTypeMismatch, timeColumn.Name, timeColumn.Type, opts.TimeColumnType)
+	}
+
+	return nil
+}
+
+// sameAggregateFunction reports whether functions with parameters are equal regardless of spaces.
+func sameAggregateFunction(a, b string) bool {
+	return strings.ReplaceAll(a, " ", "") == strings.ReplaceAll(b, " ", "")
+}
+
+// validateExpressionTypesOnShard checks that result type of each column expression at roll up statement
+// matches type of the column at target table. Errors of all columns are returned.
+// Statement is described, so its GROUP BY is checked too and constant expressions have types without rows.
+func validateExpressionTypesOnShard(ctx context.Context, shard database.Shard, opts RunOptions, structure tableStructure) error {
+	// Window isn't known yet, but it doesn't change types of expressions.
+	window := timeUtils.Range{From: time.Unix(0, 0), To: time.Unix(0, 0)}
+	statementOpts := newRollUpStatementOptions(opts, window)
+
+	expressionTypes, err := getStatementColumnTypesOnShard(ctx, shard, generateRollUpDescribeStatement(statementOpts), timeRangeArgs(window, opts)...)
+	if err != nil {
+		return fmt.Errorf("failed to describe roll up statement: %w", err)
+	}
+
+	statementOpts.Columns = withResolutionColumn(statementOpts.Columns, statementOpts)
+
+	// Reset columns aren't selected.
+	columns := slices.DeleteFunc(expandColumnExpressions(statementOpts), func(column types.ColumnSetting) bool { return column.IsReset })
+
+	if len(expressionTypes) != len(columns) {
+		return fmt.Errorf("%w: %d described, %d selected", errDescribedColumnsMismatch, len(expressionTypes), len(columns))
+	}
+
+	var result error
+
+	for i, column := range columns {
+		if column.Expression == "" {
+			continue
+		}
+
+		index := slices.IndexFunc(structure.Target, func(targetColumn tableColumn) bool { return targetColumn.Name == column.Name })
+		if columnType := structure.Target[index].Type; !typesCompatible(expressionTypes[i], columnType) {
+			result = multierr.Append(result, fmt.Errorf("%w: column '%s' is %s, but '%s' is %s", errExpressionTypeMismatch, column.Name, columnType, column.Expression, expressionTypes[i]))
+		}
+	}
+
+	return result
+}
+
+// getStatementColumnTypesOnShard returns types of result columns of DESCRIBE statement in order of columns.
+func getStatementColumnTypesOnShard(ctx context.Context, shard database.Shard, statement string, args ...any) ([]string, error) {
+	rows, err := shard.Query(ctx, statement, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var result []string
+
+	for rows.Next() {
+		var name, columnType string
+
+		if err = rows.Scan(&name, &columnType); err != nil {
+			return nil, err
+		}
+
+		result = append(result, columnType)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// typesCompatible reports whether value of expression type can be inserted to column type.
+// Aggregate function states must be of the same function and arguments, numbers are converted on insert.
+func typesCompatible(expressionType, columnType string) bool {
+	expressionType, columnType = normalizeColumnType(expressionType), normalizeColumnType(columnType)
+	if expressionType == columnType {
+		return true
+	}
+
+	return numericTypeRegexp.MatchString(expressionType) && numericTypeRegexp.MatchString(columnType)
+}
+
+// normalizeColumnType returns type in which values are inserted to the column:
+// LowCardinality(T) and SimpleAggregateFunction(f, T) are inserted from T.
+func normalizeColumnType(columnType string) string {
+	columnType = strings.TrimSpace(columnType)
+
+	if match := dateTimeTimezoneRegexp.FindStringSubmatch(columnType); match != nil {
+		if match[1] == "DateTime" {
+			return match[1]
+		}
+
+		return match[1] + ")"
+	}
+
+	if match := lowCardinalityTypeRegexp.FindStringSubmatch(columnType); match != nil {
+		return normalizeColumnType(match[1])
+	}
+
+	if match := aggregateFunctionTypeRegexp.FindStringSubmatch(columnType); match != nil && match[1] == "SimpleAggregateFunction" {
+		if args := splitTopLevel(match[2]); len(args) > 1 {
+			return normalizeColumnType(args[len(args)-1])
+		}
+	}
+
+	return columnType
+}
@@ -0,0 +1,450 @@
+// Copyright 2025 LLC "Ozon Technologies".
+// SPDX-License-Identifier: Apache-2.0
+
+package rollup
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	"github.com/ozontech/ch-rollup/pkg/database"
+	"github.com/ozontech/ch-rollup/pkg/database/mock"
+	"github.com/ozontech/ch-rollup/pkg/types"
+)
+
+func Test_validateColumnsStructure(t *testing.T) {
+	t.Parallel()
+
+	testColumns := []types.ColumnSetting{
+		{Name: "service"},
+		{Name: "hits", Expression: "countMergeState(hits)"},
+		{Name: "event_time", IsRollUpTime: true},
+	}
+
+	testTarget := []tableColumn{
+		{Name: "service", Type: "String"},
+		{Name: "hits", Type: "AggregateFunction(count)"},
+		{Name: "event_time", Type: "DateTime"},
+		{Name: "inserted_at", Type: "DateTime", DefaultKind: "DEFAULT"},
+		{Name: "hour", Type: "UInt8", DefaultKind: "MATERIALIZED"},
+	}
+
+	tests := []struct {
+		name       string
+		columns    []types.ColumnSetting
+		target     []tableColumn
+		source     []tableColumn
+		timeType   types.TimeColumnType
+		resolution string
+		wantErr    error
+	}{
+		{
+			name:    "Ok",
+			columns: testColumns,
+			target:  testTarget,
+		},
+		{
+			name:    "Ok reset column",
+			columns: append(testColumns, types.ColumnSetting{Name: "request_id", IsReset: true}),
+			target:  append(testTarget, tableColumn{Name: "request_id", Type: "UUID"}),
+		},
+		{
+			name:    "Ok source",
+			columns: testColumns,
+			target:  testTarget,
+			source: []tableColumn{
+				{Name: "service", Type: "String"},
+				{Name: "hits", Type: "UInt64"},
+				{Name: "event_time", Type: "DateTime"},
+			},
+		},
+		{
+			name: "Ok aggregate function",
+			columns: []types.ColumnSetting{
+				{Name: "service"},
+				types.MergeState("hits", "count"),
+				{Name: "event_time", IsRollUpTime: true},
+			},
+			target: testTarget,
+		},
+		{
+			name: "Aggregate function mismatch",
+			columns: []types.ColumnSetting{
+				{Name: "service"},
+				types.MergeState("hits", "sum"),
+				{Name: "event_time", IsRollUpTime: true},
+			},
+			target:  testTarget,
+			wantErr: errAggregateFunctionMismatch,
+		},
+		{
+			name:       "Ok resolution column",
+			columns:    testColumns,
+			target:     append(testTarget, tableColumn{Name: "rollup_interval", Type: "UInt32"}),
+			resolution: "rollup_interval",
+		},
+		{
+			name:       "Bad resolution column type",
+			columns:    testColumns,
+			target:     append(testTarget, tableColumn{Name: "rollup_interval", Type: "String"}),
+			resolution: "rollup_interval",
+			wantErr:    errResolutionColumnType,
+		},
+		{
+			name:    "Unknown column",
+			columns: append(testColumns, types.ColumnSetting{Name: "unknown"}),
+			target:  testTarget,
+			wantErr: errUnknownColumn,
+		},
+		{
+			name:    "Materialized column",
+			columns: append(testColumns, types.ColumnSetting{Name: "hour"}),
+			target:  testTarget,
+			wantErr: errUnknownColumn,
+		},
+		{
+			name:    "Unknown source column",
+			columns: testColumns,
+			target:  testTarget,
+			source: []tableColumn{
+				{Name: "hits", Type: "UInt64"},
+				{Name: "event_time", Type: "DateTime"},
+			},
+			wantErr: errUnknownColumn,
+		},
+		{
+			name:    "Uncovered column",
+			columns: testColumns,
+			target:  append(testTarget, tableColumn{Name: "request_id", Type: "UUID"}),
+			wantErr: errUncoveredColumn,
+		},
+		{
+			name: "Unsupported time column",
+			columns: []types.ColumnSetting{
+				{Name: "service", IsRollUpTime: true},
+				{Name: "hits", Expression: "countMergeState(hits)"},
+				{Name: "event_time"},
+			},
+			target:  testTarget,
+			wantErr: errUnsupportedTimeColumnType,
+		},
+		{
+			name:     "Time column type mismatch",
+			columns:  testColumns,
+			target:   testTarget,
+			timeType: types.TimeColumnDate,
+			wantErr:  errTimeColumnTypeMismatch,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			opts := RunOptions{
+				Database:         "test_database",
+				Table:            "test_table",
+				Columns:          tt.columns,
+				TimeColumnType:   tt.timeType,
+				ResolutionColumn: tt.resolution,
+			}
+
+			err := validateColumnsStructure(opts, tableStructure{Target: tt.target, Source: tt.source})
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func Test_preflightOnShards(t *testing.T) {
+	t.Parallel()
+
+	const (
+		testDatabase = "test_database"
+		testTable    = "test_table"
+	)
+
+	testColumns := []types.ColumnSetting{
+		{Name: "service"},
+		{Name: "event_time", IsRollUpTime: true},
+	}
+
+	tests := []struct {
+		name            string
+		prepareMock     func(ctrl *gomock.Controller) []database.Shard
+		wantShardErrors []bool
+		wantErr         bool
+	}{
+		{
+			name: "Ok",
+			prepareMock: func(ctrl *gomock.Controller) []database.Shard {
+				firstShardMock, secondShardMock := mock.NewMockShard(ctrl), mock.NewMockShard(ctrl)
+
+				expectTableColumns(ctrl, firstShardMock, testDatabase, testTable, testColumns)
+				expectTableColumns(ctrl, secondShardMock, testDatabase, testTable, testColumns)
+				expectExpressionTypes(ctrl, firstShardMock, testDatabase, testTable, testColumns)
+
+				return []database.Shard{firstShardMock, secondShardMock}
+			},
+			wantShardErrors: []bool{false, false},
+		},
+		{
+			name: "Structure mismatch",
+			prepareMock: func(ctrl *gomock.Controller) []database.Shard {
+				firstShardMock, secondShardMock := mock.NewMockShard(ctrl), mock.NewMockShard(ctrl)
+
+				expectTableColumns(ctrl, firstShardMock, testDatabase, testTable, testColumns)
+				expectTableColumns(ctrl, secondShardMock, testDatabase, testTable, append(testColumns, types.ColumnSetting{Name: "added"}))
+				expectExpressionTypes(ctrl, firstShardMock, testDatabase, testTable, testColumns)
+
+				return []database.Shard{firstShardMock, secondShardMock}
+			},
+			wantShardErrors: []bool{false, true},
+		},
+		{
+			name: "Failed to get structure",
+			prepareMock: func(ctrl *gomock.Controller) []database.Shard {
+				firstShardMock, secondShardMock := mock.NewMockShard(ctrl), mock.NewMockShard(ctrl)
+
+				firstShardMock.EXPECT().Query(gomock.Any(), gomock.Any(), testDatabase, testTable).Return(nil, errors.New("test"))
+				expectTableColumns(ctrl, secondShardMock, testDatabase, testTable, testColumns)
+				expectExpressionTypes(ctrl, secondShardMock, testDatabase, testTable, testColumns)
+
+				return []database.Shard{firstShardMock, secondShardMock}
+			},
+			wantShardErrors: []bool{true, false},
+		},
+		{
+			name: "Bad columns",
+			prepareMock: func(ctrl *gomock.Controller) []database.Shard {
+				shardMock := mock.NewMockShard(ctrl)
+
+				expectTableColumns(ctrl, shardMock, testDatabase, testTable, append(testColumns, types.ColumnSetting{Name: "lost"}))
+
+				return []database.Shard{shardMock}
+			},
+			wantShardErrors: []bool{false},
+			wantErr:         true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctrl := gomock.NewController(t)
+
+			opts := RunOptions{
+				Database: testDatabase,
+				Table:    testTable,
+				Columns:  testColumns,
+			}
+
+			shardErrors, err := preflightOnShards(context.Background(), tt.prepareMock(ctrl), &opts)
+			assert.Equal(t, tt.wantErr, err != nil)
+
+			gotShardErrors := make([]bool, len(shardErrors))
+			for i, shardErr := range shardErrors {
+				gotShardErrors[i] = shardErr != nil
+			}
+
+			assert.Equal(t, tt.wantShardErrors, gotShardErrors)
+		})
+	}
+}
+
+func Test_typesCompatible(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		expressionType string
+		columnType     string
+		want           bool
+	}{
+		{
+			name:           "Same aggregate function",
+			expressionType: "AggregateFunction(count)",
+			columnType:     "AggregateFunction(count)",
+			want:           true,
+		},
+		{
+			name:           "Other aggregate function",
+			expressionType: "AggregateFunction(sum, UInt64)",
+			columnType:     "AggregateFunction(count)",
+		},
+		{
+			name:           "Simple aggregate function",
+			expressionType: "UInt64",
+			columnType:     "SimpleAggregateFunction(sum, UInt64)",
+			want:           true,
+		},
+		{
+			name:           "Low cardinality",
+			expressionType: "String",
+			columnType:     "LowCardinality(String)",
+			want:           true,
+		},
+		{
+			name:           "Numbers",
+			expressionType: "UInt64",
+			columnType:     "Float64",
+			want:           true,
+		},
+		{
+			name:           "DateTime with timezone",
+			expressionType: "DateTime('Europe/Moscow')",
+			columnType:     "DateTime",
+			want:           true,
+		},
+		{
+			name:           "DateTime64 with timezone",
+			expressionType: "DateTime64(3, 'UTC')",
+			columnType:     "DateTime64(3)",
+			want:           true,
+		},
+		{
+			name:           "DateTime64 of other precision",
+			expressionType: "DateTime64(6, 'UTC')",
+			columnType:     "DateTime64(3)",
+		},
+		{
+			name:           "String to number",
+			expressionType: "String",
+			columnType:     "UInt64",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, typesCompatible(tt.expressionType, tt.columnType))
+		})
+	}
+}
+
+func Test_validateExpressionTypesOnShard(t *testing.T) {
+	t.Parallel()
+
+	const (
+		testDatabase = "test_database"
+		testTable    = "test_table"
+	)
+
+	errTest := errors.New("test")
+
+	testColumns := []types.ColumnSetting{
+		{Name: "service"},
+		{Name: "hits", Expression: "countStateMerge(hits)"},
+		{Name: "bytes", Expression: "sum(bytes)"},
+		{Name: "event_time", IsRollUpTime: true},
+	}
+
+	testStructure := tableStructure{
+		Target: []tableColumn{
+			{Name: "service", Type: "String"},
+			{Name: "hits", Type: "AggregateFunction(count)"},
+			{Name: "bytes", Type: "SimpleAggregateFunction(sum, UInt64)"},
+			{Name: "event_time", Type: "DateTime"},
+			{Name: "request_id", Type: "UUID"},
+			{Name: "tier", Type: "LowCardinality(String)"},
+			{Name: "window_from", Type: "DateTime"},
+			{Name: "interval_sec", Type: "UInt32"},
+			{Name: "rollup_interval", Type: "UInt32"},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		columns    []types.ColumnSetting
+		resolution string
+		// described are types of selected columns returned by DESCRIBE.
+		described   []string
+		describeErr error
+		wantErr     error
+	}{
+		{
+			name:      "Ok",
+			columns:   testColumns,
+			described: []string{"String", "AggregateFunction(count)", "UInt64", "DateTime"},
+		},
+		{
+			name: "Ok constants and reset column",
+			columns: append(
+				slices.Clone(testColumns),
+				types.ColumnSetting{Name: "request_id", IsReset: true},
+				types.Constant("tier", "low"),
+				types.ColumnSetting{Name: "window_from", Expression: types.PlaceholderWindowFrom},
+				types.ColumnSetting{Name: "interval_sec", Expression: types.PlaceholderIntervalSec},
+			),
+			resolution: "rollup_interval",
+			// Table has no rows, but constants are described without them.
+			described: []string{"String", "AggregateFunction(count)", "UInt64", "DateTime", "String", "DateTime('UTC')", "UInt16", "UInt16"},
+		},
+		{
+			name:      "Type mismatch",
+			columns:   testColumns,
+			described: []string{"String", "UInt64", "UInt64", "DateTime"},
+			wantErr:   errExpressionTypeMismatch,
+		},
+		{
+			name:      "Described columns mismatch",
+			columns:   testColumns,
+			described: []string{"String", "AggregateFunction(count)", "UInt64"},
+			wantErr:   errDescribedColumnsMismatch,
+		},
+		{
+			// Server rejects statement where column is neither aggregated nor a key of GROUP BY.
+			name: "Failed to describe",
+			columns: append(
+				slices.Clone(testColumns),
+				types.ColumnSetting{Name: "interval_sec", Expression: "interval_sec"},
+			),
+			describeErr: errTest,
+			wantErr:     errTest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctrl := gomock.NewController(t)
+
+			shardMock := mock.NewMockShard(ctrl)
+
+			if tt.describeErr != nil {
+				shardMock.EXPECT().Query(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, tt.describeErr)
+			} else {
+				rowsMock := mock.NewMockRows(ctrl)
+
+				for _, columnType := range tt.described {
+					rowsMock.EXPECT().Next().Return(true)
+					rowsMock.EXPECT().Scan(gomock.Any(), gomock.Any()).DoAndReturn(func(dest ...any) error {
+						*dest[1].(*string) = columnType
+
+						return nil
+					})
+				}
+
+				rowsMock.EXPECT().Next()
+				rowsMock.EXPECT().Err()
+				rowsMock.EXPECT().Close()
+
+				shardMock.EXPECT().Query(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(rowsMock, nil)
+			}
+
+			opts := RunOptions{
+				Database:         testDatabase,
+				Table:            testTable,
+				Interval:         time.Hour,
+				Columns:          tt.columns,
+				ResolutionColumn: tt.resolution,
+			}
+
+			err := validateExpressionTypesOnShard(context.Background(), shardMock, opts, testStructure)
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
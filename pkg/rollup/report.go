@@ -0,0 +1,97 @@
+// Copyright 2025 LLC "Ozon Technologies".
+// SPDX-License-Identifier: Apache-2.0
+
+package rollup
+
+import (
+	"time"
+
+	"github.com/ozontech/ch-rollup/pkg/types"
+)
+
+//go:generate go run github.com/alvaroloes/enumer -type=Stage -trimprefix=Stage -output=stage_enum.go
+
+// Stage of roll up on shard.
+type Stage uint8
+
+const (
+	// StagePrepare is reading meta info and creating temp table.
+	StagePrepare Stage = iota + 1
+	// StageCopy is copying rolled up data to temp table.
+	StageCopy
+	// StageReplace is replacing partitions of origin table with partitions of temp table.
+	StageReplace
+	// StageCommit is saving meta info.
+	StageCommit
+	// StageVerify is checking rolled up data before replacing partitions.
+	StageVerify
+)
+
+// Report describes result of Run.
+type Report struct {
+	Database string
+	Table    string
+	After    time.Duration
+	Interval time.Duration
+	// CalendarInterval is set instead of Interval for roll up in calendar units.
+	CalendarInterval types.CalendarInterval
+	// TargetDatabase and TargetTable are set when rolled up data is written to other table.
+	TargetDatabase string
+	TargetTable    string
+	// RunID identifies backups of the run for Restore and records of RunRange at audit log.
+	// It's set only when RunOptions.BackupRetention is set or by RunRange.
+	RunID  string
+	Shards []ShardReport
+}
+
+// ShardReport describes result of Run on the shard.
+type ShardReport struct {
+	Shard string
+	// FirstRun is set when there was no meta info for the roll up on the shard,
+	// so only starting point was saved.
+	FirstRun bool
+	// Skipped is set when data was not touched: it's already rolled up or it's FirstRun.
+	Skipped bool
+	// Window is a rolled up time range.
+	Window TimeRange
+	// RowsRead is a number of rows at replaced partitions of origin table before roll up.
+	// For roll up to other table it's a number of rows of the source table in Window.
+	RowsRead uint64
+	// RowsWritten is a number of rows at replaced partitions of origin table after roll up.
+	RowsWritten uint64
+	// BytesBefore is a size of replaced partitions on disk before roll up.
+	// For roll up to other table it's a size of source table partitions with data of Window.
+	BytesBefore uint64
+	// BytesAfter is a size of replaced partitions on disk after roll up.
+	BytesAfter uint64
+	// Partitions are replaced partitions.
+	Partitions []string
+	// Checks are calculated values of RunOptions.Checks.
+	Checks []CheckResult
+	// BackupTable keeps replaced partitions of origin table until RunOptions.BackupRetention expires.
+	BackupTable string
+	// DroppedPartitions are partitions of source table dropped by RunOptions.DropSourceAfter.
+	DroppedPartitions []string
+	// UnsetResolutionRows is a number of rolled up source rows with zero RunOptions.ResolutionColumn,
+	// they were inserted without setting it.
+	UnsetResolutionRows uint64
+	// Durations of roll up stages.
+	Durations map[Stage]time.Duration
+}
+
+func newShardReport(shardName string) ShardReport {
+	return ShardReport{
+		Shard:     shardName,
+		Durations: make(map[Stage]time.Duration),
+	}
+}
+
+// measure starts measuring of stage duration.
+// Returned func adds duration since measure call to the stage duration.
+func (r *ShardReport) measure(stage Stage) func() {
+	start := timeNow()
+
+	return func() {
+		r.Durations[stage] += timeNow().Sub(start)
+	}
+}
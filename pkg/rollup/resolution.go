@@ -0,0 +1,90 @@
+// Copyright 2025 LLC "Ozon Technologies".
+// SPDX-License-Identifier: Apache-2.0
+
+package rollup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/huandu/go-sqlbuilder"
+
+	sqlUtils "github.com/ozontech/ch-rollup/internal/utils/sql"
+	timeUtils "github.com/ozontech/ch-rollup/internal/utils/time"
+	"github.com/ozontech/ch-rollup/pkg/database"
+	"github.com/ozontech/ch-rollup/pkg/types"
+)
+
+var (
+	errResolutionColumnConfigured = errors.New("resolutionColumn is filled by roll up, it must not be set at columns")
+	errResolutionColumnType       = errors.New("resolutionColumn must be Int32, UInt32, Int64 or UInt64")
+)
+
+// resolutionColumnTypeRegexp matches types that fit seconds of any roll up interval.
+var resolutionColumnTypeRegexp = regexp.MustCompile(`^U?Int(32|64)$`)
+
+// withResolutionColumn returns columns of the statement with resolution column, which gets length of roll up interval in seconds.
+// Length of calendar interval is calculated for each rolled up row, because months and years have uneven length.
+func withResolutionColumn(columns []types.ColumnSetting, opts generateRollUpStatementOptions) []types.ColumnSetting {
+	if opts.ResolutionColumn == "" {
+		return columns
+	}
+
+	expression := strconv.Itoa(timeUtils.SecondsFromDuration(opts.Interval))
+
+	if !opts.CalendarInterval.IsZero() {
+		bucket := generateBucketTimeStatement(sqlUtils.QuotedDatabaseEntity(opts.FromTable, getTimeColumnName(columns)), opts)
+
+		expression = fmt.Sprintf(
+			"dateDiff('second', %s, %s + INTERVAL %d %s)",
+			bucket,
+			bucket,
+			opts.CalendarInterval.Units(),
+			strings.ToUpper(string(opts.CalendarInterval.Unit)),
+		)
+	}
+
+	return append(slices.Clone(columns), types.ColumnSetting{
+		Name:       opts.ResolutionColumn,
+		Expression: expression,
+	})
+}
+
+// validateResolutionColumn checks that resolution column is insertable and its type fits seconds of roll up interval.
+func validateResolutionColumn(opts RunOptions, targetColumns map[string]tableColumn) error {
+	column, ok := targetColumns[opts.ResolutionColumn]
+	if !ok || !column.insertable() {
+		return fmt.Errorf("%w: '%s' of %s.%s", errUnknownColumn, opts.ResolutionColumn, opts.targetDatabase(), opts.targetTable())
+	}
+
+	if !resolutionColumnTypeRegexp.MatchString(normalizeColumnType(column.Type)) {
+		return fmt.Errorf("%w: '%s' is %s", errResolutionColumnType, column.Name, column.Type)
+	}
+
+	return nil
+}
+
+// countUnsetResolutionOnShard returns number of source rows of the window with zero resolution column,
+// they were inserted without setting it.
+func countUnsetResolutionOnShard(ctx context.Context, shard database.Shard, opts RunOptions, window timeUtils.Range) (uint64, error) {
+	sb := sqlbuilder.NewSelectBuilder()
+	sb.Select("count()")
+	sb.From(sqlUtils.QuotedDatabaseEntity(opts.Database, opts.Table))
+	sb.Where(generateTimeRangeConditions(sb, opts.Table, opts.Columns, opts.location, timeRangeArgs(window, opts))...)
+	sb.Where(sb.Equal(sqlUtils.QuotedDatabaseEntity(opts.Table, opts.ResolutionColumn), 0))
+
+	sql, args := sb.BuildWithFlavor(sqlbuilder.ClickHouse)
+
+	var result uint64
+
+	if err := shard.QueryRow(ctx, sql, args...).Scan(&result); err != nil {
+		return 0, fmt.Errorf("failed to count rows without %s at %s.%s: %w", opts.ResolutionColumn, opts.Database, opts.Table, err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,125 @@
+// Copyright 2025 LLC "Ozon Technologies".
+// SPDX-License-Identifier: Apache-2.0
+
+package rollup
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	timeUtils "github.com/ozontech/ch-rollup/internal/utils/time"
+	"github.com/ozontech/ch-rollup/pkg/database/mock"
+	"github.com/ozontech/ch-rollup/pkg/types"
+)
+
+func Test_validateResolutionColumn(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		column  tableColumn
+		wantErr error
+	}{
+		{
+			name:   "Ok",
+			column: tableColumn{Name: "rollup_interval", Type: "UInt32"},
+		},
+		{
+			name:   "Ok with default",
+			column: tableColumn{Name: "rollup_interval", Type: "Int64", DefaultKind: "DEFAULT"},
+		},
+		{
+			name:    "Too small type",
+			column:  tableColumn{Name: "rollup_interval", Type: "UInt16"},
+			wantErr: errResolutionColumnType,
+		},
+		{
+			name:    "Materialized",
+			column:  tableColumn{Name: "rollup_interval", Type: "UInt32", DefaultKind: "MATERIALIZED"},
+			wantErr: errUnknownColumn,
+		},
+		{
+			name:    "Not found",
+			column:  tableColumn{Name: "other", Type: "UInt32"},
+			wantErr: errUnknownColumn,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			opts := RunOptions{
+				Database:         "test_database",
+				Table:            "test_table",
+				ResolutionColumn: "rollup_interval",
+			}
+
+			err := validateResolutionColumn(opts, map[string]tableColumn{tt.column.Name: tt.column})
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func Test_countUnsetResolutionOnShard(t *testing.T) {
+	t.Parallel()
+
+	const query = `SELECT count() FROM "test_database"."test_table" WHERE "test_table"."event_time" >= ? AND "test_table"."event_time" < ? AND "test_table"."rollup_interval" = ?`
+
+	window := timeUtils.Range{
+		From: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:   time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC),
+	}
+
+	tests := []struct {
+		name        string
+		prepareMock func(rowMock *mock.MockRow)
+		want        uint64
+		wantErr     bool
+	}{
+		{
+			name: "Ok",
+			prepareMock: func(rowMock *mock.MockRow) {
+				rowMock.EXPECT().Scan(gomock.Any()).SetArg(0, uint64(42))
+			},
+			want: 42,
+		},
+		{
+			name: "Failed to count",
+			prepareMock: func(rowMock *mock.MockRow) {
+				rowMock.EXPECT().Scan(gomock.Any()).Return(errors.New("test"))
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctrl := gomock.NewController(t)
+
+			rowMock := mock.NewMockRow(ctrl)
+			tt.prepareMock(rowMock)
+
+			shardMock := mock.NewMockShard(ctrl)
+			shardMock.EXPECT().QueryRow(gomock.Any(), query, window.From, window.To, 0).Return(rowMock)
+
+			opts := RunOptions{
+				Database: "test_database",
+				Table:    "test_table",
+				Columns: []types.ColumnSetting{
+					{Name: "event_time", IsRollUpTime: true},
+				},
+				ResolutionColumn: "rollup_interval",
+			}
+
+			got, err := countUnsetResolutionOnShard(context.Background(), shardMock, opts, window)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
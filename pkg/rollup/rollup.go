@@ -6,9 +6,12 @@ package rollup
 
 import (
 	"context"
-	"database/sql"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"golang.org/x/sync/errgroup"
@@ -27,14 +30,27 @@ const (
 				table String,
 				after_sec UInt64,
 				interval_sec UInt64,
-				roll_ups_at DateTime
-			) ENGINE = MergeTree() ORDER BY (database, table, after_sec, interval_sec, roll_ups_at);
+				roll_ups_at DateTime,
+				interval_calendar String DEFAULT ''
+			) ENGINE = %s ORDER BY (database, table, after_sec, interval_sec, roll_ups_at);
 	`
 )
 
+const (
+	// replicationPathPrefix is a prefix of temp tables replication path at ClickHouse Keeper.
+	replicationPathPrefix = "/clickhouse/ch-rollup"
+)
+
 var (
 	// timeNow used for testing reasons.
 	timeNow = time.Now
+	// newUniqueID used for testing reasons.
+	newUniqueID = func() string {
+		id := make([]byte, 8)
+		_, _ = rand.Read(id)
+
+		return hex.EncodeToString(id)
+	}
 )
 
 // RollUp ...
@@ -51,32 +67,122 @@ func New(cluster database.Cluster) *RollUp {
 
 // RunOptions ...
 type RunOptions struct {
-	Database     string
-	Table        string
-	TempTable    string
+	Database  string
+	Table     string
+	TempTable string
+	// PartitionKey is a partition granularity of the table. If it's not set, it's inferred from partition key of the table,
+	// otherwise it's checked against it.
 	PartitionKey time.Duration
-	Columns      []types.ColumnSetting
-	Interval     time.Duration
-	After        time.Duration
-	CopyInterval time.Duration
+	// CalendarPartitionKey is a partition granularity of the table in calendar units. Can't be set with PartitionKey.
+	CalendarPartitionKey types.CalendarInterval
+	Columns              []types.ColumnSetting
+	Interval             time.Duration
+	// CalendarInterval is a roll up interval in calendar units. It must be set instead of Interval.
+	CalendarInterval types.CalendarInterval
+	After            time.Duration
+	CopyInterval     time.Duration
+	// Replicated must be set for Replicated*MergeTree tables, it's checked against engine of the table.
+	// Temp table will be created with unique replication path, REPLACE PARTITION will wait for all replicas
+	// and service tables will be replicated between replicas of the shard.
+	Replicated bool
+	// ContinueOnShardError makes each shard run to completion regardless of failures on other shards.
+	// In this case Run returns ShardErrors with errors of all failed shards.
+	ContinueOnShardError bool
+	// MaxParallelShards limits number of shards rolled up at the same time. Default: no limit.
+	MaxParallelShards int
+	// MaxParallelCopies limits number of copy intervals copied at the same time on each shard. Default: 1.
+	MaxParallelCopies int
+	// Checks of rolled up data. If any check fails, origin partitions are not replaced and Run returns ErrCheckFailed.
+	Checks []types.Check
+	// CheckTimeBounds makes sure that rolled up time is inside of roll up window before replacing partitions.
+	CheckTimeBounds bool
+	// BackupRetention enables backup of replaced partitions: they are copied to the backup table of the run
+	// and can be put back by Restore until retention expires. Expired backups are dropped by next Run.
+	BackupRetention time.Duration
+	// CommitPerPartition makes roll up copy, replace and commit to meta info one partition at a time,
+	// so interrupted roll up resumes from the first uncommitted partition.
+	CommitPerPartition bool
+	// Timezone in which table is partitioned. Roll up windows are aligned to partitions boundaries in it.
+	// It's IANA name or types.TimezoneAuto to detect it from time column type or server settings.
+	// Default: timezone argument of partition key of the table, if it's set there, otherwise UTC.
+	// Without both, roll up fails if time column or server timezone isn't UTC, so windows don't cross partitions.
+	Timezone string
+
+	// TimeColumnType is a type of time column. If it's not set, it's detected from system.columns.
+	TimeColumnType types.TimeColumnType
+	// TargetDatabase and TargetTable define the table which partitions are replaced by rolled up data. Default: Database and Table.
+	// Temp table is created as target table in target database. Partition key, meta info and backups are of target table.
+	TargetDatabase string
+	TargetTable    string
+	// DropSourceAfter drops partitions of source table older than the duration, once they are rolled up to target table.
+	// It can be set only with TargetDatabase or TargetTable.
+	DropSourceAfter time.Duration
+	// Where is a predicate of rows to roll up, other rows of the window are copied to temp table as is.
+	// Time column is replaced by rolled up time in it, so it must be qualified by table, like "table"."time".
+	Where string
+	// AutoColumns makes Columns to be generated from schema of target table: sorting key columns are grouped by,
+	// AggregateFunction and SimpleAggregateFunction columns get their functions and time column is detected from sorting key.
+	// Columns override generated ones.
+	AutoColumns bool
+	// AllowedFunctions restricts functions of Columns, Checks and Where expressions, aggregate functions are allowed with combinators.
+	// Default: any function except table functions and functions that read other tables.
+	AllowedFunctions []string
+	// ResolutionColumn is filled with length of roll up interval in seconds at rolled up rows. It must not be set at Columns.
+	// Source rows of the window with zero value of it are counted at ShardReport.UnsetResolutionRows.
+	ResolutionColumn string
+	// StartFrom defines where roll ups start when there is no meta info of the roll up yet. Default: types.StartFromNow.
+	// With types.StartFromEarliestPartition data that already exists is rolled up by next runs.
+	StartFrom types.StartFrom
+	// StartTime is a start of roll ups with types.StartFromTime, it's truncated to partition.
+	StartTime time.Time
+
+	// location is resolved Timezone, nil means UTC.
+	location *time.Location
+	// partitionTimezone is a timezone argument of partition key of the table, if it's set there.
+	partitionTimezone string
+	// timeColumnDataType is a ClickHouse type of time column, if it's read by resolveTimeColumnType.
+	timeColumnDataType string
+	// countUnsetResolution is set when source table has ResolutionColumn.
+	countUnsetResolution bool
+	// passThroughColumns are insertable columns of the table copied as is for rows that don't match Where.
+	// They are set only for in place roll up with Where.
+	passThroughColumns []string
+	// window is set by RunRange, it's rolled up instead of the window after latest roll up of meta info.
+	window *timeUtils.Range
 }
 
 const (
-	defaultCopyInterval = time.Hour
+	defaultCopyInterval      = time.Hour
+	defaultMaxParallelCopies = 1
 )
 
 func (opts *RunOptions) setDefaults() {
 	if opts.CopyInterval <= 0 {
 		opts.CopyInterval = defaultCopyInterval
 	}
+
+	if opts.MaxParallelCopies == 0 {
+		opts.MaxParallelCopies = defaultMaxParallelCopies
+	}
 }
 
 var (
-	errBadPartitionKey    = errors.New("partitionKey must be greater then 0")
-	errBadInterval        = errors.New("interval must be greater then 0")
-	errBadAfter           = errors.New("after must be greater then 0")
-	errBadCopyInterval    = errors.New("copyInterval must be greater then 0")
-	errTimeColumnNotFound = errors.New("you must specify column with isRollUpTime option")
+	errBadPartitionKey     = errors.New("partitionKey must not be negative")
+	errBadInterval         = errors.New("interval must be greater then 0")
+	errBadAfter            = errors.New("after must be greater then 0")
+	errBadCopyInterval     = errors.New("copyInterval must be greater then 0")
+	errTimeColumnNotFound  = errors.New("you must specify column with isRollUpTime option")
+	errBadMaxParallel      = errors.New("maxParallelShards and maxParallelCopies must not be negative")
+	errBadBackupRetention  = errors.New("backupRetention must not be negative")
+	errManyPartitionKeys   = errors.New("only one of partitionKey and calendarPartitionKey allowed")
+	errManyIntervals       = errors.New("only one of interval and calendarInterval allowed")
+	errBadDropSourceAfter  = errors.New("dropSourceAfter must not be negative")
+	errDropSourceInPlace   = errors.New("dropSourceAfter can be set only with target table")
+	errCalendarIntervalSec = errors.New(types.PlaceholderIntervalSec + " can't be used with calendarInterval")
+	errStartTimeRequired   = errors.New("startTime must be set with startFrom 'time'")
+	errStartTimeNotAllowed = errors.New("startTime can be set only with startFrom 'time'")
+	errWindowNotAligned    = errors.New("from and to must be aligned to partitions")
+	errLatestNotAligned    = errors.New("latest roll up of meta info is not aligned to partitions, timezone may be changed after it")
 )
 
 func (opts *RunOptions) validate() error {
@@ -92,12 +198,48 @@ func (opts *RunOptions) validate() error {
 		return fmt.Errorf("failed to validate tempTable name: %w", err)
 	}
 
-	if opts.PartitionKey <= 0 {
+	if err := sqlUtils.ValidateEntityName(opts.targetDatabase()); err != nil {
+		return fmt.Errorf("failed to validate targetDatabase: %w", err)
+	}
+
+	if err := sqlUtils.ValidateEntityName(opts.targetTable()); err != nil {
+		return fmt.Errorf("failed to validate targetTable name: %w", err)
+	}
+
+	if opts.DropSourceAfter < 0 {
+		return errBadDropSourceAfter
+	}
+
+	if opts.DropSourceAfter > 0 && opts.inPlace() {
+		return errDropSourceInPlace
+	}
+
+	if opts.PartitionKey < 0 {
 		return errBadPartitionKey
 	}
 
-	if opts.Interval <= 0 {
-		return errBadInterval
+	if !opts.CalendarPartitionKey.IsZero() {
+		if opts.PartitionKey != 0 {
+			return errManyPartitionKeys
+		}
+
+		if err := opts.CalendarPartitionKey.Validate(); err != nil {
+			return fmt.Errorf("failed to validate calendarPartitionKey: %w", err)
+		}
+	}
+
+	if opts.CalendarInterval.IsZero() {
+		if opts.Interval <= 0 {
+			return errBadInterval
+		}
+	} else {
+		if opts.Interval != 0 {
+			return errManyIntervals
+		}
+
+		if err := opts.CalendarInterval.Validate(); err != nil {
+			return fmt.Errorf("failed to validate calendarInterval: %w", err)
+		}
 	}
 
 	if opts.After <= 0 {
@@ -108,91 +250,336 @@ func (opts *RunOptions) validate() error {
 		return errBadCopyInterval
 	}
 
+	if opts.MaxParallelShards < 0 || opts.MaxParallelCopies < 0 {
+		return errBadMaxParallel
+	}
+
+	if opts.BackupRetention < 0 {
+		return errBadBackupRetention
+	}
+
+	if opts.Timezone != "" && opts.Timezone != types.TimezoneAuto {
+		if _, err := time.LoadLocation(opts.Timezone); err != nil {
+			return fmt.Errorf("failed to validate timezone: %w", err)
+		}
+	}
+
+	if opts.window != nil && !opts.window.From.Before(opts.window.To) {
+		return errBadTimeRange
+	}
+
+	if opts.StartFrom != "" {
+		if err := opts.StartFrom.Validate(); err != nil {
+			return fmt.Errorf("failed to validate startFrom: %w", err)
+		}
+	}
+
+	if opts.StartFrom == types.StartFromTime && opts.StartTime.IsZero() {
+		return errStartTimeRequired
+	}
+
+	if opts.StartFrom != types.StartFromTime && !opts.StartTime.IsZero() {
+		return errStartTimeNotAllowed
+	}
+
+	if opts.TimeColumnType != "" {
+		if err := opts.TimeColumnType.Validate(); err != nil {
+			return fmt.Errorf("failed to validate timeColumnType: %w", err)
+		}
+
+		if err := validateTimeColumnInterval(*opts); err != nil {
+			return err
+		}
+	}
+
 	for index, column := range opts.Columns {
 		if err := column.Validate(); err != nil {
 			return fmt.Errorf("failed to validate column with index %d: %w", index, err)
 		}
+
+		if column.Expression != "" {
+			if err := opts.validateColumnExpression(column.Expression); err != nil {
+				return fmt.Errorf("failed to validate expression of column with index %d: %w", index, err)
+			}
+		}
 	}
 
-	if timeColumnName := getTimeColumnName(opts.Columns); timeColumnName == "" {
+	if opts.ResolutionColumn != "" {
+		if err := sqlUtils.ValidateEntityName(opts.ResolutionColumn); err != nil {
+			return fmt.Errorf("failed to validate resolutionColumn: %w", err)
+		}
+
+		if slices.ContainsFunc(opts.Columns, func(column types.ColumnSetting) bool { return column.Name == opts.ResolutionColumn }) {
+			return errResolutionColumnConfigured
+		}
+	}
+
+	// Time column is detected from sorting key of the table with AutoColumns.
+	if timeColumnName := getTimeColumnName(opts.Columns); timeColumnName == "" && !opts.AutoColumns {
 		return errTimeColumnNotFound
 	}
 
+	for index, check := range opts.Checks {
+		if err := check.Validate(); err != nil {
+			return fmt.Errorf("failed to validate check with index %d: %w", index, err)
+		}
+
+		if err := opts.validateExpression(check.Source); err != nil {
+			return fmt.Errorf("failed to validate source of check with index %d: %w", index, err)
+		}
+
+		if check.Target != "" {
+			if err := opts.validateExpression(check.Target); err != nil {
+				return fmt.Errorf("failed to validate target of check with index %d: %w", index, err)
+			}
+		}
+	}
+
+	if opts.Where != "" {
+		// Time column at Where is qualified by source table.
+		if err := opts.validateExpression(opts.Where, opts.Table); err != nil {
+			return fmt.Errorf("failed to validate where: %w", err)
+		}
+	}
+
 	return nil
 }
 
+// validateColumnExpression checks expression of column, which can contain types.ExpressionPlaceholders.
+func (opts *RunOptions) validateColumnExpression(expression string) error {
+	if !opts.CalendarInterval.IsZero() && strings.Contains(expression, types.PlaceholderIntervalSec) {
+		return errCalendarIntervalSec
+	}
+
+	return sqlUtils.ValidateExpression(expression, sqlUtils.ExpressionOptions{
+		AllowedFunctions: opts.AllowedFunctions,
+		Placeholders:     types.ExpressionPlaceholders,
+	})
+}
+
+// validateExpression checks that expression is a single expression over columns of the table with AllowedFunctions only.
+func (opts *RunOptions) validateExpression(expression string, qualifiers ...string) error {
+	return sqlUtils.ValidateExpression(expression, sqlUtils.ExpressionOptions{
+		AllowedFunctions:  opts.AllowedFunctions,
+		AllowedQualifiers: qualifiers,
+	})
+}
+
 var (
 	errNotInitialized = errors.New("not initialed")
 )
 
 // Run roll up on current database.Cluster with RunOptions.
-func (s *RollUp) Run(ctx context.Context, opts RunOptions) error {
+// Report contains results of all shards, even if Run was failed.
+func (s *RollUp) Run(ctx context.Context, opts RunOptions) (Report, error) {
 	if s == nil || s.cluster == nil {
-		return errNotInitialized
+		return Report{}, errNotInitialized
 	}
 
 	opts.setDefaults()
 
 	if err := opts.validate(); err != nil {
-		return fmt.Errorf("failed to validate options: %w", err)
+		return Report{}, fmt.Errorf("failed to validate options: %w", err)
 	}
 
 	shards, err := s.cluster.Shards(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get shards: %w", err)
+		return Report{}, fmt.Errorf("failed to get shards: %w", err)
+	}
+
+	report := Report{
+		Database: opts.Database,
+		Table:    opts.Table,
+		After:    opts.After,
+		Interval: opts.Interval,
+		Shards:   make([]ShardReport, len(shards)),
+
+		CalendarInterval: opts.CalendarInterval,
+	}
+
+	if !opts.inPlace() {
+		report.TargetDatabase, report.TargetTable = opts.targetDatabase(), opts.targetTable()
+	}
+
+	if opts.BackupRetention > 0 || opts.window != nil {
+		report.RunID = newUniqueID()
+	}
+
+	g, gCtx := errgroup.WithContext(ctx)
+	if opts.ContinueOnShardError {
+		// Failed shard must not cancel roll up on others.
+		g, gCtx = &errgroup.Group{}, ctx
+	}
+
+	if opts.MaxParallelShards > 0 {
+		g.SetLimit(opts.MaxParallelShards)
 	}
 
-	g, eCtx := errgroup.WithContext(ctx)
-	for _, shard := range shards {
+	for i, shard := range shards {
+		report.Shards[i] = newShardReport(shard.Name())
+	}
+
+	// Mistakes in columns must be found before data of any shard is touched.
+	shardErrors, err := preflightOnShards(ctx, shards, &opts)
+	if err != nil {
+		return report, fmt.Errorf("failed to check columns: %w", err)
+	}
+
+	for i, shardErr := range shardErrors {
+		if shardErr != nil {
+			shardErrors[i] = ShardError{
+				Shard: report.Shards[i].Shard,
+				Err:   shardErr,
+			}
+		}
+	}
+
+	if err = collectShardErrors(shardErrors); err != nil && !opts.ContinueOnShardError {
+		return report, err
+	}
+
+	for i, shard := range shards {
+		if shardErrors[i] != nil {
+			continue
+		}
+
 		g.Go(func() error {
-			err := s.runOnShard(eCtx, shard, opts)
-			if err != nil {
-				return fmt.Errorf("failed to run roll up on %s: %w", shard.Name(), err)
+			err := s.runOnShard(gCtx, shard, opts, report.RunID, &report.Shards[i])
+			if err == nil {
+				return nil
 			}
 
-			return nil
+			shardErrors[i] = ShardError{
+				Shard: report.Shards[i].Shard,
+				Err:   err,
+			}
+
+			if opts.ContinueOnShardError {
+				return nil
+			}
+
+			return shardErrors[i]
 		})
 	}
 
-	return g.Wait()
+	if err = g.Wait(); err != nil {
+		return report, err
+	}
+
+	return report, collectShardErrors(shardErrors)
 }
 
-func (s *RollUp) runOnShard(ctx context.Context, shard database.Shard, opts RunOptions) error {
-	latestRollUp, err := getLatestRollUpByKeyOnShard(
-		ctx,
-		shard,
-		metaInfoKey{
-			Database: opts.Database,
-			Table:    opts.Table,
-			After:    opts.After,
-			Interval: opts.Interval,
-		},
-	)
+func collectShardErrors(errs []error) error {
+	var result ShardErrors
+
+	for _, err := range errs {
+		var shardError ShardError
+		if errors.As(err, &shardError) {
+			result = append(result, shardError)
+		}
+	}
+
+	if len(result) == 0 {
+		return nil
+	}
+
+	return result
+}
+
+func (s *RollUp) runOnShard(ctx context.Context, shard database.Shard, opts RunOptions, runID string, report *ShardReport) error {
+	prepared := report.measure(StagePrepare)
+
+	if err := resolveColumns(ctx, shard, &opts); err != nil {
+		return err
+	}
+
+	// Type of time column is needed to parse partition key, and partition key can define timezone.
+	if err := resolveTimeColumnType(ctx, shard, &opts); err != nil {
+		return err
+	}
+
+	if err := resolvePartitionKey(ctx, shard, &opts); err != nil {
+		return err
+	}
+
+	if err := resolveLocation(ctx, shard, &opts); err != nil {
+		return err
+	}
+
+	if opts.BackupRetention > 0 {
+		if err := dropExpiredBackupsOnShard(ctx, shard, opts.targetDatabase(), opts.targetTable()); err != nil {
+			return err
+		}
+	}
+
+	if !opts.CalendarInterval.IsZero() {
+		if err := migrateMetaInfoOnShard(ctx, shard); err != nil {
+			return fmt.Errorf("failed to migrate meta info table: %w", err)
+		}
+	}
+
+	if opts.window != nil {
+		return rollUpRangeOnShard(ctx, shard, opts, runID, prepared, report)
+	}
+
+	latestRollUp, err := getLatestRollUpByKeyOnShard(ctx, shard, newMetaInfoKey(opts))
+	if isUnknownTable(err) {
+		latestRollUp, err = createMetaInfoTableOnShard(ctx, shard, opts)
+	}
+
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return createMetaInfo(ctx, shard, timeNow().Truncate(opts.PartitionKey), opts)
+		if !isMetaInfoNotFound(err) {
+			return err
 		}
 
-		var queryError database.QueryError
-		if errors.As(err, &queryError) && queryError.Type == database.ErrUnknownTable {
-			err = shard.Exec(ctx, rollUpMetaInfoTableDefinition)
-			if err != nil {
-				return err
-			}
+		report.FirstRun = true
+		report.Skipped = true
+
+		prepared()
+		defer report.measure(StageCommit)()
 
-			return createMetaInfo(ctx, shard, timeNow().Truncate(opts.PartitionKey), opts)
+		firstRollUpAt, err := getFirstRollUpAtOnShard(ctx, shard, opts)
+		if err != nil {
+			return err
 		}
 
-		return err
+		return createMetaInfo(ctx, shard, firstRollUpAt, opts)
 	}
 
-	rollUpTo := timeNow().Add(-opts.After).Truncate(opts.PartitionKey)
+	rollUpTo := getRollUpTo(opts)
 	// We don't need to roll up data if 'rollUpTo' before 'latestRollUp' or equal.
 	if rollUpTo.Compare(latestRollUp) != 1 {
-		return nil
+		report.Skipped = true
+		return dropSourcePartitionsOnShard(ctx, shard, opts, latestRollUp, report)
+	}
+
+	// Replace of the first partition would drop its rows before the window, they are already rolled up.
+	if !opts.partitionPeriod().isBoundary(latestRollUp, opts.location) {
+		return fmt.Errorf("%w: %s, partition is %s", errLatestNotAligned, latestRollUp, opts.partitionPeriod())
+	}
+
+	window := timeUtils.Range{
+		From: latestRollUp,
+		To:   rollUpTo,
+	}
+
+	report.Window = TimeRange(window)
+
+	if err = rollUpOnShard(ctx, shard, opts, runID, window, prepared, report); err != nil {
+		return err
+	}
+
+	if opts.DropSourceAfter > 0 {
+		defer report.measure(StageCommit)()
 	}
 
-	err = databaseUtils.CreateTableAs(ctx, shard, opts.Database, opts.Table, opts.TempTable)
+	return dropSourcePartitionsOnShard(ctx, shard, opts, window.To, report)
+}
+
+// rollUpOnShard rolls up the window through temp table, commit window by commit window.
+// Prepared is called once temp table is ready.
+func rollUpOnShard(ctx context.Context, shard database.Shard, opts RunOptions, runID string, window timeUtils.Range, prepared func(), report *ShardReport) error {
+	err := createTempTable(ctx, shard, opts)
 	if err != nil {
 		// if temp table already exists - we drop it
 		// this handles case when app got context done at
@@ -202,12 +589,12 @@ func (s *RollUp) runOnShard(ctx context.Context, shard database.Shard, opts RunO
 			return err
 		}
 
-		if err = databaseUtils.DropTable(ctx, shard, opts.Database, opts.TempTable); err != nil {
+		if err = databaseUtils.DropTable(ctx, shard, opts.targetDatabase(), opts.TempTable); err != nil {
 			return err
 		}
 
 		// let's try to create temp table after drop.
-		if err = databaseUtils.CreateTableAs(ctx, shard, opts.Database, opts.Table, opts.TempTable); err != nil {
+		if err = createTempTable(ctx, shard, opts); err != nil {
 			return err
 		}
 	}
@@ -216,50 +603,272 @@ func (s *RollUp) runOnShard(ctx context.Context, shard database.Shard, opts RunO
 		// Drop table after all manipulations.
 		// We don't need to check error here because
 		// if table doesn't drop - we drop it before next rollup.
-		_ = databaseUtils.DropTable(ctx, shard, opts.Database, opts.TempTable)
+		_ = databaseUtils.DropTable(ctx, shard, opts.targetDatabase(), opts.TempTable)
 	}()
 
-	// need from (latestRollUp) / to (rollUpTo) / interval (opts)
-	query := generateRollUpStatement(generateRollUpStatementOptions{
-		Database:  opts.Database,
-		FromTable: opts.Table,
-		ToTable:   opts.TempTable,
-		Interval:  opts.Interval,
-		Columns:   opts.Columns,
-	})
+	prepared()
+
+	for i, commitWindow := range getCommitWindows(window, opts) {
+		if i > 0 {
+			// Temp table still contains partitions of previous commit window.
+			truncated := report.measure(StagePrepare)
+
+			if err = databaseUtils.TruncateTable(ctx, shard, opts.targetDatabase(), opts.TempTable); err != nil {
+				return err
+			}
 
-	copyIntervals := timeUtils.SplitTimeRangeByInterval(
-		timeUtils.Range{
-			From: latestRollUp,
-			To:   rollUpTo,
-		},
-		opts.CopyInterval,
+			truncated()
+		}
+
+		if err = rollUpWindowOnShard(ctx, shard, opts, runID, commitWindow, report); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rollUpWindowOnShard copies rolled up data of the window to empty temp table,
+// replaces origin partitions with it and commits the window to meta info.
+func rollUpWindowOnShard(ctx context.Context, shard database.Shard, opts RunOptions, runID string, window timeUtils.Range, report *ShardReport) error {
+	copied := report.measure(StageCopy)
+
+	if opts.countUnsetResolution {
+		unsetResolutionRows, err := countUnsetResolutionOnShard(ctx, shard, opts, window)
+		if err != nil {
+			return err
+		}
+
+		report.UnsetResolutionRows += unsetResolutionRows
+	}
+
+	err := copyOnShard(
+		ctx,
+		shard,
+		generateCopyStatements(newRollUpStatementOptions(opts, window)),
+		getCopyIntervals(window, opts),
+		opts,
 	)
+	if err != nil {
+		return err
+	}
+
+	copied()
+
+	if err = verifyOnShard(ctx, shard, opts, window, report); err != nil {
+		return err
+	}
+
+	replaced := report.measure(StageReplace)
 
-	for _, interval := range copyIntervals {
-		if err = shard.Exec(ctx, query, interval.From, interval.To); err != nil {
+	partitions, err := getPartitionsOnShard(ctx, shard, opts.targetDatabase(), opts.TempTable)
+	if err != nil {
+		return fmt.Errorf("failed to get %s.%s partitions: %w", opts.targetDatabase(), opts.TempTable, err)
+	}
+
+	if err = collectPartsStats(ctx, shard, opts, window, partitions, report); err != nil {
+		return err
+	}
+
+	if opts.BackupRetention > 0 && len(partitions) > 0 {
+		// Backup table is shared by all commit windows of the run.
+		if err = backupOnShard(ctx, shard, opts, runID, window, partitions, report.BackupTable == ""); err != nil {
 			return err
 		}
+
+		report.BackupTable = getBackupTable(opts.targetTable(), runID)
 	}
 
-	partitions, err := getPartitionsOnShard(ctx, shard, opts.Database, opts.TempTable)
+	targetDatabase, targetTable := opts.targetDatabase(), opts.targetTable()
+
+	if err = replacePartitionsOnShard(ctx, shard, targetDatabase, opts.TempTable, targetTable, partitions, opts.Replicated); err != nil {
+		return fmt.Errorf("failed to replace partitions from %s.%s to %s.%s: %w", targetDatabase, opts.TempTable, targetDatabase, targetTable, err)
+	}
+
+	report.Partitions = append(report.Partitions, partitions...)
+
+	replaced()
+	defer report.measure(StageCommit)()
+
+	if opts.window != nil {
+		// Meta info must not be moved by reprocessing, so the window is recorded at audit log only.
+		return addAuditLogOnShard(ctx, shard, newAuditLog(opts, runID, window, partitions))
+	}
+
+	return createMetaInfo(ctx, shard, window.To, opts)
+}
+
+// copyOnShard executes queries for each copy interval, but no more than RunOptions.MaxParallelCopies intervals at the same time.
+func copyOnShard(ctx context.Context, shard database.Shard, queries []string, intervals []timeUtils.Range, opts RunOptions) error {
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(opts.MaxParallelCopies)
+
+	for _, interval := range intervals {
+		g.Go(func() error {
+			for _, query := range queries {
+				// Don't start next copy if previous one was failed.
+				if err := gCtx.Err(); err != nil {
+					return err
+				}
+
+				if err := shard.Exec(gCtx, query, timeRangeArgs(interval, opts)...); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+	}
+
+	return g.Wait()
+}
+
+// collectPartsStats adds rows and bytes of origin and temp table partitions to report.
+// Rolled up data of other table is measured by the source window instead of replaced partitions of target table.
+func collectPartsStats(ctx context.Context, shard database.Shard, opts RunOptions, window timeUtils.Range, partitions []string, report *ShardReport) error {
+	if len(partitions) == 0 {
+		return nil
+	}
+
+	targetDatabase, targetTable := opts.targetDatabase(), opts.targetTable()
+
+	var (
+		before partsStats
+		err    error
+	)
+
+	if opts.inPlace() {
+		before, err = getPartsStatsOnShard(ctx, shard, targetDatabase, targetTable, partitions)
+		if err != nil {
+			return fmt.Errorf("failed to get %s.%s parts stats: %w", targetDatabase, targetTable, err)
+		}
+	} else {
+		before, err = getSourceStatsOnShard(ctx, shard, opts, window)
+		if err != nil {
+			return err
+		}
+	}
+
+	after, err := getPartsStatsOnShard(ctx, shard, targetDatabase, opts.TempTable, partitions)
 	if err != nil {
-		return fmt.Errorf("failed to get %s.%s partitions: %w", opts.Database, opts.Table, err)
+		return fmt.Errorf("failed to get %s.%s parts stats: %w", targetDatabase, opts.TempTable, err)
+	}
+
+	report.RowsRead += before.Rows
+	report.BytesBefore += before.Bytes
+	report.RowsWritten += after.Rows
+	report.BytesAfter += after.Bytes
+
+	return nil
+}
+
+// getRollUpTo returns time up to which data must be rolled up.
+func getRollUpTo(opts RunOptions) time.Time {
+	return opts.partitionPeriod().truncate(timeNow().Add(-opts.After), opts.location)
+}
+
+// getCommitWindows returns parts of roll up window that are committed to meta info one by one.
+// With CommitPerPartition each part covers exactly one partition, otherwise it's the whole window.
+func getCommitWindows(window timeUtils.Range, opts RunOptions) []timeUtils.Range {
+	if !opts.CommitPerPartition {
+		return []timeUtils.Range{window}
 	}
 
-	if err = replacePartitionsOnShard(ctx, shard, opts.Database, opts.TempTable, opts.Table, partitions); err != nil {
-		return fmt.Errorf("failed to replace partitions from %s.%s to %s.%s: %w", opts.Database, opts.TempTable, opts.Database, opts.Table, err)
+	var (
+		result          []timeUtils.Range
+		partitionPeriod = opts.partitionPeriod()
+	)
+
+	for from := window.From; from.Before(window.To); {
+		to := partitionPeriod.next(from, opts.location)
+		if to.After(window.To) {
+			to = window.To
+		}
+
+		result = append(result, timeUtils.Range{
+			From: from,
+			To:   to,
+		})
+
+		from = to
+	}
+
+	return result
+}
+
+// partitionPeriod returns partition granularity of the table.
+func (opts *RunOptions) partitionPeriod() period {
+	return newPeriod(opts.PartitionKey, opts.CalendarPartitionKey)
+}
+
+func getCopyIntervals(window timeUtils.Range, opts RunOptions) []timeUtils.Range {
+	copyInterval := opts.CopyInterval
+	if opts.TimeColumnType == types.TimeColumnDate && copyInterval%day != 0 {
+		// Date can't be split by parts of a day.
+		copyInterval = (copyInterval/day + 1) * day
 	}
 
-	return createMetaInfo(ctx, shard, rollUpTo, opts)
+	return timeUtils.SplitTimeRangeByInterval(window, copyInterval)
+}
+
+func newRollUpStatementOptions(opts RunOptions, window timeUtils.Range) generateRollUpStatementOptions {
+	return generateRollUpStatementOptions{
+		Database:   opts.Database,
+		FromTable:  opts.Table,
+		ToDatabase: opts.targetDatabase(),
+		ToTable:    opts.TempTable,
+		Interval:   opts.Interval,
+		Columns:    opts.Columns,
+
+		CalendarInterval:   opts.CalendarInterval,
+		TimeColumnType:     opts.TimeColumnType,
+		Location:           opts.location,
+		Where:              opts.Where,
+		PassThroughColumns: opts.passThroughColumns,
+		After:              opts.After,
+		Window:             window,
+		ResolutionColumn:   opts.ResolutionColumn,
+	}
+}
+
+func createTempTable(ctx context.Context, shard database.Shard, opts RunOptions) error {
+	return createTableAsOrigin(ctx, shard, opts, opts.TempTable)
+}
+
+// createTableAsOrigin creates table with the same structure and engine as target table in target database.
+func createTableAsOrigin(ctx context.Context, shard database.Shard, opts RunOptions, table string) error {
+	targetDatabase := opts.targetDatabase()
+
+	if !opts.Replicated {
+		return databaseUtils.CreateTableAs(ctx, shard, targetDatabase, opts.targetTable(), table)
+	}
+
+	// Each table must have its own replication path,
+	// otherwise it conflicts with origin table or tables on other shards.
+	zooKeeperPath := fmt.Sprintf("%s/%s/%s/%s", replicationPathPrefix, targetDatabase, table, newUniqueID())
+
+	return databaseUtils.CreateReplicatedTableAs(ctx, shard, targetDatabase, opts.targetTable(), table, zooKeeperPath)
+}
+
+func newMetaInfoKey(opts RunOptions) metaInfoKey {
+	return metaInfoKey{
+		Database: opts.targetDatabase(),
+		Table:    opts.targetTable(),
+		After:    opts.After,
+		Interval: opts.Interval,
+
+		CalendarInterval: opts.CalendarInterval,
+	}
 }
 
 func createMetaInfo(ctx context.Context, shard database.Shard, rollUpsAt time.Time, opts RunOptions) error {
 	return addMetaInfoOnShard(ctx, shard, metaInfo{
-		Database:  opts.Database,
-		Table:     opts.Table,
+		Database:  opts.targetDatabase(),
+		Table:     opts.targetTable(),
 		After:     opts.After,
 		Interval:  opts.Interval,
 		RollUpsAt: rollUpsAt,
+
+		CalendarInterval: opts.CalendarInterval,
 	})
 }
@@ -7,6 +7,8 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
@@ -14,6 +16,8 @@ import (
 	"go.uber.org/goleak"
 	"go.uber.org/mock/gomock"
 
+	sqlUtils "github.com/ozontech/ch-rollup/internal/utils/sql"
+	timeUtils "github.com/ozontech/ch-rollup/internal/utils/time"
 	"github.com/ozontech/ch-rollup/pkg/database"
 	"github.com/ozontech/ch-rollup/pkg/database/mock"
 	"github.com/ozontech/ch-rollup/pkg/types"
@@ -64,14 +68,28 @@ func TestRunOptions_Validate(t *testing.T) {
 	)
 
 	type fields struct {
-		Database     string
-		Table        string
-		TempTable    string
-		PartitionKey time.Duration
-		Columns      []types.ColumnSetting
-		Interval     time.Duration
-		After        time.Duration
-		CopyInterval time.Duration
+		Database          string
+		Table             string
+		TempTable         string
+		PartitionKey      time.Duration
+		Columns           []types.ColumnSetting
+		Interval          time.Duration
+		After             time.Duration
+		CopyInterval      time.Duration
+		MaxParallelShards int
+		MaxParallelCopies int
+
+		CalendarPartitionKey types.CalendarInterval
+		CalendarInterval     types.CalendarInterval
+		TimeColumnType       types.TimeColumnType
+		TargetTable          string
+		DropSourceAfter      time.Duration
+		AutoColumns          bool
+		Where                string
+		AllowedFunctions     []string
+		ResolutionColumn     string
+		StartFrom            types.StartFrom
+		StartTime            time.Time
 	}
 	tests := []struct {
 		name    string
@@ -189,6 +207,36 @@ func TestRunOptions_Validate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "Bad max parallel shards",
+			fields: fields{
+				Database:          testDatabase,
+				Table:             testTable,
+				TempTable:         testTempTable,
+				PartitionKey:      testPartitionKey,
+				Columns:           testColumns,
+				Interval:          testInterval,
+				After:             testAfter,
+				CopyInterval:      testCopyInterval,
+				MaxParallelShards: -1,
+			},
+			wantErr: true,
+		},
+		{
+			name: "Bad max parallel copies",
+			fields: fields{
+				Database:          testDatabase,
+				Table:             testTable,
+				TempTable:         testTempTable,
+				PartitionKey:      testPartitionKey,
+				Columns:           testColumns,
+				Interval:          testInterval,
+				After:             testAfter,
+				CopyInterval:      testCopyInterval,
+				MaxParallelCopies: -1,
+			},
+			wantErr: true,
+		},
 		{
 			name: "Bad column",
 			fields: fields{
@@ -225,20 +273,303 @@ func TestRunOptions_Validate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "Ok calendar",
+			fields: fields{
+				Database:     testDatabase,
+				Table:        testTable,
+				TempTable:    testTempTable,
+				Columns:      testColumns,
+				After:        testAfter,
+				CopyInterval: testCopyInterval,
+
+				CalendarPartitionKey: types.CalendarInterval{Unit: types.CalendarMonth},
+				CalendarInterval:     types.CalendarInterval{Unit: types.CalendarWeek},
+			},
+		},
+		{
+			name: "Bad many intervals",
+			fields: fields{
+				Database:     testDatabase,
+				Table:        testTable,
+				TempTable:    testTempTable,
+				Columns:      testColumns,
+				Interval:     testInterval,
+				After:        testAfter,
+				CopyInterval: testCopyInterval,
+
+				CalendarInterval: types.CalendarInterval{Unit: types.CalendarWeek},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Bad many partition keys",
+			fields: fields{
+				Database:     testDatabase,
+				Table:        testTable,
+				TempTable:    testTempTable,
+				PartitionKey: testPartitionKey,
+				Columns:      testColumns,
+				Interval:     testInterval,
+				After:        testAfter,
+				CopyInterval: testCopyInterval,
+
+				CalendarPartitionKey: types.CalendarInterval{Unit: types.CalendarMonth},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Bad time column type",
+			fields: fields{
+				Database:     testDatabase,
+				Table:        testTable,
+				TempTable:    testTempTable,
+				Columns:      testColumns,
+				Interval:     testInterval,
+				After:        testAfter,
+				CopyInterval: testCopyInterval,
+
+				TimeColumnType: "Time",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Bad interval of date time column",
+			fields: fields{
+				Database:     testDatabase,
+				Table:        testTable,
+				TempTable:    testTempTable,
+				Columns:      testColumns,
+				Interval:     testInterval,
+				After:        testAfter,
+				CopyInterval: testCopyInterval,
+
+				TimeColumnType: types.TimeColumnDate,
+			},
+			wantErr: true,
+		},
+		{
+			name: "Bad interval of unix time column",
+			fields: fields{
+				Database:     testDatabase,
+				Table:        testTable,
+				TempTable:    testTempTable,
+				Columns:      testColumns,
+				Interval:     500 * time.Millisecond,
+				After:        testAfter,
+				CopyInterval: testCopyInterval,
+
+				TimeColumnType: types.TimeColumnUnixMilliseconds,
+			},
+			wantErr: true,
+		},
+		{
+			name: "Bad calendar interval",
+			fields: fields{
+				Database:     testDatabase,
+				Table:        testTable,
+				TempTable:    testTempTable,
+				Columns:      testColumns,
+				After:        testAfter,
+				CopyInterval: testCopyInterval,
+
+				CalendarInterval: types.CalendarInterval{Unit: "day"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Ok auto columns without time column",
+			fields: fields{
+				Database:     testDatabase,
+				Table:        testTable,
+				TempTable:    testTempTable,
+				Interval:     testInterval,
+				After:        testAfter,
+				CopyInterval: testCopyInterval,
+
+				AutoColumns: true,
+			},
+		},
+		{
+			name: "Ok target table",
+			fields: fields{
+				Database:     testDatabase,
+				Table:        testTable,
+				TempTable:    testTempTable,
+				PartitionKey: testPartitionKey,
+				Columns:      testColumns,
+				Interval:     testInterval,
+				After:        testAfter,
+				CopyInterval: testCopyInterval,
+
+				TargetTable:     "test_target_table",
+				DropSourceAfter: time.Hour * 24,
+			},
+		},
+		{
+			name: "Bad target table",
+			fields: fields{
+				Database:     testDatabase,
+				Table:        testTable,
+				TempTable:    testTempTable,
+				PartitionKey: testPartitionKey,
+				Columns:      testColumns,
+				Interval:     testInterval,
+				After:        testAfter,
+				CopyInterval: testCopyInterval,
+
+				TargetTable: "bad-target-table",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Drop source in place",
+			fields: fields{
+				Database:     testDatabase,
+				Table:        testTable,
+				TempTable:    testTempTable,
+				PartitionKey: testPartitionKey,
+				Columns:      testColumns,
+				Interval:     testInterval,
+				After:        testAfter,
+				CopyInterval: testCopyInterval,
+
+				DropSourceAfter: time.Hour * 24,
+			},
+			wantErr: true,
+		},
+		{
+			name: "Ok where and allowed functions",
+			fields: fields{
+				Database:         testDatabase,
+				Table:            testTable,
+				TempTable:        testTempTable,
+				PartitionKey:     testPartitionKey,
+				Columns:          testColumns,
+				Interval:         testInterval,
+				After:            testAfter,
+				CopyInterval:     testCopyInterval,
+				Where:            `"test_table"."test_time" < now()`,
+				AllowedFunctions: []string{"count", "now"},
+			},
+		},
+		{
+			name: "Not allowed function",
+			fields: fields{
+				Database:         testDatabase,
+				Table:            testTable,
+				TempTable:        testTempTable,
+				PartitionKey:     testPartitionKey,
+				Columns:          testColumns,
+				Interval:         testInterval,
+				After:            testAfter,
+				CopyInterval:     testCopyInterval,
+				AllowedFunctions: []string{"sum"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Interval seconds with calendar interval",
+			fields: fields{
+				Database:         testDatabase,
+				Table:            testTable,
+				TempTable:        testTempTable,
+				PartitionKey:     testPartitionKey,
+				Columns:          append(slices.Clone(testColumns), types.ColumnSetting{Name: "rollup_interval", Expression: types.PlaceholderIntervalSec}),
+				CalendarInterval: types.CalendarInterval{Unit: types.CalendarMonth},
+				After:            testAfter,
+				CopyInterval:     testCopyInterval,
+			},
+			wantErr: true,
+		},
+		{
+			name: "Resolution column at columns",
+			fields: fields{
+				Database:         testDatabase,
+				Table:            testTable,
+				TempTable:        testTempTable,
+				PartitionKey:     testPartitionKey,
+				Columns:          testColumns,
+				Interval:         testInterval,
+				After:            testAfter,
+				CopyInterval:     testCopyInterval,
+				ResolutionColumn: "test",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Start from time without start time",
+			fields: fields{
+				Database:     testDatabase,
+				Table:        testTable,
+				TempTable:    testTempTable,
+				PartitionKey: testPartitionKey,
+				Columns:      testColumns,
+				Interval:     testInterval,
+				After:        testAfter,
+				CopyInterval: testCopyInterval,
+				StartFrom:    types.StartFromTime,
+			},
+			wantErr: true,
+		},
+		{
+			name: "Start time without start from time",
+			fields: fields{
+				Database:     testDatabase,
+				Table:        testTable,
+				TempTable:    testTempTable,
+				PartitionKey: testPartitionKey,
+				Columns:      testColumns,
+				Interval:     testInterval,
+				After:        testAfter,
+				CopyInterval: testCopyInterval,
+				StartTime:    time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+			},
+			wantErr: true,
+		},
+		{
+			name: "Injected where",
+			fields: fields{
+				Database:     testDatabase,
+				Table:        testTable,
+				TempTable:    testTempTable,
+				PartitionKey: testPartitionKey,
+				Columns:      testColumns,
+				Interval:     testInterval,
+				After:        testAfter,
+				CopyInterval: testCopyInterval,
+				Where:        "1 UNION ALL SELECT * FROM other_database.other_table",
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
 
 			opts := RunOptions{
-				Database:     tt.fields.Database,
-				Table:        tt.fields.Table,
-				TempTable:    tt.fields.TempTable,
-				PartitionKey: tt.fields.PartitionKey,
-				Columns:      tt.fields.Columns,
-				Interval:     tt.fields.Interval,
-				After:        tt.fields.After,
-				CopyInterval: tt.fields.CopyInterval,
+				Database:          tt.fields.Database,
+				Table:             tt.fields.Table,
+				TempTable:         tt.fields.TempTable,
+				PartitionKey:      tt.fields.PartitionKey,
+				Columns:           tt.fields.Columns,
+				Interval:          tt.fields.Interval,
+				After:             tt.fields.After,
+				CopyInterval:      tt.fields.CopyInterval,
+				MaxParallelShards: tt.fields.MaxParallelShards,
+				MaxParallelCopies: tt.fields.MaxParallelCopies,
+
+				CalendarPartitionKey: tt.fields.CalendarPartitionKey,
+				CalendarInterval:     tt.fields.CalendarInterval,
+				TimeColumnType:       tt.fields.TimeColumnType,
+				TargetTable:          tt.fields.TargetTable,
+				DropSourceAfter:      tt.fields.DropSourceAfter,
+				AutoColumns:          tt.fields.AutoColumns,
+				Where:                tt.fields.Where,
+				AllowedFunctions:     tt.fields.AllowedFunctions,
+				ResolutionColumn:     tt.fields.ResolutionColumn,
+				StartFrom:            tt.fields.StartFrom,
+				StartTime:            tt.fields.StartTime,
 			}
 
 			assert.Equal(t, tt.wantErr, opts.validate() != nil)
@@ -246,10 +577,158 @@ func TestRunOptions_Validate(t *testing.T) {
 	}
 }
 
+// expectTimeColumnType expects reading of time column type.
+func expectTimeColumnType(ctrl *gomock.Controller, shardMock *mock.MockShard, databaseName, tableName, columnName, columnType string) {
+	rowMock := mock.NewMockRow(ctrl)
+	rowMock.EXPECT().Scan(gomock.Any()).SetArg(0, columnType)
+
+	shardMock.EXPECT().QueryRow(
+		gomock.Any(),
+		"SELECT type FROM system.columns WHERE database = ? AND table = ? AND name = ?",
+		databaseName,
+		tableName,
+		columnName,
+	).Return(rowMock)
+}
+
+// expectServerTimezone expects reading of server timezone, time column type has no timezone.
+func expectServerTimezone(ctrl *gomock.Controller, shardMock *mock.MockShard, timezone string) {
+	rowMock := mock.NewMockRow(ctrl)
+	rowMock.EXPECT().Scan(gomock.Any()).SetArg(0, timezone)
+
+	shardMock.EXPECT().QueryRow(gomock.Any(), "SELECT timezone()").Return(rowMock)
+}
+
+//nolint:paralleltest
+func expectPartsStats(ctrl *gomock.Controller, shardMock *mock.MockShard, databaseName, tableName string, partitions []string, rows, bytes uint64) {
+	rowMock := mock.NewMockRow(ctrl)
+	rowMock.EXPECT().Scan(gomock.Any(), gomock.Any()).DoAndReturn(func(dest ...any) error {
+		*dest[0].(*uint64) = rows
+		*dest[1].(*uint64) = bytes
+
+		return nil
+	})
+
+	args := []any{databaseName, tableName, 1}
+	for _, partition := range partitions {
+		args = append(args, partition)
+	}
+
+	shardMock.EXPECT().QueryRow(
+		gomock.Any(),
+		"SELECT sum(rows), sum(bytes_on_disk) FROM system.parts WHERE database = ? AND table = ? AND active = ? AND partition IN ("+strings.TrimSuffix(strings.Repeat("?, ", len(partitions)), ", ")+")",
+		args...,
+	).Return(rowMock)
+}
+
+// expectTableColumns expects reading of the table columns, which match configured columns.
+func expectTableColumns(ctrl *gomock.Controller, shardMock *mock.MockShard, databaseName, tableName string, columns []types.ColumnSetting) {
+	rowsMock := mock.NewMockRows(ctrl)
+
+	for _, column := range columns {
+		columnType := "String"
+
+		switch {
+		case column.IsRollUpTime:
+			columnType = "DateTime"
+		case column.Expression != "":
+			columnType = "AggregateFunction(count)"
+		}
+
+		rowsMock.EXPECT().Next().Return(true)
+		rowsMock.EXPECT().Scan(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(scanTableColumn(column.Name, columnType))
+	}
+
+	rowsMock.EXPECT().Next()
+	rowsMock.EXPECT().Err()
+	rowsMock.EXPECT().Close()
+
+	shardMock.EXPECT().Query(
+		gomock.Any(),
+		"SELECT name, type, default_kind FROM system.columns WHERE database = ? AND table = ? ORDER BY position",
+		databaseName,
+		tableName,
+	).Return(rowsMock, nil)
+}
+
+// expectExpressionTypes expects describing of roll up statement of the table, types of its columns match
+// types of expectTableColumns. Every selected column is described, with or without rows in the table.
+func expectExpressionTypes(ctrl *gomock.Controller, shardMock *mock.MockShard, databaseName, tableName string, columns []types.ColumnSetting) {
+	rowsMock := mock.NewMockRows(ctrl)
+
+	for _, column := range columns {
+		if column.IsReset {
+			continue
+		}
+
+		columnType := "String"
+
+		switch {
+		case column.IsRollUpTime:
+			columnType = "DateTime"
+		case column.Expression != "":
+			columnType = "AggregateFunction(count)"
+		}
+
+		rowsMock.EXPECT().Next().Return(true)
+		rowsMock.EXPECT().Scan(gomock.Any(), gomock.Any()).DoAndReturn(func(dest ...any) error {
+			*dest[0].(*string) = column.Expression
+			*dest[1].(*string) = columnType
+
+			return nil
+		})
+	}
+
+	rowsMock.EXPECT().Next()
+	rowsMock.EXPECT().Err()
+	rowsMock.EXPECT().Close()
+
+	// Bounds are of DateTime time column.
+	args := make([]any, timeRangeArgsCount(columns))
+	for i := range args {
+		args[i] = gomock.AssignableToTypeOf(time.Time{})
+	}
+
+	shardMock.EXPECT().Query(
+		gomock.Any(),
+		gomock.Cond(func(query string) bool {
+			return strings.HasPrefix(query, "DESCRIBE (SELECT ") &&
+				strings.Contains(query, " FROM "+sqlUtils.QuotedDatabaseEntity(databaseName, tableName)+" ")
+		}),
+		args...,
+	).Return(rowsMock, nil)
+}
+
+// expectPartitionKey expects reading of partition key of MergeTree table.
+func expectPartitionKey(ctrl *gomock.Controller, shardMock *mock.MockShard, databaseName, tableName, partitionKey string) {
+	expectPartitionKeyWithEngine(ctrl, shardMock, databaseName, tableName, partitionKey, "MergeTree PARTITION BY "+partitionKey+" ORDER BY tuple()")
+}
+
+// expectPartitionKeyWithEngine expects reading of partition key and engine of the table.
+func expectPartitionKeyWithEngine(ctrl *gomock.Controller, shardMock *mock.MockShard, databaseName, tableName, partitionKey, engineFull string) {
+	rowMock := mock.NewMockRow(ctrl)
+	rowMock.EXPECT().Scan(gomock.Any(), gomock.Any()).DoAndReturn(func(dest ...any) error {
+		*dest[0].(*string) = partitionKey
+		*dest[1].(*string) = engineFull
+
+		return nil
+	})
+
+	shardMock.EXPECT().QueryRow(
+		gomock.Any(),
+		"SELECT partition_key, engine_full FROM system.tables WHERE database = ? AND name = ?",
+		databaseName,
+		tableName,
+	).Return(rowMock)
+}
+
 //nolint:paralleltest
 func TestRollUp_Run(t *testing.T) {
+	defaultNewUniqueID := newUniqueID
+
 	defer func() {
 		timeNow = time.Now
+		newUniqueID = defaultNewUniqueID
 	}()
 
 	const (
@@ -261,8 +740,14 @@ func TestRollUp_Run(t *testing.T) {
 		testAfter        = time.Hour * 24
 		testCopyInterval = time.Hour
 
-		testShardName = "test-shard"
-		testPartition = "test-partition"
+		testShardName     = "test-shard"
+		testPartition     = "test-partition"
+		testNextPartition = "test-next-partition"
+
+		testRowsBefore  = 1440
+		testBytesBefore = 4096
+		testRowsAfter   = 24
+		testBytesAfter  = 512
 	)
 
 	var (
@@ -283,12 +768,58 @@ func TestRollUp_Run(t *testing.T) {
 		testPreviousRollup = time.Date(2024, time.June, 23, 0, 0, 0, 0, time.UTC)
 		testRollupTo       = time.Date(2024, time.June, 24, 0, 0, 0, 0, time.UTC)
 		testCurrentTime    = time.Date(2024, time.June, 25, 10, 0, 0, 0, time.UTC)
+
+		testProcessedReport = Report{
+			Database: testDatabase,
+			Table:    testTable,
+			After:    testAfter,
+			Interval: testInterval,
+			Shards: []ShardReport{
+				{
+					Shard: testShardName,
+					Window: TimeRange{
+						From: testPreviousRollup,
+						To:   testRollupTo,
+					},
+					RowsRead:    testRowsBefore,
+					RowsWritten: testRowsAfter,
+					BytesBefore: testBytesBefore,
+					BytesAfter:  testBytesAfter,
+					Partitions:  []string{testPartition},
+					Durations: map[Stage]time.Duration{
+						StagePrepare: 0,
+						StageCopy:    0,
+						StageReplace: 0,
+						StageCommit:  0,
+					},
+				},
+			},
+		}
+
+		testFirstRunReport = Report{
+			Database: testDatabase,
+			Table:    testTable,
+			After:    testAfter,
+			Interval: testInterval,
+			Shards: []ShardReport{
+				{
+					Shard:    testShardName,
+					FirstRun: true,
+					Skipped:  true,
+					Durations: map[Stage]time.Duration{
+						StagePrepare: 0,
+						StageCommit:  0,
+					},
+				},
+			},
+		}
 	)
 
 	tests := []struct {
 		name        string
 		prepareMock func(ctrl *gomock.Controller) database.Cluster
 		opts        RunOptions
+		want        Report
 		wantErr     bool
 	}{
 		{
@@ -302,6 +833,12 @@ func TestRollUp_Run(t *testing.T) {
 				shardMock := mock.NewMockShard(ctrl)
 
 				clusterMock.EXPECT().Shards(gomock.Any()).Return([]database.Shard{shardMock}, nil)
+				shardMock.EXPECT().Name().Return(testShardName)
+				expectPartitionKey(ctrl, shardMock, testDatabase, testTable, "toYYYYMMDD(test_time)")
+				expectTableColumns(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectExpressionTypes(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectTimeColumnType(ctrl, shardMock, testDatabase, testTable, "test_time", "DateTime")
+				expectServerTimezone(ctrl, shardMock, "UTC")
 
 				rowMock := mock.NewMockRow(ctrl)
 				rowMock.EXPECT().Scan(gomock.Any()).SetArg(0, testPreviousRollup)
@@ -339,6 +876,9 @@ func TestRollUp_Run(t *testing.T) {
 					1,
 				).Return(rowsMock, nil)
 
+				expectPartsStats(ctrl, shardMock, testDatabase, testTable, []string{testPartition}, testRowsBefore, testBytesBefore)
+				expectPartsStats(ctrl, shardMock, testDatabase, testTempTable, []string{testPartition}, testRowsAfter, testBytesAfter)
+
 				shardMock.EXPECT().Exec(
 					gomock.Any(),
 					`ALTER TABLE "test_database"."test_table" REPLACE PARTITION ? FROM "test_database"."test_temp_table"`,
@@ -372,6 +912,336 @@ func TestRollUp_Run(t *testing.T) {
 				After:        testAfter,
 				CopyInterval: testCopyInterval,
 			},
+			want: testProcessedReport,
+		},
+		{
+			name: "Ok commit per partition",
+			prepareMock: func(ctrl *gomock.Controller) database.Cluster {
+				timeNow = func() time.Time {
+					return testCurrentTime.Add(testPartitionKey)
+				}
+
+				clusterMock := mock.NewMockCluster(ctrl)
+				shardMock := mock.NewMockShard(ctrl)
+
+				clusterMock.EXPECT().Shards(gomock.Any()).Return([]database.Shard{shardMock}, nil)
+				shardMock.EXPECT().Name().Return(testShardName)
+				expectPartitionKey(ctrl, shardMock, testDatabase, testTable, "toYYYYMMDD(test_time)")
+				expectTableColumns(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectExpressionTypes(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectTimeColumnType(ctrl, shardMock, testDatabase, testTable, "test_time", "DateTime")
+				expectServerTimezone(ctrl, shardMock, "UTC")
+
+				rowMock := mock.NewMockRow(ctrl)
+				rowMock.EXPECT().Scan(gomock.Any()).SetArg(0, testPreviousRollup)
+				shardMock.EXPECT().QueryRow(
+					gomock.Any(),
+					"SELECT max(roll_ups_at) FROM rollup_meta_info WHERE database = ? AND table = ? AND after_sec = ? AND interval_sec = ? GROUP BY database, table, after_sec, interval_sec",
+					testDatabase,
+					testTable,
+					int(testAfter.Seconds()),
+					int(testInterval.Seconds()),
+				).Return(rowMock)
+
+				shardMock.EXPECT().Exec(gomock.Any(), `CREATE TABLE "test_database"."test_temp_table" AS "test_database"."test_table"`)
+
+				for i, partition := range []string{testPartition, testNextPartition} {
+					commitTo := testRollupTo.Add(testPartitionKey * time.Duration(i))
+
+					if i > 0 {
+						shardMock.EXPECT().Exec(gomock.Any(), `TRUNCATE TABLE "test_database"."test_temp_table"`)
+					}
+
+					shardMock.EXPECT().Exec(
+						gomock.Any(),
+						`INSERT INTO "test_database"."test_temp_table" ("test", "test_with_expression", "test_time") SELECT "test", countMergeState(test_with_expression), toStartOfInterval("test_time", INTERVAL 3600 SECOND) as "test_time" FROM "test_database"."test_table" WHERE "test_table"."test_time" >= ? AND "test_table"."test_time" < ? GROUP BY "test", "test_time"`,
+						gomock.Cond(func(from time.Time) bool {
+							return !from.Before(commitTo.Add(-testPartitionKey)) && from.Before(commitTo)
+						}),
+						gomock.Any(),
+					).Times(24)
+
+					rowsMock := mock.NewMockRows(ctrl)
+
+					rowsMock.EXPECT().Next().Return(true)
+					rowsMock.EXPECT().Scan(gomock.Any()).SetArg(0, partition)
+					rowsMock.EXPECT().Next()
+					rowsMock.EXPECT().Err()
+					rowsMock.EXPECT().Close()
+
+					shardMock.EXPECT().Query(
+						gomock.Any(),
+						"SELECT partition FROM system.parts WHERE database = ? AND table = ? AND active = ? GROUP BY partition",
+						testDatabase,
+						testTempTable,
+						1,
+					).Return(rowsMock, nil)
+
+					expectPartsStats(ctrl, shardMock, testDatabase, testTable, []string{partition}, testRowsBefore, testBytesBefore)
+					expectPartsStats(ctrl, shardMock, testDatabase, testTempTable, []string{partition}, testRowsAfter, testBytesAfter)
+
+					shardMock.EXPECT().Exec(
+						gomock.Any(),
+						`ALTER TABLE "test_database"."test_table" REPLACE PARTITION ? FROM "test_database"."test_temp_table"`,
+						partition,
+					)
+
+					shardMock.EXPECT().Exec(
+						gomock.Any(),
+						"INSERT INTO rollup_meta_info (database, table, after_sec, interval_sec, roll_ups_at) VALUES (?, ?, ?, ?, ?)",
+						testDatabase,
+						testTable,
+						int(testAfter.Seconds()),
+						int(testInterval.Seconds()),
+						commitTo,
+					)
+				}
+
+				shardMock.EXPECT().Exec(
+					gomock.Any(),
+					`DROP TABLE "test_database"."test_temp_table"`,
+				)
+
+				return clusterMock
+			},
+			opts: RunOptions{
+				Database:           testDatabase,
+				Table:              testTable,
+				TempTable:          testTempTable,
+				PartitionKey:       testPartitionKey,
+				Columns:            testColumns,
+				Interval:           testInterval,
+				After:              testAfter,
+				CopyInterval:       testCopyInterval,
+				CommitPerPartition: true,
+			},
+			want: Report{
+				Database: testDatabase,
+				Table:    testTable,
+				After:    testAfter,
+				Interval: testInterval,
+				Shards: []ShardReport{
+					{
+						Shard: testShardName,
+						Window: TimeRange{
+							From: testPreviousRollup,
+							To:   testRollupTo.Add(testPartitionKey),
+						},
+						RowsRead:    testRowsBefore * 2,
+						RowsWritten: testRowsAfter * 2,
+						BytesBefore: testBytesBefore * 2,
+						BytesAfter:  testBytesAfter * 2,
+						Partitions:  []string{testPartition, testNextPartition},
+						Durations: map[Stage]time.Duration{
+							StagePrepare: 0,
+							StageCopy:    0,
+							StageReplace: 0,
+							StageCommit:  0,
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "Ok replicated",
+			prepareMock: func(ctrl *gomock.Controller) database.Cluster {
+				timeNow = func() time.Time {
+					return testCurrentTime
+				}
+
+				newUniqueID = func() string {
+					return "test-id"
+				}
+
+				clusterMock := mock.NewMockCluster(ctrl)
+				shardMock := mock.NewMockShard(ctrl)
+
+				clusterMock.EXPECT().Shards(gomock.Any()).Return([]database.Shard{shardMock}, nil)
+				shardMock.EXPECT().Name().Return(testShardName)
+				expectPartitionKeyWithEngine(ctrl, shardMock, testDatabase, testTable, "toYYYYMMDD(test_time)", "ReplicatedMergeTree('/clickhouse/tables/{shard}/test_table', '{replica}') PARTITION BY toYYYYMMDD(test_time) ORDER BY test_time")
+				expectTableColumns(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectExpressionTypes(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectTimeColumnType(ctrl, shardMock, testDatabase, testTable, "test_time", "DateTime")
+				expectServerTimezone(ctrl, shardMock, "UTC")
+
+				// Meta info table is created on elected replica after failover and fetched from other replicas.
+				unknownTableRowMock := mock.NewMockRow(ctrl)
+				unknownTableRowMock.EXPECT().Scan(gomock.Any()).Return(database.QueryError{Type: database.ErrUnknownTable})
+
+				rowMock := mock.NewMockRow(ctrl)
+				rowMock.EXPECT().Scan(gomock.Any()).SetArg(0, testPreviousRollup)
+
+				gomock.InOrder(
+					shardMock.EXPECT().QueryRow(
+						gomock.Any(),
+						"SELECT max(roll_ups_at) FROM rollup_meta_info WHERE database = ? AND table = ? AND after_sec = ? AND interval_sec = ? GROUP BY database, table, after_sec, interval_sec",
+						testDatabase,
+						testTable,
+						int(testAfter.Seconds()),
+						int(testInterval.Seconds()),
+					).Return(unknownTableRowMock),
+					shardMock.EXPECT().Exec(gomock.Any(), serviceTableDefinition(rollUpMetaInfoTableDefinition, "rollup_meta_info", true)),
+					shardMock.EXPECT().Exec(gomock.Any(), "SYSTEM SYNC REPLICA rollup_meta_info"),
+					shardMock.EXPECT().QueryRow(
+						gomock.Any(),
+						"SELECT max(roll_ups_at) FROM rollup_meta_info WHERE database = ? AND table = ? AND after_sec = ? AND interval_sec = ? GROUP BY database, table, after_sec, interval_sec",
+						testDatabase,
+						testTable,
+						int(testAfter.Seconds()),
+						int(testInterval.Seconds()),
+					).Return(rowMock),
+				)
+
+				engineRowMock := mock.NewMockRow(ctrl)
+				engineRowMock.EXPECT().Scan(gomock.Any()).SetArg(0, "ReplicatedMergeTree('/clickhouse/tables/{shard}/test_table', '{replica}') PARTITION BY toYYYYMMDD(test_time) ORDER BY test_time")
+				shardMock.EXPECT().QueryRow(
+					gomock.Any(),
+					"SELECT engine_full FROM system.tables WHERE database = ? AND name = ?",
+					testDatabase,
+					testTable,
+				).Return(engineRowMock)
+
+				shardMock.EXPECT().Exec(gomock.Any(), `CREATE TABLE "test_database"."test_temp_table" AS "test_database"."test_table" ENGINE = ReplicatedMergeTree('/clickhouse/ch-rollup/test_database/test_temp_table/test-id', '{replica}') PARTITION BY toYYYYMMDD(test_time) ORDER BY test_time`)
+
+				shardMock.EXPECT().Exec(
+					gomock.Any(),
+					`INSERT INTO "test_database"."test_temp_table" ("test", "test_with_expression", "test_time") SELECT "test", countMergeState(test_with_expression), toStartOfInterval("test_time", INTERVAL 3600 SECOND) as "test_time" FROM "test_database"."test_table" WHERE "test_table"."test_time" >= ? AND "test_table"."test_time" < ? GROUP BY "test", "test_time"`,
+					gomock.Any(),
+					gomock.Any(),
+				).Times(24)
+
+				rowsMock := mock.NewMockRows(ctrl)
+
+				rowsMock.EXPECT().Next().Return(true)
+				rowsMock.EXPECT().Scan(gomock.Any()).SetArg(0, testPartition)
+				rowsMock.EXPECT().Next()
+				rowsMock.EXPECT().Err()
+				rowsMock.EXPECT().Close()
+
+				shardMock.EXPECT().Query(
+					gomock.Any(),
+					"SELECT partition FROM system.parts WHERE database = ? AND table = ? AND active = ? GROUP BY partition",
+					testDatabase,
+					testTempTable,
+					1,
+				).Return(rowsMock, nil)
+
+				expectPartsStats(ctrl, shardMock, testDatabase, testTable, []string{testPartition}, testRowsBefore, testBytesBefore)
+				expectPartsStats(ctrl, shardMock, testDatabase, testTempTable, []string{testPartition}, testRowsAfter, testBytesAfter)
+
+				shardMock.EXPECT().Exec(
+					gomock.Any(),
+					`ALTER TABLE "test_database"."test_table" REPLACE PARTITION ? FROM "test_database"."test_temp_table" SETTINGS alter_sync = 2`,
+					"test-partition",
+				)
+
+				shardMock.EXPECT().Exec(
+					gomock.Any(),
+					"INSERT INTO rollup_meta_info (database, table, after_sec, interval_sec, roll_ups_at) VALUES (?, ?, ?, ?, ?)",
+					testDatabase,
+					testTable,
+					int(testAfter.Seconds()),
+					int(testInterval.Seconds()),
+					testRollupTo,
+				)
+
+				shardMock.EXPECT().Exec(
+					gomock.Any(),
+					`DROP TABLE "test_database"."test_temp_table"`,
+				)
+
+				return clusterMock
+			},
+			opts: RunOptions{
+				Database:     testDatabase,
+				Table:        testTable,
+				TempTable:    testTempTable,
+				PartitionKey: testPartitionKey,
+				Columns:      testColumns,
+				Interval:     testInterval,
+				After:        testAfter,
+				CopyInterval: testCopyInterval,
+				Replicated:   true,
+			},
+			want: testProcessedReport,
+		},
+		{
+			name: "Continue on shard error",
+			prepareMock: func(ctrl *gomock.Controller) database.Cluster {
+				timeNow = func() time.Time {
+					return testCurrentTime
+				}
+
+				clusterMock := mock.NewMockCluster(ctrl)
+				failedShardMock := mock.NewMockShard(ctrl)
+				shardMock := mock.NewMockShard(ctrl)
+
+				clusterMock.EXPECT().Shards(gomock.Any()).Return([]database.Shard{failedShardMock, shardMock}, nil)
+				failedShardMock.EXPECT().Name().Return("failed-shard")
+				expectPartitionKey(ctrl, failedShardMock, testDatabase, testTable, "toYYYYMMDD(test_time)")
+				expectTableColumns(ctrl, failedShardMock, testDatabase, testTable, testColumns)
+				expectExpressionTypes(ctrl, failedShardMock, testDatabase, testTable, testColumns)
+				expectTimeColumnType(ctrl, failedShardMock, testDatabase, testTable, "test_time", "DateTime")
+				expectServerTimezone(ctrl, failedShardMock, "UTC")
+				shardMock.EXPECT().Name().Return(testShardName)
+				expectPartitionKey(ctrl, shardMock, testDatabase, testTable, "toYYYYMMDD(test_time)")
+				expectTableColumns(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectTimeColumnType(ctrl, shardMock, testDatabase, testTable, "test_time", "DateTime")
+				expectServerTimezone(ctrl, shardMock, "UTC")
+
+				failedRowMock := mock.NewMockRow(ctrl)
+				failedRowMock.EXPECT().Scan(gomock.Any()).Return(errors.New("test-error"))
+				failedShardMock.EXPECT().QueryRow(
+					gomock.Any(),
+					"SELECT max(roll_ups_at) FROM rollup_meta_info WHERE database = ? AND table = ? AND after_sec = ? AND interval_sec = ? GROUP BY database, table, after_sec, interval_sec",
+					testDatabase,
+					testTable,
+					int(testAfter.Seconds()),
+					int(testInterval.Seconds()),
+				).Return(failedRowMock)
+
+				rowMock := mock.NewMockRow(ctrl)
+				rowMock.EXPECT().Scan(gomock.Any()).SetArg(0, testCurrentTime)
+				shardMock.EXPECT().QueryRow(
+					gomock.Any(),
+					"SELECT max(roll_ups_at) FROM rollup_meta_info WHERE database = ? AND table = ? AND after_sec = ? AND interval_sec = ? GROUP BY database, table, after_sec, interval_sec",
+					testDatabase,
+					testTable,
+					int(testAfter.Seconds()),
+					int(testInterval.Seconds()),
+				).Return(rowMock)
+
+				return clusterMock
+			},
+			opts: RunOptions{
+				Database:             testDatabase,
+				Table:                testTable,
+				TempTable:            testTempTable,
+				PartitionKey:         testPartitionKey,
+				Columns:              testColumns,
+				Interval:             testInterval,
+				After:                testAfter,
+				CopyInterval:         testCopyInterval,
+				ContinueOnShardError: true,
+			},
+			want: Report{
+				Database: testDatabase,
+				Table:    testTable,
+				After:    testAfter,
+				Interval: testInterval,
+				Shards: []ShardReport{
+					{
+						Shard:     "failed-shard",
+						Durations: map[Stage]time.Duration{},
+					},
+					{
+						Shard:     testShardName,
+						Skipped:   true,
+						Durations: map[Stage]time.Duration{},
+					},
+				},
+			},
+			wantErr: true,
 		},
 		{
 			name: "No need to rollup",
@@ -380,10 +1250,114 @@ func TestRollUp_Run(t *testing.T) {
 					return testCurrentTime
 				}
 
-				clusterMock := mock.NewMockCluster(ctrl)
-				shardMock := mock.NewMockShard(ctrl)
+				clusterMock := mock.NewMockCluster(ctrl)
+				shardMock := mock.NewMockShard(ctrl)
+
+				clusterMock.EXPECT().Shards(gomock.Any()).Return([]database.Shard{shardMock}, nil)
+				shardMock.EXPECT().Name().Return(testShardName)
+				expectPartitionKey(ctrl, shardMock, testDatabase, testTable, "toYYYYMMDD(test_time)")
+				expectTableColumns(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectExpressionTypes(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectTimeColumnType(ctrl, shardMock, testDatabase, testTable, "test_time", "DateTime")
+				expectServerTimezone(ctrl, shardMock, "UTC")
+
+				rowMock := mock.NewMockRow(ctrl)
+				rowMock.EXPECT().Scan(gomock.Any()).SetArg(0, testCurrentTime)
+				shardMock.EXPECT().QueryRow(
+					gomock.Any(),
+					"SELECT max(roll_ups_at) FROM rollup_meta_info WHERE database = ? AND table = ? AND after_sec = ? AND interval_sec = ? GROUP BY database, table, after_sec, interval_sec",
+					testDatabase,
+					testTable,
+					int(testAfter.Seconds()),
+					int(testInterval.Seconds()),
+				).Return(rowMock)
+
+				return clusterMock
+			},
+			opts: RunOptions{
+				Database:     testDatabase,
+				Table:        testTable,
+				TempTable:    testTempTable,
+				PartitionKey: testPartitionKey,
+				Columns:      testColumns,
+				Interval:     testInterval,
+				After:        testAfter,
+				CopyInterval: testCopyInterval,
+			},
+			want: Report{
+				Database: testDatabase,
+				Table:    testTable,
+				After:    testAfter,
+				Interval: testInterval,
+				Shards: []ShardReport{
+					{
+						Shard:     testShardName,
+						Skipped:   true,
+						Durations: map[Stage]time.Duration{},
+					},
+				},
+			},
+		},
+		{
+			name: "Ok unix time column",
+			prepareMock: func(ctrl *gomock.Controller) database.Cluster {
+				timeNow = func() time.Time {
+					return testCurrentTime
+				}
+
+				clusterMock := mock.NewMockCluster(ctrl)
+				shardMock := mock.NewMockShard(ctrl)
+
+				clusterMock.EXPECT().Shards(gomock.Any()).Return([]database.Shard{shardMock}, nil)
+				shardMock.EXPECT().Name().Return(testShardName)
+
+				columnsMock := mock.NewMockRows(ctrl)
+
+				for _, column := range []tableColumn{
+					{Name: "test", Type: "String"},
+					{Name: "test_with_expression", Type: "AggregateFunction(count)"},
+					{Name: "test_time", Type: "UInt32"},
+				} {
+					columnsMock.EXPECT().Next().Return(true)
+					columnsMock.EXPECT().Scan(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(scanTableColumn(column.Name, column.Type))
+				}
+
+				columnsMock.EXPECT().Next()
+				columnsMock.EXPECT().Err()
+				columnsMock.EXPECT().Close()
+
+				shardMock.EXPECT().Query(
+					gomock.Any(),
+					"SELECT name, type, default_kind FROM system.columns WHERE database = ? AND table = ? ORDER BY position",
+					testDatabase,
+					testTable,
+				).Return(columnsMock, nil)
+
+				typesMock := mock.NewMockRows(ctrl)
+
+				for _, columnType := range []string{"String", "AggregateFunction(count)", "UInt32"} {
+					typesMock.EXPECT().Next().Return(true)
+					typesMock.EXPECT().Scan(gomock.Any(), gomock.Any()).DoAndReturn(func(dest ...any) error {
+						*dest[1].(*string) = columnType //nolint:forcetypeassert
+
+						return nil
+					})
+				}
+
+				typesMock.EXPECT().Next()
+				typesMock.EXPECT().Err()
+				typesMock.EXPECT().Close()
 
-				clusterMock.EXPECT().Shards(gomock.Any()).Return([]database.Shard{shardMock}, nil)
+				shardMock.EXPECT().Query(
+					gomock.Any(),
+					`DESCRIBE (SELECT "test", countMergeState(test_with_expression), intDiv("test_time", 3600) * 3600 as "test_time" FROM "test_database"."test_table" WHERE "test_table"."test_time" >= ? AND "test_table"."test_time" < ? GROUP BY "test", "test_time") SETTINGS describe_compact_output = 1`,
+					uint32(0),
+					uint32(0),
+				).Return(typesMock, nil)
+
+				expectTimeColumnType(ctrl, shardMock, testDatabase, testTable, "test_time", "UInt32")
+				expectServerTimezone(ctrl, shardMock, "UTC")
+				expectPartitionKey(ctrl, shardMock, testDatabase, testTable, "toYYYYMMDD(test_time)")
 
 				rowMock := mock.NewMockRow(ctrl)
 				rowMock.EXPECT().Scan(gomock.Any()).SetArg(0, testCurrentTime)
@@ -408,6 +1382,19 @@ func TestRollUp_Run(t *testing.T) {
 				After:        testAfter,
 				CopyInterval: testCopyInterval,
 			},
+			want: Report{
+				Database: testDatabase,
+				Table:    testTable,
+				After:    testAfter,
+				Interval: testInterval,
+				Shards: []ShardReport{
+					{
+						Shard:     testShardName,
+						Skipped:   true,
+						Durations: map[Stage]time.Duration{},
+					},
+				},
+			},
 		},
 		{
 			name: "Not initialized",
@@ -464,6 +1451,30 @@ func TestRollUp_Run(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "Column is not covered",
+			prepareMock: func(ctrl *gomock.Controller) database.Cluster {
+				clusterMock := mock.NewMockCluster(ctrl)
+				shardMock := mock.NewMockShard(ctrl)
+
+				clusterMock.EXPECT().Shards(gomock.Any()).Return([]database.Shard{shardMock}, nil)
+				shardMock.EXPECT().Name().Return(testShardName)
+				expectTableColumns(ctrl, shardMock, testDatabase, testTable, append(slices.Clone(testColumns), types.ColumnSetting{Name: "test_lost"}))
+
+				return clusterMock
+			},
+			opts: RunOptions{
+				Database:     testDatabase,
+				Table:        testTable,
+				TempTable:    testTempTable,
+				PartitionKey: testPartitionKey,
+				Columns:      testColumns,
+				Interval:     testInterval,
+				After:        testAfter,
+				CopyInterval: testCopyInterval,
+			},
+			wantErr: true,
+		},
 		{
 			name: "Error on getLatestRollUpByKeyOnShard",
 			prepareMock: func(ctrl *gomock.Controller) database.Cluster {
@@ -488,6 +1499,55 @@ func TestRollUp_Run(t *testing.T) {
 				).Return(rowMock)
 
 				shardMock.EXPECT().Name().Return(testShardName)
+				expectPartitionKey(ctrl, shardMock, testDatabase, testTable, "toYYYYMMDD(test_time)")
+				expectTableColumns(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectExpressionTypes(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectTimeColumnType(ctrl, shardMock, testDatabase, testTable, "test_time", "DateTime")
+				expectServerTimezone(ctrl, shardMock, "UTC")
+
+				return clusterMock
+			},
+			opts: RunOptions{
+				Database:     testDatabase,
+				Table:        testTable,
+				TempTable:    testTempTable,
+				PartitionKey: testPartitionKey,
+				Columns:      testColumns,
+				Interval:     testInterval,
+				After:        testAfter,
+				CopyInterval: testCopyInterval,
+			},
+			wantErr: true,
+		},
+		{
+			name: "Latest roll up not aligned to partitions",
+			prepareMock: func(ctrl *gomock.Controller) database.Cluster {
+				timeNow = func() time.Time {
+					return testCurrentTime
+				}
+
+				clusterMock := mock.NewMockCluster(ctrl)
+				shardMock := mock.NewMockShard(ctrl)
+
+				clusterMock.EXPECT().Shards(gomock.Any()).Return([]database.Shard{shardMock}, nil)
+				shardMock.EXPECT().Name().Return(testShardName)
+				expectPartitionKey(ctrl, shardMock, testDatabase, testTable, "toYYYYMMDD(test_time)")
+				expectTableColumns(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectExpressionTypes(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectTimeColumnType(ctrl, shardMock, testDatabase, testTable, "test_time", "DateTime")
+				expectServerTimezone(ctrl, shardMock, "UTC")
+
+				// Saved with Europe/Moscow timezone before.
+				rowMock := mock.NewMockRow(ctrl)
+				rowMock.EXPECT().Scan(gomock.Any()).SetArg(0, testPreviousRollup.Add(-3*time.Hour))
+				shardMock.EXPECT().QueryRow(
+					gomock.Any(),
+					"SELECT max(roll_ups_at) FROM rollup_meta_info WHERE database = ? AND table = ? AND after_sec = ? AND interval_sec = ? GROUP BY database, table, after_sec, interval_sec",
+					testDatabase,
+					testTable,
+					int(testAfter.Seconds()),
+					int(testInterval.Seconds()),
+				).Return(rowMock)
 
 				return clusterMock
 			},
@@ -514,6 +1574,12 @@ func TestRollUp_Run(t *testing.T) {
 				shardMock := mock.NewMockShard(ctrl)
 
 				clusterMock.EXPECT().Shards(gomock.Any()).Return([]database.Shard{shardMock}, nil)
+				shardMock.EXPECT().Name().Return(testShardName)
+				expectPartitionKey(ctrl, shardMock, testDatabase, testTable, "toYYYYMMDD(test_time)")
+				expectTableColumns(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectExpressionTypes(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectTimeColumnType(ctrl, shardMock, testDatabase, testTable, "test_time", "DateTime")
+				expectServerTimezone(ctrl, shardMock, "UTC")
 
 				rowMock := mock.NewMockRow(ctrl)
 				rowMock.EXPECT().Scan(gomock.Any()).Return(sql.ErrNoRows)
@@ -548,6 +1614,7 @@ func TestRollUp_Run(t *testing.T) {
 				After:        testAfter,
 				CopyInterval: testCopyInterval,
 			},
+			want: testFirstRunReport,
 		},
 		{
 			name: "Meta info table not exist with ok create",
@@ -560,6 +1627,12 @@ func TestRollUp_Run(t *testing.T) {
 				shardMock := mock.NewMockShard(ctrl)
 
 				clusterMock.EXPECT().Shards(gomock.Any()).Return([]database.Shard{shardMock}, nil)
+				shardMock.EXPECT().Name().Return(testShardName)
+				expectPartitionKey(ctrl, shardMock, testDatabase, testTable, "toYYYYMMDD(test_time)")
+				expectTableColumns(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectExpressionTypes(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectTimeColumnType(ctrl, shardMock, testDatabase, testTable, "test_time", "DateTime")
+				expectServerTimezone(ctrl, shardMock, "UTC")
 
 				rowMock := mock.NewMockRow(ctrl)
 				rowMock.EXPECT().Scan(gomock.Any()).
@@ -580,7 +1653,7 @@ func TestRollUp_Run(t *testing.T) {
 
 				shardMock.EXPECT().Exec(
 					gomock.Any(),
-					rollUpMetaInfoTableDefinition,
+					serviceTableDefinition(rollUpMetaInfoTableDefinition, "rollup_meta_info", false),
 				)
 
 				shardMock.EXPECT().Exec(
@@ -605,6 +1678,81 @@ func TestRollUp_Run(t *testing.T) {
 				After:        testAfter,
 				CopyInterval: testCopyInterval,
 			},
+			want: testFirstRunReport,
+		},
+		{
+			name: "Meta info table not exist with calendar interval",
+			prepareMock: func(ctrl *gomock.Controller) database.Cluster {
+				timeNow = func() time.Time {
+					return testCurrentTime
+				}
+
+				clusterMock := mock.NewMockCluster(ctrl)
+				shardMock := mock.NewMockShard(ctrl)
+
+				clusterMock.EXPECT().Shards(gomock.Any()).Return([]database.Shard{shardMock}, nil)
+				shardMock.EXPECT().Name().Return(testShardName)
+				expectPartitionKey(ctrl, shardMock, testDatabase, testTable, "toYYYYMM(test_time)")
+				expectTableColumns(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectExpressionTypes(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectTimeColumnType(ctrl, shardMock, testDatabase, testTable, "test_time", "DateTime")
+				expectServerTimezone(ctrl, shardMock, "UTC")
+
+				unknownTable := database.QueryError{Type: database.ErrUnknownTable}
+
+				rowMock := mock.NewMockRow(ctrl)
+				rowMock.EXPECT().Scan(gomock.Any()).Return(unknownTable)
+
+				gomock.InOrder(
+					shardMock.EXPECT().Exec(gomock.Any(), addMetaInfoCalendarColumn).Return(unknownTable),
+					shardMock.EXPECT().QueryRow(
+						gomock.Any(),
+						"SELECT max(roll_ups_at) FROM rollup_meta_info WHERE database = ? AND table = ? AND after_sec = ? AND interval_sec = ? AND interval_calendar = ? GROUP BY database, table, after_sec, interval_sec, interval_calendar",
+						testDatabase,
+						testTable,
+						int(testAfter.Seconds()),
+						0,
+						"1 month",
+					).Return(rowMock),
+					// Calendar intervals are saved to the created table without migration.
+					shardMock.EXPECT().Exec(
+						gomock.Any(),
+						gomock.Cond(func(query string) bool {
+							return strings.Contains(query, "CREATE TABLE IF NOT EXISTS rollup_meta_info(") &&
+								strings.Contains(query, "interval_calendar String DEFAULT ''")
+						}),
+					),
+					shardMock.EXPECT().Exec(
+						gomock.Any(),
+						"INSERT INTO rollup_meta_info (database, table, after_sec, interval_sec, roll_ups_at, interval_calendar) VALUES (?, ?, ?, ?, ?, ?)",
+						testDatabase,
+						testTable,
+						int(testAfter.Seconds()),
+						0,
+						time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC),
+						"1 month",
+					),
+				)
+
+				return clusterMock
+			},
+			opts: RunOptions{
+				Database:             testDatabase,
+				Table:                testTable,
+				TempTable:            testTempTable,
+				CalendarPartitionKey: types.CalendarInterval{Unit: types.CalendarMonth},
+				Columns:              testColumns,
+				CalendarInterval:     types.CalendarInterval{Unit: types.CalendarMonth},
+				After:                testAfter,
+				CopyInterval:         testCopyInterval,
+			},
+			want: Report{
+				Database:         testDatabase,
+				Table:            testTable,
+				After:            testAfter,
+				CalendarInterval: types.CalendarInterval{Unit: types.CalendarMonth},
+				Shards:           testFirstRunReport.Shards,
+			},
 		},
 		{
 			name: "Meta info table not exist with failed to create",
@@ -637,10 +1785,15 @@ func TestRollUp_Run(t *testing.T) {
 
 				shardMock.EXPECT().Exec(
 					gomock.Any(),
-					rollUpMetaInfoTableDefinition,
+					serviceTableDefinition(rollUpMetaInfoTableDefinition, "rollup_meta_info", false),
 				).Return(errors.New("test-error"))
 
 				shardMock.EXPECT().Name().Return(testShardName)
+				expectPartitionKey(ctrl, shardMock, testDatabase, testTable, "toYYYYMMDD(test_time)")
+				expectTableColumns(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectExpressionTypes(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectTimeColumnType(ctrl, shardMock, testDatabase, testTable, "test_time", "DateTime")
+				expectServerTimezone(ctrl, shardMock, "UTC")
 
 				return clusterMock
 			},
@@ -667,6 +1820,12 @@ func TestRollUp_Run(t *testing.T) {
 				shardMock := mock.NewMockShard(ctrl)
 
 				clusterMock.EXPECT().Shards(gomock.Any()).Return([]database.Shard{shardMock}, nil)
+				shardMock.EXPECT().Name().Return(testShardName)
+				expectPartitionKey(ctrl, shardMock, testDatabase, testTable, "toYYYYMMDD(test_time)")
+				expectTableColumns(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectExpressionTypes(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectTimeColumnType(ctrl, shardMock, testDatabase, testTable, "test_time", "DateTime")
+				expectServerTimezone(ctrl, shardMock, "UTC")
 
 				rowMock := mock.NewMockRow(ctrl)
 				rowMock.EXPECT().Scan(gomock.Any()).SetArg(0, testPreviousRollup)
@@ -708,6 +1867,9 @@ func TestRollUp_Run(t *testing.T) {
 					1,
 				).Return(rowsMock, nil)
 
+				expectPartsStats(ctrl, shardMock, testDatabase, testTable, []string{testPartition}, testRowsBefore, testBytesBefore)
+				expectPartsStats(ctrl, shardMock, testDatabase, testTempTable, []string{testPartition}, testRowsAfter, testBytesAfter)
+
 				shardMock.EXPECT().Exec(
 					gomock.Any(),
 					`ALTER TABLE "test_database"."test_table" REPLACE PARTITION ? FROM "test_database"."test_temp_table"`,
@@ -741,6 +1903,7 @@ func TestRollUp_Run(t *testing.T) {
 				After:        testAfter,
 				CopyInterval: testCopyInterval,
 			},
+			want: testProcessedReport,
 		},
 		{
 			name: "Failed to create temp table with unknown error",
@@ -767,6 +1930,11 @@ func TestRollUp_Run(t *testing.T) {
 
 				shardMock.EXPECT().Exec(gomock.Any(), `CREATE TABLE "test_database"."test_temp_table" AS "test_database"."test_table"`).Return(errors.New("unknown-error"))
 				shardMock.EXPECT().Name().Return(testShardName)
+				expectPartitionKey(ctrl, shardMock, testDatabase, testTable, "toYYYYMMDD(test_time)")
+				expectTableColumns(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectExpressionTypes(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectTimeColumnType(ctrl, shardMock, testDatabase, testTable, "test_time", "DateTime")
+				expectServerTimezone(ctrl, shardMock, "UTC")
 
 				return clusterMock
 			},
@@ -812,6 +1980,11 @@ func TestRollUp_Run(t *testing.T) {
 				shardMock.EXPECT().Exec(gomock.Any(), `DROP TABLE "test_database"."test_temp_table"`).Return(errors.New("test-error"))
 
 				shardMock.EXPECT().Name().Return(testShardName)
+				expectPartitionKey(ctrl, shardMock, testDatabase, testTable, "toYYYYMMDD(test_time)")
+				expectTableColumns(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectExpressionTypes(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectTimeColumnType(ctrl, shardMock, testDatabase, testTable, "test_time", "DateTime")
+				expectServerTimezone(ctrl, shardMock, "UTC")
 
 				return clusterMock
 			},
@@ -857,6 +2030,11 @@ func TestRollUp_Run(t *testing.T) {
 				shardMock.EXPECT().Exec(gomock.Any(), `CREATE TABLE "test_database"."test_temp_table" AS "test_database"."test_table"`).Return(errors.New("test-error"))
 
 				shardMock.EXPECT().Name().Return(testShardName)
+				expectPartitionKey(ctrl, shardMock, testDatabase, testTable, "toYYYYMMDD(test_time)")
+				expectTableColumns(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectExpressionTypes(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectTimeColumnType(ctrl, shardMock, testDatabase, testTable, "test_time", "DateTime")
+				expectServerTimezone(ctrl, shardMock, "UTC")
 
 				return clusterMock
 			},
@@ -910,6 +2088,11 @@ func TestRollUp_Run(t *testing.T) {
 				)
 
 				shardMock.EXPECT().Name().Return(testShardName)
+				expectPartitionKey(ctrl, shardMock, testDatabase, testTable, "toYYYYMMDD(test_time)")
+				expectTableColumns(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectExpressionTypes(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectTimeColumnType(ctrl, shardMock, testDatabase, testTable, "test_time", "DateTime")
+				expectServerTimezone(ctrl, shardMock, "UTC")
 
 				return clusterMock
 			},
@@ -977,6 +2160,11 @@ func TestRollUp_Run(t *testing.T) {
 				)
 
 				shardMock.EXPECT().Name().Return(testShardName)
+				expectPartitionKey(ctrl, shardMock, testDatabase, testTable, "toYYYYMMDD(test_time)")
+				expectTableColumns(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectExpressionTypes(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectTimeColumnType(ctrl, shardMock, testDatabase, testTable, "test_time", "DateTime")
+				expectServerTimezone(ctrl, shardMock, "UTC")
 
 				return clusterMock
 			},
@@ -1040,6 +2228,9 @@ func TestRollUp_Run(t *testing.T) {
 					1,
 				).Return(rowsMock, nil)
 
+				expectPartsStats(ctrl, shardMock, testDatabase, testTable, []string{testPartition}, testRowsBefore, testBytesBefore)
+				expectPartsStats(ctrl, shardMock, testDatabase, testTempTable, []string{testPartition}, testRowsAfter, testBytesAfter)
+
 				shardMock.EXPECT().Exec(
 					gomock.Any(),
 					`ALTER TABLE "test_database"."test_table" REPLACE PARTITION ? FROM "test_database"."test_temp_table"`,
@@ -1052,6 +2243,11 @@ func TestRollUp_Run(t *testing.T) {
 				)
 
 				shardMock.EXPECT().Name().Return(testShardName)
+				expectPartitionKey(ctrl, shardMock, testDatabase, testTable, "toYYYYMMDD(test_time)")
+				expectTableColumns(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectExpressionTypes(ctrl, shardMock, testDatabase, testTable, testColumns)
+				expectTimeColumnType(ctrl, shardMock, testDatabase, testTable, "test_time", "DateTime")
+				expectServerTimezone(ctrl, shardMock, "UTC")
 
 				return clusterMock
 			},
@@ -1070,6 +2266,7 @@ func TestRollUp_Run(t *testing.T) {
 	}
 	for _, tt := range tests {
 		timeNow = time.Now
+		newUniqueID = defaultNewUniqueID
 
 		t.Run(tt.name, func(t *testing.T) {
 			defer goleak.VerifyNone(t)
@@ -1080,7 +2277,362 @@ func TestRollUp_Run(t *testing.T) {
 				cluster: tt.prepareMock(ctrl),
 			}
 
-			assert.Equal(t, tt.wantErr, s.Run(context.Background(), tt.opts) != nil)
+			got, err := s.Run(context.Background(), tt.opts)
+			if !tt.wantErr || tt.want.Shards != nil {
+				assert.Equal(t, tt.want, got)
+			}
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
+
+func Test_copyOnShard(t *testing.T) {
+	t.Parallel()
+
+	const (
+		testQuery            = "test_query"
+		testPassThroughQuery = "test_pass_through_query"
+	)
+
+	var (
+		testStart     = time.Date(2024, time.June, 24, 0, 0, 0, 0, time.UTC)
+		testIntervals = []timeUtils.Range{
+			{From: testStart, To: testStart.Add(time.Hour)},
+			{From: testStart.Add(time.Hour), To: testStart.Add(time.Hour * 2)},
+			{From: testStart.Add(time.Hour * 2), To: testStart.Add(time.Hour * 3)},
+			{From: testStart.Add(time.Hour * 3), To: testStart.Add(time.Hour * 4)},
+		}
+	)
+
+	type args struct {
+		prepareMock    func(shard *mock.MockShard)
+		maxParallel    int
+		timeColumnType types.TimeColumnType
+		passThrough    bool
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr bool
+	}{
+		{
+			name: "Ok sequential",
+			args: args{
+				prepareMock: func(shard *mock.MockShard) {
+					calls := make([]any, 0, len(testIntervals))
+					for _, interval := range testIntervals {
+						calls = append(calls, shard.EXPECT().Exec(gomock.Any(), testQuery, interval.From, interval.To))
+					}
+
+					gomock.InOrder(calls...)
+				},
+				maxParallel: 1,
+			},
+		},
+		{
+			name: "Ok parallel",
+			args: args{
+				prepareMock: func(shard *mock.MockShard) {
+					for _, interval := range testIntervals {
+						shard.EXPECT().Exec(gomock.Any(), testQuery, interval.From, interval.To)
+					}
+				},
+				maxParallel: 2,
+			},
+		},
+		{
+			name: "Stop on first error",
+			args: args{
+				prepareMock: func(shard *mock.MockShard) {
+					shard.EXPECT().Exec(gomock.Any(), testQuery, testIntervals[0].From, testIntervals[0].To).Return(errors.New("test"))
+				},
+				maxParallel: 1,
+			},
+			wantErr: true,
+		},
+		{
+			name: "Ok unix milliseconds",
+			args: args{
+				prepareMock: func(shard *mock.MockShard) {
+					for _, interval := range testIntervals {
+						shard.EXPECT().Exec(gomock.Any(), testQuery, uint64(interval.From.UnixMilli()), uint64(interval.To.UnixMilli()))
+					}
+				},
+				maxParallel:    1,
+				timeColumnType: types.TimeColumnUnixMilliseconds,
+			},
+		},
+		{
+			name: "Ok pass through",
+			args: args{
+				prepareMock: func(shard *mock.MockShard) {
+					for _, interval := range testIntervals {
+						gomock.InOrder(
+							shard.EXPECT().Exec(gomock.Any(), testQuery, interval.From, interval.To),
+							shard.EXPECT().Exec(gomock.Any(), testPassThroughQuery, interval.From, interval.To),
+						)
+					}
+				},
+				maxParallel: 1,
+				passThrough: true,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctrl := gomock.NewController(t)
+
+			shardMock := mock.NewMockShard(ctrl)
+			tt.args.prepareMock(shardMock)
+
+			opts := RunOptions{
+				MaxParallelCopies: tt.args.maxParallel,
+				TimeColumnType:    tt.args.timeColumnType,
+			}
+
+			queries := []string{testQuery}
+			if tt.args.passThrough {
+				queries = append(queries, testPassThroughQuery)
+			}
+
+			err := copyOnShard(context.Background(), shardMock, queries, testIntervals, opts)
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
+
+func Test_collectPartsStats(t *testing.T) {
+	t.Parallel()
+
+	const (
+		testDatabase        = "test_database"
+		testTable           = "test_table"
+		testTargetTable     = "test_target_table"
+		testTempTable       = "test_temp_table"
+		testPartition       = "20240623"
+		testSourcePartition = "202406"
+
+		countQuery      = `SELECT count() FROM "test_database"."test_table" WHERE "test_table"."test_time" >= ? AND "test_table"."test_time" < ?`
+		partitionsQuery = "SELECT partition FROM system.parts WHERE database = ? AND table = ? AND active = ? AND ((min_time > 0 AND min_time < ? AND max_time >= ?) OR (min_date > '1970-01-01' AND min_date <= ? AND max_date >= ?)) GROUP BY partition"
+	)
+
+	var (
+		testWindow = timeUtils.Range{
+			From: time.Date(2024, time.June, 23, 0, 0, 0, 0, time.UTC),
+			To:   time.Date(2024, time.June, 24, 0, 0, 0, 0, time.UTC),
+		}
+		testColumns = []types.ColumnSetting{
+			{Name: "test_time", IsRollUpTime: true},
+		}
+	)
+
+	expectSourceRows := func(ctrl *gomock.Controller, shard *mock.MockShard, rows uint64, err error) {
+		rowMock := mock.NewMockRow(ctrl)
+		rowMock.EXPECT().Scan(gomock.Any()).SetArg(0, rows).Return(err)
+
+		shard.EXPECT().QueryRow(gomock.Any(), countQuery, testWindow.From, testWindow.To).Return(rowMock)
+	}
+
+	expectSourcePartitions := func(ctrl *gomock.Controller, shard *mock.MockShard, partitions ...string) {
+		rowsMock := mock.NewMockRows(ctrl)
+
+		for _, partition := range partitions {
+			rowsMock.EXPECT().Next().Return(true)
+			rowsMock.EXPECT().Scan(gomock.Any()).SetArg(0, partition)
+		}
+
+		rowsMock.EXPECT().Next()
+		rowsMock.EXPECT().Err()
+		rowsMock.EXPECT().Close()
+
+		shard.EXPECT().Query(
+			gomock.Any(),
+			partitionsQuery,
+			testDatabase,
+			testTable,
+			1,
+			testWindow.To,
+			testWindow.From,
+			"2024-06-23",
+			"2024-06-23",
+		).Return(rowsMock, nil)
+	}
+
+	tests := []struct {
+		name        string
+		targetTable string
+		partitions  []string
+		prepareMock func(ctrl *gomock.Controller, shard *mock.MockShard)
+		want        ShardReport
+		wantErr     bool
+	}{
+		{
+			name: "Nothing replaced",
+		},
+		{
+			name:       "Ok in place",
+			partitions: []string{testPartition},
+			prepareMock: func(ctrl *gomock.Controller, shard *mock.MockShard) {
+				expectPartsStats(ctrl, shard, testDatabase, testTable, []string{testPartition}, 1440, 4096)
+				expectPartsStats(ctrl, shard, testDatabase, testTempTable, []string{testPartition}, 24, 512)
+			},
+			want: ShardReport{RowsRead: 1440, RowsWritten: 24, BytesBefore: 4096, BytesAfter: 512},
+		},
+		{
+			name:        "Ok target table",
+			targetTable: testTargetTable,
+			partitions:  []string{testPartition},
+			prepareMock: func(ctrl *gomock.Controller, shard *mock.MockShard) {
+				expectSourceRows(ctrl, shard, 1440, nil)
+				expectSourcePartitions(ctrl, shard, testSourcePartition)
+				expectPartsStats(ctrl, shard, testDatabase, testTable, []string{testSourcePartition}, 43200, 65536)
+				expectPartsStats(ctrl, shard, testDatabase, testTempTable, []string{testPartition}, 24, 512)
+			},
+			want: ShardReport{RowsRead: 1440, RowsWritten: 24, BytesBefore: 65536, BytesAfter: 512},
+		},
+		{
+			name:        "Ok target table without source partitions",
+			targetTable: testTargetTable,
+			partitions:  []string{testPartition},
+			prepareMock: func(ctrl *gomock.Controller, shard *mock.MockShard) {
+				expectSourceRows(ctrl, shard, 0, nil)
+				expectSourcePartitions(ctrl, shard)
+				expectPartsStats(ctrl, shard, testDatabase, testTempTable, []string{testPartition}, 0, 0)
+			},
+			want: ShardReport{},
+		},
+		{
+			name:        "Error at count of source rows",
+			targetTable: testTargetTable,
+			partitions:  []string{testPartition},
+			prepareMock: func(ctrl *gomock.Controller, shard *mock.MockShard) {
+				expectSourceRows(ctrl, shard, 0, errors.New("test-error"))
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctrl := gomock.NewController(t)
+			shardMock := mock.NewMockShard(ctrl)
+
+			if tt.prepareMock != nil {
+				tt.prepareMock(ctrl, shardMock)
+			}
+
+			opts := RunOptions{
+				Database:    testDatabase,
+				Table:       testTable,
+				TargetTable: tt.targetTable,
+				TempTable:   testTempTable,
+				Columns:     testColumns,
+			}
+
+			var report ShardReport
+
+			err := collectPartsStats(context.Background(), shardMock, opts, testWindow, tt.partitions, &report)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.want, report)
+		})
+	}
+}
+
+func Test_getCommitWindows(t *testing.T) {
+	t.Parallel()
+
+	var (
+		testDay  = time.Date(2024, time.June, 23, 0, 0, 0, 0, time.UTC)
+		testHour = testDay.Add(time.Hour * 6)
+	)
+
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		window timeUtils.Range
+		opts   RunOptions
+		want   []timeUtils.Range
+	}{
+		{
+			name:   "Whole window",
+			window: timeUtils.Range{From: testDay, To: testDay.Add(time.Hour * 48)},
+			opts: RunOptions{
+				PartitionKey: time.Hour * 24,
+			},
+			want: []timeUtils.Range{
+				{From: testDay, To: testDay.Add(time.Hour * 48)},
+			},
+		},
+		{
+			name:   "Per partition",
+			window: timeUtils.Range{From: testDay, To: testDay.Add(time.Hour * 48)},
+			opts: RunOptions{
+				PartitionKey:       time.Hour * 24,
+				CommitPerPartition: true,
+			},
+			want: []timeUtils.Range{
+				{From: testDay, To: testDay.Add(time.Hour * 24)},
+				{From: testDay.Add(time.Hour * 24), To: testDay.Add(time.Hour * 48)},
+			},
+		},
+		{
+			name:   "Per partition with unaligned window",
+			window: timeUtils.Range{From: testHour, To: testHour.Add(time.Hour * 24)},
+			opts: RunOptions{
+				PartitionKey:       time.Hour * 24,
+				CommitPerPartition: true,
+			},
+			want: []timeUtils.Range{
+				{From: testHour, To: testDay.Add(time.Hour * 24)},
+				{From: testDay.Add(time.Hour * 24), To: testHour.Add(time.Hour * 24)},
+			},
+		},
+		{
+			name:   "Per partition in timezone",
+			window: timeUtils.Range{From: testDay.Add(-time.Hour * 3), To: testDay.Add(time.Hour * 45)},
+			opts: RunOptions{
+				PartitionKey:       time.Hour * 24,
+				CommitPerPartition: true,
+				location:           moscow,
+			},
+			want: []timeUtils.Range{
+				{From: testDay.Add(-time.Hour * 3), To: testDay.Add(time.Hour * 21)},
+				{From: testDay.Add(time.Hour * 21), To: testDay.Add(time.Hour * 45)},
+			},
+		},
+		{
+			name: "Per calendar partition",
+			window: timeUtils.Range{
+				From: time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+				To:   time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC),
+			},
+			opts: RunOptions{
+				CalendarPartitionKey: types.CalendarInterval{Unit: types.CalendarMonth},
+				CommitPerPartition:   true,
+			},
+			want: []timeUtils.Range{
+				{From: time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)},
+				{From: time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)},
+				{From: time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC)},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := getCommitWindows(tt.window, tt.opts)
+			for i := range got {
+				// Boundaries are in location of partitions.
+				got[i] = timeUtils.Range{From: got[i].From.UTC(), To: got[i].To.UTC()}
+			}
+
+			assert.Equal(t, tt.want, got)
 		})
 	}
 }
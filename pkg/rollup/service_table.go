@@ -0,0 +1,46 @@
+// Copyright 2025 LLC "Ozon Technologies".
+// SPDX-License-Identifier: Apache-2.0
+
+package rollup
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	sqlUtils "github.com/ozontech/ch-rollup/internal/utils/sql"
+	"github.com/ozontech/ch-rollup/pkg/database"
+)
+
+// serviceTableDefinition returns definition of rollup_meta_info, rollup_backup_info or rollup_audit_log with engine.
+// Service tables of replicated tables are replicated between replicas of the shard by '{shard}' and '{replica}' macros,
+// so replica elected after failover sees meta info, backups and audit log of the previous one.
+func serviceTableDefinition(definition, table string, replicated bool) string {
+	engine := "MergeTree()"
+	if replicated {
+		zooKeeperPath := fmt.Sprintf("%s/service/{shard}/%s", replicationPathPrefix, table)
+		engine = fmt.Sprintf("ReplicatedMergeTree(%s, '{replica}')", sqlUtils.QuotedString(zooKeeperPath))
+	}
+
+	return fmt.Sprintf(definition, engine)
+}
+
+// createMetaInfoTableOnShard creates meta info table and returns latest roll up of RunOptions from it.
+// Replica of replicated meta info table fetches meta info of other replicas of the shard first,
+// otherwise roll up would start from scratch after failover. It returns sql.ErrNoRows if there is no meta info.
+func createMetaInfoTableOnShard(ctx context.Context, shard database.Shard, opts RunOptions) (time.Time, error) {
+	if err := shard.Exec(ctx, serviceTableDefinition(rollUpMetaInfoTableDefinition, "rollup_meta_info", opts.Replicated)); err != nil {
+		return time.Time{}, err
+	}
+
+	if !opts.Replicated {
+		return time.Time{}, sql.ErrNoRows
+	}
+
+	if err := shard.Exec(ctx, "SYSTEM SYNC REPLICA rollup_meta_info"); err != nil {
+		return time.Time{}, fmt.Errorf("failed to sync meta info: %w", err)
+	}
+
+	return getLatestRollUpByKeyOnShard(ctx, shard, newMetaInfoKey(opts))
+}
@@ -0,0 +1,38 @@
+// Copyright 2025 LLC "Ozon Technologies".
+// SPDX-License-Identifier: Apache-2.0
+
+package rollup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_serviceTableDefinition(t *testing.T) {
+	t.Parallel()
+
+	const testDefinition = "CREATE TABLE IF NOT EXISTS test_table(id String) ENGINE = %s ORDER BY id"
+
+	tests := []struct {
+		name       string
+		replicated bool
+		want       string
+	}{
+		{
+			name: "Not replicated",
+			want: "CREATE TABLE IF NOT EXISTS test_table(id String) ENGINE = MergeTree() ORDER BY id",
+		},
+		{
+			name:       "Replicated",
+			replicated: true,
+			want:       "CREATE TABLE IF NOT EXISTS test_table(id String) ENGINE = ReplicatedMergeTree('/clickhouse/ch-rollup/service/{shard}/test_table', '{replica}') ORDER BY id",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, serviceTableDefinition(testDefinition, "test_table", tt.replicated))
+		})
+	}
+}
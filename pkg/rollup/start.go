@@ -0,0 +1,124 @@
+// Copyright 2025 LLC "Ozon Technologies".
+// SPDX-License-Identifier: Apache-2.0
+
+package rollup
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/huandu/go-sqlbuilder"
+
+	sqlUtils "github.com/ozontech/ch-rollup/internal/utils/sql"
+	"github.com/ozontech/ch-rollup/pkg/database"
+	"github.com/ozontech/ch-rollup/pkg/types"
+)
+
+// getFirstRollUpAtOnShard returns time that will be saved as latest roll up when there is no meta info yet,
+// next roll ups start from it. It's aligned to partitions boundaries.
+func getFirstRollUpAtOnShard(ctx context.Context, shard database.Shard, opts RunOptions) (time.Time, error) {
+	startAt := timeNow()
+
+	switch opts.StartFrom {
+	case types.StartFromTime:
+		startAt = opts.StartTime
+	case types.StartFromEarliestPartition:
+		earliest, err := getEarliestTimeOnShard(ctx, shard, opts)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to get earliest time of %s.%s: %w", opts.Database, opts.Table, err)
+		}
+
+		// Empty table has nothing to roll up, so it starts from now.
+		if !earliest.IsZero() {
+			startAt = earliest
+		}
+	}
+
+	return opts.partitionPeriod().truncate(startAt, opts.location), nil
+}
+
+// getEarliestTimeOnShard returns minimal time of time column at source table, zero time means the table is empty.
+// Minimum is read from min-max index of active parts in system.parts, so the table is not scanned. Parts have
+// min-max time only if partition key is by DateTime or Date column, otherwise minimum of time column is selected.
+func getEarliestTimeOnShard(ctx context.Context, shard database.Shard, opts RunOptions) (time.Time, error) {
+	// Unix time columns are integers, parts have no min-max time of them.
+	if opts.TimeColumnType != types.TimeColumnUnixSeconds && opts.TimeColumnType != types.TimeColumnUnixMilliseconds {
+		earliest, err := getEarliestPartTimeOnShard(ctx, shard, opts)
+		if err != nil || !earliest.IsZero() {
+			return earliest, err
+		}
+	}
+
+	sb := sqlbuilder.NewSelectBuilder()
+	sb.Select(generateUnixTimeStatement(fmt.Sprintf("min(%s)", sqlUtils.QuotedEntity(getTimeColumnName(opts.Columns))), opts))
+	sb.From(sqlUtils.QuotedDatabaseEntity(opts.Database, opts.Table))
+
+	sql, args := sb.BuildWithFlavor(sqlbuilder.ClickHouse)
+
+	var unix uint64
+
+	if err := shard.QueryRow(ctx, sql, args...).Scan(&unix); err != nil {
+		return time.Time{}, err
+	}
+
+	if unix == 0 {
+		return time.Time{}, nil
+	}
+
+	return time.Unix(int64(unix), 0).UTC(), nil
+}
+
+// getEarliestPartTimeOnShard returns minimal time of min-max index of active parts of source table,
+// zero time means there are no parts with time in partition key. Date is the start of day at timezone of partitions.
+func getEarliestPartTimeOnShard(ctx context.Context, shard database.Shard, opts RunOptions) (time.Time, error) {
+	sb := sqlbuilder.NewSelectBuilder().From("system.parts")
+
+	sb.Select("minIf(min_time, min_time > 0)", "minIf(min_date, min_date > '1970-01-01')")
+	sb.Where(
+		sb.Equal("database", opts.Database),
+		sb.Equal("table", opts.Table),
+		sb.Equal("active", 1),
+	)
+
+	sql, args := sb.BuildWithFlavor(sqlbuilder.ClickHouse)
+
+	var minTime, minDate time.Time
+
+	if err := shard.QueryRow(ctx, sql, args...).Scan(&minTime, &minDate); err != nil {
+		return time.Time{}, err
+	}
+
+	if minTime.Unix() > 0 {
+		return minTime.UTC(), nil
+	}
+
+	if minDate.Unix() > 0 {
+		location := opts.location
+		if location == nil {
+			location = time.UTC
+		}
+
+		return time.Date(minDate.Year(), minDate.Month(), minDate.Day(), 0, 0, 0, 0, location).UTC(), nil
+	}
+
+	return time.Time{}, nil
+}
+
+// generateUnixTimeStatement returns expression of time column type as unix time in seconds.
+// Date is converted at start of day at timezone of partitions.
+func generateUnixTimeStatement(expression string, opts RunOptions) string {
+	switch opts.TimeColumnType {
+	case types.TimeColumnUnixSeconds:
+		return fmt.Sprintf("toUInt64(%s)", expression)
+	case types.TimeColumnUnixMilliseconds:
+		return fmt.Sprintf("intDiv(%s, 1000)", expression)
+	}
+
+	timezone := ""
+	if opts.location != nil {
+		timezone = ", " + sqlUtils.QuotedString(opts.location.String())
+	}
+
+	return fmt.Sprintf("toUInt64(toUnixTimestamp(toDateTime(%s%s)))", expression, timezone)
+}
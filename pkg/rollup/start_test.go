@@ -0,0 +1,212 @@
+// Copyright 2025 LLC "Ozon Technologies".
+// SPDX-License-Identifier: Apache-2.0
+
+package rollup
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	"github.com/ozontech/ch-rollup/pkg/database/mock"
+	"github.com/ozontech/ch-rollup/pkg/types"
+)
+
+//nolint:paralleltest
+func Test_getFirstRollUpAtOnShard(t *testing.T) {
+	defer func() {
+		timeNow = time.Now
+	}()
+
+	testCurrentTime := time.Date(2025, time.June, 25, 10, 0, 0, 0, time.UTC)
+
+	timeNow = func() time.Time {
+		return testCurrentTime
+	}
+
+	testOpts := RunOptions{
+		Database:     "test_database",
+		Table:        "test_table",
+		PartitionKey: time.Hour * 24,
+		Columns: []types.ColumnSetting{
+			{Name: "test_time", IsRollUpTime: true},
+		},
+		TimeColumnType: types.TimeColumnDateTime,
+	}
+
+	partsQuery := "SELECT minIf(min_time, min_time > 0), minIf(min_date, min_date > '1970-01-01') FROM system.parts WHERE database = ? AND table = ? AND active = ?"
+
+	scanParts := func(minTime, minDate time.Time) func(dest ...any) error {
+		return func(dest ...any) error {
+			*dest[0].(*time.Time) = minTime
+			*dest[1].(*time.Time) = minDate
+
+			return nil
+		}
+	}
+
+	withStart := func(opts RunOptions, startFrom types.StartFrom, startTime time.Time) RunOptions {
+		opts.StartFrom = startFrom
+		opts.StartTime = startTime
+
+		return opts
+	}
+
+	tests := []struct {
+		name        string
+		prepareMock func(shardMock *mock.MockShard, rowMock *mock.MockRow)
+		opts        RunOptions
+		want        time.Time
+		wantErr     bool
+	}{
+		{
+			name:        "Ok now by default",
+			prepareMock: func(*mock.MockShard, *mock.MockRow) {},
+			opts:        testOpts,
+			want:        time.Date(2025, time.June, 25, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:        "Ok time",
+			prepareMock: func(*mock.MockShard, *mock.MockRow) {},
+			opts:        withStart(testOpts, types.StartFromTime, time.Date(2024, time.March, 3, 15, 0, 0, 0, time.UTC)),
+			want:        time.Date(2024, time.March, 3, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "Ok earliest partition",
+			prepareMock: func(shardMock *mock.MockShard, rowMock *mock.MockRow) {
+				shardMock.EXPECT().QueryRow(gomock.Any(), partsQuery, "test_database", "test_table", 1).Return(rowMock)
+				rowMock.EXPECT().Scan(gomock.Any(), gomock.Any()).DoAndReturn(scanParts(time.Date(2024, time.January, 5, 7, 0, 0, 0, time.UTC), time.Time{}))
+			},
+			opts: withStart(testOpts, types.StartFromEarliestPartition, time.Time{}),
+			want: time.Date(2024, time.January, 5, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "Ok earliest partition by date",
+			prepareMock: func(shardMock *mock.MockShard, rowMock *mock.MockRow) {
+				shardMock.EXPECT().QueryRow(gomock.Any(), partsQuery, "test_database", "test_table", 1).Return(rowMock)
+				rowMock.EXPECT().Scan(gomock.Any(), gomock.Any()).DoAndReturn(scanParts(time.Unix(0, 0), time.Date(2024, time.January, 5, 0, 0, 0, 0, time.UTC)))
+			},
+			opts: func() RunOptions {
+				opts := withStart(testOpts, types.StartFromEarliestPartition, time.Time{})
+				opts.location = time.FixedZone("UTC+3", 3*60*60)
+
+				return opts
+			}(),
+			want: time.Date(2024, time.January, 5, 0, 0, 0, 0, time.FixedZone("UTC+3", 3*60*60)),
+		},
+		{
+			name: "Ok earliest partition without time in partition key",
+			prepareMock: func(shardMock *mock.MockShard, rowMock *mock.MockRow) {
+				gomock.InOrder(
+					shardMock.EXPECT().QueryRow(gomock.Any(), partsQuery, "test_database", "test_table", 1).Return(rowMock),
+					rowMock.EXPECT().Scan(gomock.Any(), gomock.Any()).DoAndReturn(scanParts(time.Unix(0, 0), time.Unix(0, 0))),
+					shardMock.EXPECT().QueryRow(
+						gomock.Any(),
+						`SELECT toUInt64(toUnixTimestamp(toDateTime(min("test_time")))) FROM "test_database"."test_table"`,
+					).Return(rowMock),
+					rowMock.EXPECT().Scan(gomock.Any()).SetArg(0, uint64(time.Date(2024, time.January, 5, 7, 0, 0, 0, time.UTC).Unix())),
+				)
+			},
+			opts: withStart(testOpts, types.StartFromEarliestPartition, time.Time{}),
+			want: time.Date(2024, time.January, 5, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "Ok earliest partition of unix time column",
+			prepareMock: func(shardMock *mock.MockShard, rowMock *mock.MockRow) {
+				shardMock.EXPECT().QueryRow(
+					gomock.Any(),
+					`SELECT toUInt64(min("test_time")) FROM "test_database"."test_table"`,
+				).Return(rowMock)
+				rowMock.EXPECT().Scan(gomock.Any()).SetArg(0, uint64(time.Date(2024, time.January, 5, 7, 0, 0, 0, time.UTC).Unix()))
+			},
+			opts: func() RunOptions {
+				opts := withStart(testOpts, types.StartFromEarliestPartition, time.Time{})
+				opts.TimeColumnType = types.TimeColumnUnixSeconds
+
+				return opts
+			}(),
+			want: time.Date(2024, time.January, 5, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "Ok earliest partition of empty table",
+			prepareMock: func(shardMock *mock.MockShard, rowMock *mock.MockRow) {
+				shardMock.EXPECT().QueryRow(gomock.Any(), gomock.Any(), gomock.Any()).Return(rowMock).Times(2)
+				rowMock.EXPECT().Scan(gomock.Any(), gomock.Any()).DoAndReturn(scanParts(time.Unix(0, 0), time.Unix(0, 0)))
+				rowMock.EXPECT().Scan(gomock.Any()).SetArg(0, uint64(0))
+			},
+			opts: withStart(testOpts, types.StartFromEarliestPartition, time.Time{}),
+			want: time.Date(2025, time.June, 25, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "Failed to get earliest partition",
+			prepareMock: func(shardMock *mock.MockShard, rowMock *mock.MockRow) {
+				shardMock.EXPECT().QueryRow(gomock.Any(), gomock.Any(), gomock.Any()).Return(rowMock)
+				rowMock.EXPECT().Scan(gomock.Any(), gomock.Any()).Return(errors.New("test"))
+			},
+			opts:    withStart(testOpts, types.StartFromEarliestPartition, time.Time{}),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			shardMock := mock.NewMockShard(ctrl)
+			rowMock := mock.NewMockRow(ctrl)
+			tt.prepareMock(shardMock, rowMock)
+
+			got, err := getFirstRollUpAtOnShard(context.Background(), shardMock, tt.opts)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_generateUnixTimeStatement(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		timeColumnType types.TimeColumnType
+		location       *time.Location
+		want           string
+	}{
+		{
+			name:           "DateTime",
+			timeColumnType: types.TimeColumnDateTime,
+			want:           `toUInt64(toUnixTimestamp(toDateTime(min("t"))))`,
+		},
+		{
+			name:           "Date with timezone",
+			timeColumnType: types.TimeColumnDate,
+			location:       time.FixedZone("Europe/Moscow", 3*60*60),
+			want:           `toUInt64(toUnixTimestamp(toDateTime(min("t"), 'Europe/Moscow')))`,
+		},
+		{
+			name:           "Unix seconds",
+			timeColumnType: types.TimeColumnUnixSeconds,
+			want:           `toUInt64(min("t"))`,
+		},
+		{
+			name:           "Unix milliseconds",
+			timeColumnType: types.TimeColumnUnixMilliseconds,
+			want:           `intDiv(min("t"), 1000)`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			opts := RunOptions{
+				TimeColumnType: tt.timeColumnType,
+				location:       tt.location,
+			}
+
+			assert.Equal(t, tt.want, generateUnixTimeStatement(`min("t")`, opts))
+		})
+	}
+}
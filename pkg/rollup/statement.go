@@ -5,6 +5,9 @@ package rollup
 
 import (
 	"fmt"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/huandu/go-sqlbuilder"
@@ -19,55 +22,183 @@ import (
 type generateRollUpStatementOptions struct {
 	Database  string
 	FromTable string
-	ToTable   string
-	Interval  time.Duration
-	Columns   []types.ColumnSetting
+	// ToDatabase is a database of ToTable. Default: Database.
+	ToDatabase string
+	ToTable    string
+	Interval   time.Duration
+	Columns    []types.ColumnSetting
+	// CalendarInterval is used instead of Interval, if it's set.
+	CalendarInterval types.CalendarInterval
+	// TimeColumnType defines how time column is bucketed. Default: DateTime.
+	TimeColumnType types.TimeColumnType
+	// Location is used by window conditions of derived time columns. Default: server timezone.
+	Location *time.Location
+	// Where is a predicate of rows to roll up.
+	Where string
+	// PassThroughColumns are insertable columns of the table, they are copied as is for rows of the window
+	// that don't match Where by generatePassThroughStatement.
+	PassThroughColumns []string
+	// After and Window are values of placeholders of column expressions.
+	After  time.Duration
+	Window timeUtils.Range
+	// ResolutionColumn is filled with length of roll up interval in seconds, see withResolutionColumn.
+	ResolutionColumn string
 }
 
 func generateRollUpStatement(opts generateRollUpStatementOptions) string {
-	timeColumnName := getTimeColumnName(opts.Columns)
+	opts.Columns = withResolutionColumn(opts.Columns, opts)
+
+	toDatabase := opts.ToDatabase
+	if toDatabase == "" {
+		toDatabase = opts.Database
+	}
 
-	ib := sqlbuilder.NewInsertBuilder().InsertInto(sqlUtils.QuotedDatabaseEntity(opts.Database, opts.ToTable))
+	ib := sqlbuilder.NewInsertBuilder().InsertInto(sqlUtils.QuotedDatabaseEntity(toDatabase, opts.ToTable))
 	ib.Cols(generateRollupInsertColumnsStatement(opts.Columns)...)
 
-	sb := ib.Select(
+	buildRollUpSelect(ib.Select(), opts)
+
+	sql, _ := ib.BuildWithFlavor(sqlbuilder.ClickHouse)
+
+	return sql
+}
+
+// generateRollUpDescribeStatement returns statement that describes result columns of SELECT of generateRollUpStatement
+// without reading rows of the table. Columns are described in order of insert columns of the statement.
+func generateRollUpDescribeStatement(opts generateRollUpStatementOptions) string {
+	opts.Columns = withResolutionColumn(opts.Columns, opts)
+
+	sb := sqlbuilder.NewSelectBuilder()
+	buildRollUpSelect(sb, opts)
+
+	sql, _ := sb.BuildWithFlavor(sqlbuilder.ClickHouse)
+
+	return fmt.Sprintf("DESCRIBE (%s) SETTINGS describe_compact_output = 1", sql)
+}
+
+// buildRollUpSelect fills SELECT of rolled up rows of the window. Resolution column must be already added to columns.
+func buildRollUpSelect(sb *sqlbuilder.SelectBuilder, opts generateRollUpStatementOptions) {
+	timeColumnName := getTimeColumnName(opts.Columns)
+
+	sb.Select(
 		generateRollupSelectStatement(
-			generateIntervalStatement(timeColumnName, opts.Interval),
-			opts.Columns,
+			generateIntervalStatement(timeColumnName, opts.TimeColumnType, opts.Interval, opts.CalendarInterval),
+			// Time column is qualified by table, otherwise it's replaced by alias of rolled up time.
+			generateBucketTimeStatement(sqlUtils.QuotedDatabaseEntity(opts.FromTable, timeColumnName), opts),
+			expandColumnExpressions(opts),
 		)...,
 	)
 
 	sb.From(sqlUtils.QuotedDatabaseEntity(opts.Database, opts.FromTable))
 
-	// We will fill placeholders with time at Exec()
-	sb.Where(
-		sb.GreaterEqualThan(sqlUtils.QuotedDatabaseEntity(opts.FromTable, timeColumnName), ""),
-		sb.LessThan(sqlUtils.QuotedDatabaseEntity(opts.FromTable, timeColumnName), ""),
-	)
+	// We will fill placeholders with time at Exec(), see timeRangeArgs.
+	sb.Where(generateTimeRangeConditions(sb, opts.FromTable, opts.Columns, opts.Location, make([]any, timeRangeArgsCount(opts.Columns)))...)
+
+	if opts.Where != "" {
+		sb.Where(fmt.Sprintf("(%s)", opts.Where))
+	}
 
 	sb.GroupBy(generateGroupByStatement(opts.Columns)...)
+}
+
+// generatePassThroughStatement returns statement that copies rows of the window that don't match
+// generateRollUpStatementOptions.Where with all PassThroughColumns as is. It returns empty string
+// if there are no such rows. Rolled up rows get defaults of columns that are not set at Columns,
+// so rows that are not rolled up are copied by separate statement.
+func generatePassThroughStatement(opts generateRollUpStatementOptions) string {
+	if opts.Where == "" || len(opts.PassThroughColumns) == 0 {
+		return ""
+	}
+
+	toDatabase := opts.ToDatabase
+	if toDatabase == "" {
+		toDatabase = opts.Database
+	}
+
+	columns := sliceUtils.ConvertFunc(opts.PassThroughColumns, sqlUtils.QuotedEntity)
+
+	ib := sqlbuilder.NewInsertBuilder().InsertInto(sqlUtils.QuotedDatabaseEntity(toDatabase, opts.ToTable))
+	ib.Cols(columns...)
+
+	sb := ib.Select(columns...)
+	sb.From(sqlUtils.QuotedDatabaseEntity(opts.Database, opts.FromTable))
+	sb.Where(generateTimeRangeConditions(sb, opts.FromTable, opts.Columns, opts.Location, make([]any, timeRangeArgsCount(opts.Columns)))...)
+	// NULL result of predicate means that row is not rolled up.
+	sb.Where(fmt.Sprintf("NOT ifNull((%s), 0)", opts.Where))
 
 	sql, _ := ib.BuildWithFlavor(sqlbuilder.ClickHouse)
+
 	return sql
 }
 
+// generateCopyStatements returns statements that copy the window to temp table.
+// REPLACE PARTITION replaces whole partitions, so rows that are not rolled up are copied too.
+// All statements are executed with timeRangeArgs of each copy interval.
+func generateCopyStatements(opts generateRollUpStatementOptions) []string {
+	result := []string{generateRollUpStatement(opts)}
+
+	if passThrough := generatePassThroughStatement(opts); passThrough != "" {
+		result = append(result, passThrough)
+	}
+
+	return result
+}
+
+// expandColumnExpressions returns columns with placeholders of expressions replaced by values of the roll up.
+func expandColumnExpressions(opts generateRollUpStatementOptions) []types.ColumnSetting {
+	result := slices.Clone(opts.Columns)
+
+	for i, column := range result {
+		if column.Expression != "" {
+			result[i].Expression = sqlUtils.ExpandPlaceholders(column.Expression, placeholderValues(column.Name, opts))
+		}
+	}
+
+	return result
+}
+
+// placeholderValues returns values of types.ExpressionPlaceholders for the column.
+func placeholderValues(column string, opts generateRollUpStatementOptions) map[string]string {
+	timezone := ""
+	if opts.Location != nil {
+		timezone = ", " + sqlUtils.QuotedString(opts.Location.String())
+	}
+
+	return map[string]string{
+		types.PlaceholderColumn:      sqlUtils.QuotedEntity(column),
+		types.PlaceholderIntervalSec: strconv.Itoa(timeUtils.SecondsFromDuration(opts.Interval)),
+		types.PlaceholderAfterSec:    strconv.Itoa(timeUtils.SecondsFromDuration(opts.After)),
+		types.PlaceholderWindowFrom:  fmt.Sprintf("toDateTime(%d%s)", opts.Window.From.Unix(), timezone),
+		types.PlaceholderWindowTo:    fmt.Sprintf("toDateTime(%d%s)", opts.Window.To.Unix(), timezone),
+	}
+}
+
 func generateRollupInsertColumnsStatement(columns []types.ColumnSetting) []string {
 	return sliceUtils.ConvertFuncWithSkip(
 		columns,
 		func(elem types.ColumnSetting) (string, bool) {
-			return sqlUtils.QuotedEntity(elem.Name), false
+			// Reset column gets default value of the table.
+			return sqlUtils.QuotedEntity(elem.Name), elem.IsReset
 		},
 	)
 }
 
-func generateRollupSelectStatement(intervalStatement string, columns []types.ColumnSetting) []string {
+func generateRollupSelectStatement(intervalStatement, bucketTimeStatement string, columns []types.ColumnSetting) []string {
 	return sliceUtils.ConvertFuncWithSkip(
 		columns,
 		func(elem types.ColumnSetting) (string, bool) {
+			if elem.IsReset {
+				return "", true
+			}
+
 			if elem.IsRollUpTime {
 				return intervalStatement, false
 			}
 
+			if elem.DerivedFromTime != "" {
+				return fmt.Sprintf("%s(%s) as %s", elem.DerivedFromTime, bucketTimeStatement, sqlUtils.QuotedEntity(elem.Name)), false
+			}
+
 			if elem.Expression == "" {
 				return sqlUtils.QuotedEntity(elem.Name), false
 			}
@@ -81,13 +212,129 @@ func generateGroupByStatement(columns []types.ColumnSetting) []string {
 	return sliceUtils.ConvertFuncWithSkip(
 		columns,
 		func(elem types.ColumnSetting) (string, bool) {
-			return sqlUtils.QuotedEntity(elem.Name), elem.Expression != ""
+			return sqlUtils.QuotedEntity(elem.Name), elem.Expression != "" || elem.IsReset
 		},
 	)
 }
 
-func generateIntervalStatement(timeColumn string, interval time.Duration) string {
-	return fmt.Sprintf("toStartOfInterval(%s, INTERVAL %d SECOND) as %s", sqlUtils.QuotedEntity(timeColumn), timeUtils.SecondsFromDuration(interval), sqlUtils.QuotedEntity(timeColumn))
+// calendarStartFunctions are functions that return start of a single calendar unit.
+var calendarStartFunctions = map[types.CalendarUnit]string{
+	types.CalendarWeek:    "toMonday",
+	types.CalendarMonth:   "toStartOfMonth",
+	types.CalendarQuarter: "toStartOfQuarter",
+	types.CalendarYear:    "toStartOfYear",
+}
+
+func generateIntervalStatement(timeColumn string, timeColumnType types.TimeColumnType, interval time.Duration, calendarInterval types.CalendarInterval) string {
+	column := sqlUtils.QuotedEntity(timeColumn)
+
+	switch timeColumnType {
+	case types.TimeColumnUnixSeconds:
+		return fmt.Sprintf("%s as %s", generateUnixBucketStatement(column, 1, interval, calendarInterval), column)
+	case types.TimeColumnUnixMilliseconds:
+		return fmt.Sprintf("%s as %s", generateUnixBucketStatement(column, 1000, interval, calendarInterval), column)
+	default:
+		return fmt.Sprintf("%s as %s", generateBucketStatement(column, timeColumnType, interval, calendarInterval), column)
+	}
+}
+
+// generateBucketStatement returns start of the interval of DateTime, DateTime64 or Date expression.
+func generateBucketStatement(expression string, timeColumnType types.TimeColumnType, interval time.Duration, calendarInterval types.CalendarInterval) string {
+	if !calendarInterval.IsZero() {
+		return generateCalendarBucketStatement(expression, calendarInterval)
+	}
+
+	if timeColumnType == types.TimeColumnDate {
+		return fmt.Sprintf("toStartOfInterval(%s, INTERVAL %d DAY)", expression, interval/day)
+	}
+
+	return fmt.Sprintf("toStartOfInterval(%s, INTERVAL %d SECOND)", expression, timeUtils.SecondsFromDuration(interval))
+}
+
+func generateCalendarBucketStatement(expression string, calendarInterval types.CalendarInterval) string {
+	if calendarInterval.Units() == 1 {
+		return fmt.Sprintf("%s(%s)", calendarStartFunctions[calendarInterval.Unit], expression)
+	}
+
+	return fmt.Sprintf(
+		"toStartOfInterval(%s, INTERVAL %d %s)",
+		expression,
+		calendarInterval.Units(),
+		strings.ToUpper(string(calendarInterval.Unit)),
+	)
+}
+
+// generateBucketTimeStatement returns start of the interval of time column as DateTime, Date or DateTime64.
+func generateBucketTimeStatement(column string, opts generateRollUpStatementOptions) string {
+	switch opts.TimeColumnType {
+	case types.TimeColumnUnixSeconds:
+		return fmt.Sprintf("toDateTime(%s)", generateUnixBucketStatement(column, 1, opts.Interval, opts.CalendarInterval))
+	case types.TimeColumnUnixMilliseconds:
+		return fmt.Sprintf("toDateTime(intDiv(%s, 1000))", generateUnixBucketStatement(column, 1000, opts.Interval, opts.CalendarInterval))
+	default:
+		return generateBucketStatement(column, opts.TimeColumnType, opts.Interval, opts.CalendarInterval)
+	}
+}
+
+// generateTimeRangeConditions returns conditions of time range on time column and derived time columns of the table.
+// Derived columns are compared with functions of time range bounds, so reads are pruned by their partitions.
+// Upper bound of derived column is inclusive, because function of the time can be equal to function of the end of range.
+// Args must be in order of timeRangeArgs.
+func generateTimeRangeConditions(sb *sqlbuilder.SelectBuilder, table string, columns []types.ColumnSetting, location *time.Location, args []any) []string {
+	timeColumn := sqlUtils.QuotedDatabaseEntity(table, getTimeColumnName(columns))
+
+	conditions := []string{
+		sb.GreaterEqualThan(timeColumn, args[0]),
+		sb.LessThan(timeColumn, args[1]),
+	}
+
+	timezone := ""
+	if location != nil {
+		timezone = ", " + sqlUtils.QuotedString(location.String())
+	}
+
+	for i, column := range getDerivedTimeColumns(columns) {
+		derivedColumn := sqlUtils.QuotedDatabaseEntity(table, column.Name)
+
+		conditions = append(
+			conditions,
+			fmt.Sprintf("%s >= %s(%s%s)", derivedColumn, column.DerivedFromTime, sb.Var(args[2+i*2]), timezone),
+			fmt.Sprintf("%s <= %s(%s%s)", derivedColumn, column.DerivedFromTime, sb.Var(args[3+i*2]), timezone),
+		)
+	}
+
+	return conditions
+}
+
+func getDerivedTimeColumns(columns []types.ColumnSetting) []types.ColumnSetting {
+	return slices.DeleteFunc(slices.Clone(columns), func(column types.ColumnSetting) bool {
+		return column.DerivedFromTime == ""
+	})
+}
+
+// generateUnixBucketStatement returns start of the interval of unix time column, which has unitsPerSecond precision.
+func generateUnixBucketStatement(column string, unitsPerSecond int64, interval time.Duration, calendarInterval types.CalendarInterval) string {
+	if calendarInterval.IsZero() {
+		units := int64(interval/time.Second) * unitsPerSecond
+
+		return fmt.Sprintf("intDiv(%s, %d) * %d", column, units, units)
+	}
+
+	seconds := column
+	if unitsPerSecond > 1 {
+		seconds = fmt.Sprintf("intDiv(%s, %d)", column, unitsPerSecond)
+	}
+
+	bucket := fmt.Sprintf(
+		"toUnixTimestamp(toDateTime(%s))",
+		generateCalendarBucketStatement(fmt.Sprintf("toDateTime(%s)", seconds), calendarInterval),
+	)
+
+	if unitsPerSecond > 1 {
+		return fmt.Sprintf("%s * %d", bucket, unitsPerSecond)
+	}
+
+	return bucket
 }
 
 func getTimeColumnName(columns []types.ColumnSetting) string {
@@ -4,11 +4,13 @@
 package rollup
 
 import (
+	"slices"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 
+	timeUtils "github.com/ozontech/ch-rollup/internal/utils/time"
 	"github.com/ozontech/ch-rollup/pkg/types"
 )
 
@@ -46,6 +48,308 @@ func Test_generateRollUpStatement(t *testing.T) {
 			},
 			want: `INSERT INTO "test_database"."test_to_table" ("first", "second", "third", "rollup_time") SELECT "first", max(second), "third", toStartOfInterval("rollup_time", INTERVAL 3600 SECOND) as "rollup_time" FROM "test_database"."test_from_table" WHERE "test_from_table"."rollup_time" >= ? AND "test_from_table"."rollup_time" < ? GROUP BY "first", "third", "rollup_time"`,
 		},
+		{
+			name: "Reset column",
+			opts: generateRollUpStatementOptions{
+				Database:  "test_database",
+				FromTable: "test_from_table",
+				ToTable:   "test_to_table",
+				Interval:  time.Hour,
+				Columns: []types.ColumnSetting{
+					{
+						Name: "first",
+					},
+					{
+						Name:    "request_id",
+						IsReset: true,
+					},
+					{
+						Name:         "rollup_time",
+						IsRollUpTime: true,
+					},
+				},
+			},
+			want: `INSERT INTO "test_database"."test_to_table" ("first", "rollup_time") SELECT "first", toStartOfInterval("rollup_time", INTERVAL 3600 SECOND) as "rollup_time" FROM "test_database"."test_from_table" WHERE "test_from_table"."rollup_time" >= ? AND "test_from_table"."rollup_time" < ? GROUP BY "first", "rollup_time"`,
+		},
+		{
+			name: "Calendar month",
+			opts: generateRollUpStatementOptions{
+				Database:  "test_database",
+				FromTable: "test_from_table",
+				ToTable:   "test_to_table",
+				Columns: []types.ColumnSetting{
+					{
+						Name: "first",
+					},
+					{
+						Name:         "rollup_time",
+						IsRollUpTime: true,
+					},
+				},
+				CalendarInterval: types.CalendarInterval{Unit: types.CalendarMonth},
+			},
+			want: `INSERT INTO "test_database"."test_to_table" ("first", "rollup_time") SELECT "first", toStartOfMonth("rollup_time") as "rollup_time" FROM "test_database"."test_from_table" WHERE "test_from_table"."rollup_time" >= ? AND "test_from_table"."rollup_time" < ? GROUP BY "first", "rollup_time"`,
+		},
+		{
+			name: "Calendar weeks",
+			opts: generateRollUpStatementOptions{
+				Database:  "test_database",
+				FromTable: "test_from_table",
+				ToTable:   "test_to_table",
+				Columns: []types.ColumnSetting{
+					{
+						Name: "first",
+					},
+					{
+						Name:         "rollup_time",
+						IsRollUpTime: true,
+					},
+				},
+				CalendarInterval: types.CalendarInterval{Unit: types.CalendarWeek, Count: 2},
+			},
+			want: `INSERT INTO "test_database"."test_to_table" ("first", "rollup_time") SELECT "first", toStartOfInterval("rollup_time", INTERVAL 2 WEEK) as "rollup_time" FROM "test_database"."test_from_table" WHERE "test_from_table"."rollup_time" >= ? AND "test_from_table"."rollup_time" < ? GROUP BY "first", "rollup_time"`,
+		},
+		{
+			name: "Date",
+			opts: generateRollUpStatementOptions{
+				Database:  "test_database",
+				FromTable: "test_from_table",
+				ToTable:   "test_to_table",
+				Columns: []types.ColumnSetting{
+					{
+						Name: "first",
+					},
+					{
+						Name:         "rollup_time",
+						IsRollUpTime: true,
+					},
+				},
+				Interval:       time.Hour * 48,
+				TimeColumnType: types.TimeColumnDate,
+			},
+			want: `INSERT INTO "test_database"."test_to_table" ("first", "rollup_time") SELECT "first", toStartOfInterval("rollup_time", INTERVAL 2 DAY) as "rollup_time" FROM "test_database"."test_from_table" WHERE "test_from_table"."rollup_time" >= ? AND "test_from_table"."rollup_time" < ? GROUP BY "first", "rollup_time"`,
+		},
+		{
+			name: "Unix seconds",
+			opts: generateRollUpStatementOptions{
+				Database:  "test_database",
+				FromTable: "test_from_table",
+				ToTable:   "test_to_table",
+				Columns: []types.ColumnSetting{
+					{
+						Name: "first",
+					},
+					{
+						Name:         "rollup_time",
+						IsRollUpTime: true,
+					},
+				},
+				Interval:       time.Hour,
+				TimeColumnType: types.TimeColumnUnixSeconds,
+			},
+			want: `INSERT INTO "test_database"."test_to_table" ("first", "rollup_time") SELECT "first", intDiv("rollup_time", 3600) * 3600 as "rollup_time" FROM "test_database"."test_from_table" WHERE "test_from_table"."rollup_time" >= ? AND "test_from_table"."rollup_time" < ? GROUP BY "first", "rollup_time"`,
+		},
+		{
+			name: "Unix milliseconds",
+			opts: generateRollUpStatementOptions{
+				Database:  "test_database",
+				FromTable: "test_from_table",
+				ToTable:   "test_to_table",
+				Columns: []types.ColumnSetting{
+					{
+						Name: "first",
+					},
+					{
+						Name:         "rollup_time",
+						IsRollUpTime: true,
+					},
+				},
+				Interval:       time.Hour,
+				TimeColumnType: types.TimeColumnUnixMilliseconds,
+			},
+			want: `INSERT INTO "test_database"."test_to_table" ("first", "rollup_time") SELECT "first", intDiv("rollup_time", 3600000) * 3600000 as "rollup_time" FROM "test_database"."test_from_table" WHERE "test_from_table"."rollup_time" >= ? AND "test_from_table"."rollup_time" < ? GROUP BY "first", "rollup_time"`,
+		},
+		{
+			name: "Unix milliseconds calendar month",
+			opts: generateRollUpStatementOptions{
+				Database:  "test_database",
+				FromTable: "test_from_table",
+				ToTable:   "test_to_table",
+				Columns: []types.ColumnSetting{
+					{
+						Name: "first",
+					},
+					{
+						Name:         "rollup_time",
+						IsRollUpTime: true,
+					},
+				},
+				CalendarInterval: types.CalendarInterval{Unit: types.CalendarMonth},
+				TimeColumnType:   types.TimeColumnUnixMilliseconds,
+			},
+			want: `INSERT INTO "test_database"."test_to_table" ("first", "rollup_time") SELECT "first", toUnixTimestamp(toDateTime(toStartOfMonth(toDateTime(intDiv("rollup_time", 1000))))) * 1000 as "rollup_time" FROM "test_database"."test_from_table" WHERE "test_from_table"."rollup_time" >= ? AND "test_from_table"."rollup_time" < ? GROUP BY "first", "rollup_time"`,
+		},
+		{
+			name: "Derived time column",
+			opts: generateRollUpStatementOptions{
+				Database:  "test_database",
+				FromTable: "test_from_table",
+				ToTable:   "test_to_table",
+				Interval:  time.Hour,
+				Columns: []types.ColumnSetting{
+					{
+						Name:            "rollup_date",
+						DerivedFromTime: "toDate",
+					},
+					{
+						Name:         "rollup_time",
+						IsRollUpTime: true,
+					},
+				},
+				Location: time.UTC,
+			},
+			want: `INSERT INTO "test_database"."test_to_table" ("rollup_date", "rollup_time") SELECT toDate(toStartOfInterval("test_from_table"."rollup_time", INTERVAL 3600 SECOND)) as "rollup_date", toStartOfInterval("rollup_time", INTERVAL 3600 SECOND) as "rollup_time" FROM "test_database"."test_from_table" WHERE "test_from_table"."rollup_time" >= ? AND "test_from_table"."rollup_time" < ? AND "test_from_table"."rollup_date" >= toDate(?, 'UTC') AND "test_from_table"."rollup_date" <= toDate(?, 'UTC') GROUP BY "rollup_date", "rollup_time"`,
+		},
+		{
+			name: "Derived time column of unix seconds",
+			opts: generateRollUpStatementOptions{
+				Database:  "test_database",
+				FromTable: "test_from_table",
+				ToTable:   "test_to_table",
+				Interval:  time.Hour,
+				Columns: []types.ColumnSetting{
+					{
+						Name:            "rollup_date",
+						DerivedFromTime: "toDate",
+					},
+					{
+						Name:         "rollup_time",
+						IsRollUpTime: true,
+					},
+				},
+				TimeColumnType: types.TimeColumnUnixSeconds,
+			},
+			want: `INSERT INTO "test_database"."test_to_table" ("rollup_date", "rollup_time") SELECT toDate(toDateTime(intDiv("test_from_table"."rollup_time", 3600) * 3600)) as "rollup_date", intDiv("rollup_time", 3600) * 3600 as "rollup_time" FROM "test_database"."test_from_table" WHERE "test_from_table"."rollup_time" >= ? AND "test_from_table"."rollup_time" < ? AND "test_from_table"."rollup_date" >= toDate(?) AND "test_from_table"."rollup_date" <= toDate(?) GROUP BY "rollup_date", "rollup_time"`,
+		},
+		{
+			name: "Where",
+			opts: generateRollUpStatementOptions{
+				Database:  "test_database",
+				FromTable: "test_from_table",
+				ToTable:   "test_to_table",
+				Interval:  time.Hour,
+				Columns: []types.ColumnSetting{
+					{
+						Name: "service_tier",
+					},
+					{
+						Name:       "hits",
+						Expression: "sum(hits)",
+					},
+					{
+						Name:         "rollup_time",
+						IsRollUpTime: true,
+					},
+				},
+				Where:              "service_tier = 'low'",
+				PassThroughColumns: []string{"service_tier", "hits", "rollup_time", "comment"},
+			},
+			want: `INSERT INTO "test_database"."test_to_table" ("service_tier", "hits", "rollup_time") SELECT "service_tier", sum(hits), toStartOfInterval("rollup_time", INTERVAL 3600 SECOND) as "rollup_time" FROM "test_database"."test_from_table" WHERE "test_from_table"."rollup_time" >= ? AND "test_from_table"."rollup_time" < ? AND (service_tier = 'low') GROUP BY "service_tier", "rollup_time"`,
+		},
+		{
+			name: "Target database",
+			opts: generateRollUpStatementOptions{
+				Database:   "test_database",
+				FromTable:  "test_from_table",
+				ToDatabase: "test_target_database",
+				ToTable:    "test_to_table",
+				Interval:   time.Hour,
+				Columns: []types.ColumnSetting{
+					{
+						Name:       "hits",
+						Expression: "sum(hits)",
+					},
+					{
+						Name:         "rollup_time",
+						IsRollUpTime: true,
+					},
+				},
+				Where: "hits > 0",
+			},
+			want: `INSERT INTO "test_target_database"."test_to_table" ("hits", "rollup_time") SELECT sum(hits), toStartOfInterval("rollup_time", INTERVAL 3600 SECOND) as "rollup_time" FROM "test_database"."test_from_table" WHERE "test_from_table"."rollup_time" >= ? AND "test_from_table"."rollup_time" < ? AND (hits > 0) GROUP BY "rollup_time"`,
+		},
+		{
+			name: "Placeholders",
+			opts: generateRollUpStatementOptions{
+				Database:  "test_database",
+				FromTable: "test_from_table",
+				ToTable:   "test_to_table",
+				Interval:  time.Hour,
+				After:     time.Hour * 24,
+				Window: timeUtils.Range{
+					From: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+					To:   time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC),
+				},
+				Location: time.UTC,
+				Columns: []types.ColumnSetting{
+					{
+						Name:       "hits",
+						Expression: "countMergeState({column})",
+					},
+					{
+						Name:       "rollup_interval",
+						Expression: "{interval_sec}",
+					},
+					{
+						Name:       "rollup_info",
+						Expression: "concat('{column}', toString({after_sec}), toString({window_from}), toString({window_to}))",
+					},
+					{
+						Name:         "rollup_time",
+						IsRollUpTime: true,
+					},
+				},
+			},
+			want: `INSERT INTO "test_database"."test_to_table" ("hits", "rollup_interval", "rollup_info", "rollup_time") SELECT countMergeState("hits"), 3600, concat('{column}', toString(86400), toString(toDateTime(1735689600, 'UTC')), toString(toDateTime(1735776000, 'UTC'))), toStartOfInterval("rollup_time", INTERVAL 3600 SECOND) as "rollup_time" FROM "test_database"."test_from_table" WHERE "test_from_table"."rollup_time" >= ? AND "test_from_table"."rollup_time" < ? GROUP BY "rollup_time"`,
+		},
+		{
+			name: "Resolution column",
+			opts: generateRollUpStatementOptions{
+				Database:  "test_database",
+				FromTable: "test_from_table",
+				ToTable:   "test_to_table",
+				Interval:  time.Hour,
+				Columns: []types.ColumnSetting{
+					{
+						Name:       "hits",
+						Expression: "sum(hits)",
+					},
+					{
+						Name:         "rollup_time",
+						IsRollUpTime: true,
+					},
+				},
+				ResolutionColumn: "rollup_interval",
+			},
+			want: `INSERT INTO "test_database"."test_to_table" ("hits", "rollup_time", "rollup_interval") SELECT sum(hits), toStartOfInterval("rollup_time", INTERVAL 3600 SECOND) as "rollup_time", 3600 FROM "test_database"."test_from_table" WHERE "test_from_table"."rollup_time" >= ? AND "test_from_table"."rollup_time" < ? GROUP BY "rollup_time"`,
+		},
+		{
+			name: "Resolution column of calendar interval",
+			opts: generateRollUpStatementOptions{
+				Database:         "test_database",
+				FromTable:        "test_from_table",
+				ToTable:          "test_to_table",
+				CalendarInterval: types.CalendarInterval{Unit: types.CalendarMonth},
+				Columns: []types.ColumnSetting{
+					{
+						Name:         "rollup_time",
+						IsRollUpTime: true,
+					},
+				},
+				ResolutionColumn: "rollup_interval",
+			},
+			want: `INSERT INTO "test_database"."test_to_table" ("rollup_time", "rollup_interval") SELECT toStartOfMonth("rollup_time") as "rollup_time", dateDiff('second', toStartOfMonth("test_from_table"."rollup_time"), toStartOfMonth("test_from_table"."rollup_time") + INTERVAL 1 MONTH) FROM "test_database"."test_from_table" WHERE "test_from_table"."rollup_time" >= ? AND "test_from_table"."rollup_time" < ? GROUP BY "rollup_time"`,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -54,3 +358,99 @@ func Test_generateRollUpStatement(t *testing.T) {
 		})
 	}
 }
+
+func Test_generatePassThroughStatement(t *testing.T) {
+	t.Parallel()
+
+	testColumns := []types.ColumnSetting{
+		{
+			Name: "service_tier",
+		},
+		{
+			Name:       "hits",
+			Expression: "sum(hits)",
+		},
+		{
+			Name:         "rollup_time",
+			IsRollUpTime: true,
+		},
+	}
+
+	tests := []struct {
+		name string
+		opts generateRollUpStatementOptions
+		want string
+	}{
+		{
+			name: "Without where",
+			opts: generateRollUpStatementOptions{
+				Database:           "test_database",
+				FromTable:          "test_from_table",
+				ToTable:            "test_to_table",
+				Interval:           time.Hour,
+				Columns:            testColumns,
+				PassThroughColumns: []string{"service_tier", "hits", "rollup_time"},
+			},
+			want: "",
+		},
+		{
+			name: "Unlisted and reset columns",
+			opts: generateRollUpStatementOptions{
+				Database:  "test_database",
+				FromTable: "test_from_table",
+				ToTable:   "test_to_table",
+				Interval:  time.Hour,
+				Columns: append(slices.Clone(testColumns), types.ColumnSetting{
+					Name:    "session_id",
+					IsReset: true,
+				}),
+				Where:              "service_tier = 'low'",
+				PassThroughColumns: []string{"service_tier", "hits", "rollup_time", "session_id", "comment"},
+			},
+			want: `INSERT INTO "test_database"."test_to_table" ("service_tier", "hits", "rollup_time", "session_id", "comment") SELECT "service_tier", "hits", "rollup_time", "session_id", "comment" FROM "test_database"."test_from_table" WHERE "test_from_table"."rollup_time" >= ? AND "test_from_table"."rollup_time" < ? AND NOT ifNull((service_tier = 'low'), 0)`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, generatePassThroughStatement(tt.opts))
+		})
+	}
+}
+
+func Test_generateRollUpDescribeStatement(t *testing.T) {
+	t.Parallel()
+
+	opts := generateRollUpStatementOptions{
+		Database:  "test_database",
+		FromTable: "test_from_table",
+		ToTable:   "test_to_table",
+		Interval:  time.Hour,
+		Columns: []types.ColumnSetting{
+			{
+				Name: "service",
+			},
+			{
+				Name:       "hits",
+				Expression: "sum(hits)",
+			},
+			{
+				Name:    "request_id",
+				IsReset: true,
+			},
+			{
+				Name:       "interval_sec",
+				Expression: types.PlaceholderIntervalSec,
+			},
+			{
+				Name:         "rollup_time",
+				IsRollUpTime: true,
+			},
+		},
+		ResolutionColumn: "rollup_interval",
+	}
+
+	want := `DESCRIBE (SELECT "service", sum(hits), 3600, toStartOfInterval("rollup_time", INTERVAL 3600 SECOND) as "rollup_time", 3600 FROM "test_database"."test_from_table" WHERE "test_from_table"."rollup_time" >= ? AND "test_from_table"."rollup_time" < ? GROUP BY "service", "rollup_time") SETTINGS describe_compact_output = 1`
+
+	assert.Equal(t, want, generateRollUpDescribeStatement(opts))
+}
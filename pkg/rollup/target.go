@@ -0,0 +1,119 @@
+// Copyright 2025 LLC "Ozon Technologies".
+// SPDX-License-Identifier: Apache-2.0
+
+package rollup
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/huandu/go-sqlbuilder"
+
+	sqlUtils "github.com/ozontech/ch-rollup/internal/utils/sql"
+	timeUtils "github.com/ozontech/ch-rollup/internal/utils/time"
+	"github.com/ozontech/ch-rollup/pkg/database"
+)
+
+// targetDatabase returns database of the table which partitions are replaced by rolled up data.
+func (opts *RunOptions) targetDatabase() string {
+	if opts.TargetDatabase == "" {
+		return opts.Database
+	}
+
+	return opts.TargetDatabase
+}
+
+// targetTable returns the table which partitions are replaced by rolled up data.
+func (opts *RunOptions) targetTable() string {
+	if opts.TargetTable == "" {
+		return opts.Table
+	}
+
+	return opts.TargetTable
+}
+
+// inPlace reports whether rolled up data replaces data of the table it's read from.
+func (opts *RunOptions) inPlace() bool {
+	return opts.targetDatabase() == opts.Database && opts.targetTable() == opts.Table
+}
+
+// dropSourcePartitionsOnShard drops partitions of source table that are rolled up to target table
+// and older than RunOptions.DropSourceAfter. Only partitions that lie fully inside of the range rolled up
+// according to meta info of target table are dropped, data before the first roll up never reached it.
+func dropSourcePartitionsOnShard(ctx context.Context, shard database.Shard, opts RunOptions, rolledUpTo time.Time, report *ShardReport) error {
+	if opts.DropSourceAfter <= 0 {
+		return nil
+	}
+
+	rolledUp, err := getRolledUpRangeByKeyOnShard(ctx, shard, newMetaInfoKey(opts))
+	if err != nil {
+		if isMetaInfoNotFound(err) {
+			return nil
+		}
+
+		return fmt.Errorf("failed to get rolled up range of %s.%s: %w", opts.targetDatabase(), opts.targetTable(), err)
+	}
+
+	dropRange := timeUtils.Range{
+		From: rolledUp.From,
+		To:   timeNow().Add(-opts.DropSourceAfter),
+	}
+
+	if rolledUpTo.Before(dropRange.To) {
+		// Data that is not rolled up yet must stay.
+		dropRange.To = rolledUpTo
+	}
+
+	if !dropRange.From.Before(dropRange.To) {
+		return nil
+	}
+
+	partitions, err := getPartitionsWithinOnShard(ctx, shard, opts.Database, opts.Table, dropRange, opts.location)
+	if err != nil {
+		return fmt.Errorf("failed to get %s.%s partitions: %w", opts.Database, opts.Table, err)
+	}
+
+	if err = dropPartitionsOnShard(ctx, shard, opts.Database, opts.Table, partitions, opts.Replicated); err != nil {
+		return fmt.Errorf("failed to drop partitions of %s.%s: %w", opts.Database, opts.Table, err)
+	}
+
+	report.DroppedPartitions = append(report.DroppedPartitions, partitions...)
+
+	return nil
+}
+
+// getSourceStatsOnShard returns number of rows of source table in the window
+// and size on disk of source partitions with parts that may contain rows of the window.
+func getSourceStatsOnShard(ctx context.Context, shard database.Shard, opts RunOptions, window timeUtils.Range) (partsStats, error) {
+	sb := sqlbuilder.NewSelectBuilder()
+	sb.Select("count()")
+	sb.From(sqlUtils.QuotedDatabaseEntity(opts.Database, opts.Table))
+	sb.Where(generateTimeRangeConditions(sb, opts.Table, opts.Columns, opts.location, timeRangeArgs(window, opts))...)
+
+	sql, args := sb.BuildWithFlavor(sqlbuilder.ClickHouse)
+
+	var result partsStats
+
+	if err := shard.QueryRow(ctx, sql, args...).Scan(&result.Rows); err != nil {
+		return partsStats{}, fmt.Errorf("failed to count rows of %s.%s: %w", opts.Database, opts.Table, err)
+	}
+
+	partitions, err := getPartitionsOverlappingOnShard(ctx, shard, opts.Database, opts.Table, window, opts.location)
+	if err != nil {
+		return partsStats{}, fmt.Errorf("failed to get %s.%s partitions: %w", opts.Database, opts.Table, err)
+	}
+
+	if len(partitions) == 0 {
+		return result, nil
+	}
+
+	stats, err := getPartsStatsOnShard(ctx, shard, opts.Database, opts.Table, partitions)
+	if err != nil {
+		return partsStats{}, fmt.Errorf("failed to get %s.%s parts stats: %w", opts.Database, opts.Table, err)
+	}
+
+	result.Bytes = stats.Bytes
+
+	return result, nil
+}
@@ -0,0 +1,207 @@
+// Copyright 2025 LLC "Ozon Technologies".
+// SPDX-License-Identifier: Apache-2.0
+
+package rollup
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	"github.com/ozontech/ch-rollup/pkg/database/mock"
+)
+
+//nolint:paralleltest
+func Test_dropSourcePartitionsOnShard(t *testing.T) {
+	defer func() {
+		timeNow = time.Now
+	}()
+
+	const (
+		testDatabase    = "test_database"
+		testTable       = "test_table"
+		testTargetTable = "test_target_table"
+		testPartition   = "20240601"
+
+		rangeQuery  = "SELECT min(roll_ups_at), max(roll_ups_at) FROM rollup_meta_info WHERE database = ? AND table = ? AND after_sec = ? AND interval_sec = ? GROUP BY database, table, after_sec, interval_sec"
+		selectQuery = "SELECT partition FROM system.parts WHERE database = ? AND table = ? AND active = ? GROUP BY partition HAVING ((min(min_time) > 0 AND min(min_time) >= ? AND max(max_time) < ?) OR (min(min_date) > '1970-01-01' AND min(min_date) >= ? AND max(max_date) < ?))"
+		dropQuery   = `ALTER TABLE "test_database"."test_table" DROP PARTITION ?`
+	)
+
+	var (
+		testCurrentTime  = time.Date(2024, time.June, 30, 0, 0, 0, 0, time.UTC)
+		testFirstRollUp  = time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)
+		testRolledUpTo   = time.Date(2024, time.June, 25, 0, 0, 0, 0, time.UTC)
+		testDropBefore   = testCurrentTime.Add(-time.Hour * 24 * 7)
+		testMoscow       = time.FixedZone("Europe/Moscow", 3*60*60)
+		testMoscowFirst  = time.Date(2024, time.June, 1, 0, 0, 0, 0, testMoscow)
+		testMoscowRolled = time.Date(2024, time.June, 25, 0, 0, 0, 0, testMoscow)
+	)
+
+	expectRolledUpRange := func(ctrl *gomock.Controller, shard *mock.MockShard, from, to time.Time) *gomock.Call {
+		rowMock := mock.NewMockRow(ctrl)
+		rowMock.EXPECT().Scan(gomock.Any(), gomock.Any()).DoAndReturn(func(dest ...any) error {
+			*dest[0].(*time.Time) = from //nolint:forcetypeassert
+			*dest[1].(*time.Time) = to   //nolint:forcetypeassert
+
+			return nil
+		})
+
+		return shard.EXPECT().QueryRow(gomock.Any(), rangeQuery, testDatabase, testTargetTable, 0, 0).Return(rowMock)
+	}
+
+	expectPartitions := func(ctrl *gomock.Controller, shard *mock.MockShard, args ...any) *gomock.Call {
+		rowsMock := mock.NewMockRows(ctrl)
+
+		rowsMock.EXPECT().Next().Return(true)
+		rowsMock.EXPECT().Scan(gomock.Any()).SetArg(0, testPartition)
+		rowsMock.EXPECT().Next()
+		rowsMock.EXPECT().Err()
+		rowsMock.EXPECT().Close()
+
+		return shard.EXPECT().Query(gomock.Any(), selectQuery, append([]any{testDatabase, testTable, 1}, args...)...).Return(rowsMock, nil)
+	}
+
+	tests := []struct {
+		name            string
+		dropSourceAfter time.Duration
+		replicated      bool
+		location        *time.Location
+		rolledUpTo      time.Time
+		prepareMock     func(ctrl *gomock.Controller, shard *mock.MockShard)
+		want            []string
+		wantErr         bool
+	}{
+		{
+			name:       "Disabled",
+			rolledUpTo: testRolledUpTo,
+		},
+		{
+			name:            "Ok",
+			dropSourceAfter: time.Hour * 24 * 7,
+			rolledUpTo:      testRolledUpTo,
+			prepareMock: func(ctrl *gomock.Controller, shard *mock.MockShard) {
+				gomock.InOrder(
+					expectRolledUpRange(ctrl, shard, testFirstRollUp, testRolledUpTo),
+					expectPartitions(ctrl, shard, testFirstRollUp, testDropBefore, "2024-06-01", "2024-06-23"),
+					shard.EXPECT().Exec(gomock.Any(), dropQuery, testPartition),
+				)
+			},
+			want: []string{testPartition},
+		},
+		{
+			name:            "Not rolled up yet",
+			dropSourceAfter: time.Hour,
+			replicated:      true,
+			rolledUpTo:      testRolledUpTo,
+			prepareMock: func(ctrl *gomock.Controller, shard *mock.MockShard) {
+				gomock.InOrder(
+					expectRolledUpRange(ctrl, shard, testFirstRollUp, testRolledUpTo),
+					expectPartitions(ctrl, shard, testFirstRollUp, testRolledUpTo, "2024-06-01", "2024-06-25"),
+					shard.EXPECT().Exec(gomock.Any(), dropQuery+" SETTINGS alter_sync = 2", testPartition),
+				)
+			},
+			want: []string{testPartition},
+		},
+		{
+			name:            "Ok dates at location",
+			dropSourceAfter: time.Hour,
+			location:        testMoscow,
+			rolledUpTo:      testMoscowRolled,
+			prepareMock: func(ctrl *gomock.Controller, shard *mock.MockShard) {
+				gomock.InOrder(
+					expectRolledUpRange(ctrl, shard, testMoscowFirst, testMoscowRolled),
+					expectPartitions(ctrl, shard, testMoscowFirst, testMoscowRolled, "2024-06-01", "2024-06-25"),
+					shard.EXPECT().Exec(gomock.Any(), dropQuery, testPartition),
+				)
+			},
+			want: []string{testPartition},
+		},
+		{
+			name:            "Nothing rolled up after first run",
+			dropSourceAfter: time.Hour,
+			rolledUpTo:      testRolledUpTo,
+			prepareMock: func(ctrl *gomock.Controller, shard *mock.MockShard) {
+				expectRolledUpRange(ctrl, shard, testRolledUpTo, testRolledUpTo)
+			},
+		},
+		{
+			name:            "Without meta info",
+			dropSourceAfter: time.Hour,
+			rolledUpTo:      testRolledUpTo,
+			prepareMock: func(ctrl *gomock.Controller, shard *mock.MockShard) {
+				rowMock := mock.NewMockRow(ctrl)
+				rowMock.EXPECT().Scan(gomock.Any(), gomock.Any()).Return(sql.ErrNoRows)
+				shard.EXPECT().QueryRow(gomock.Any(), rangeQuery, testDatabase, testTargetTable, 0, 0).Return(rowMock)
+			},
+		},
+		{
+			name:            "Failed to get meta info",
+			dropSourceAfter: time.Hour,
+			rolledUpTo:      testRolledUpTo,
+			prepareMock: func(ctrl *gomock.Controller, shard *mock.MockShard) {
+				rowMock := mock.NewMockRow(ctrl)
+				rowMock.EXPECT().Scan(gomock.Any(), gomock.Any()).Return(errors.New("test"))
+				shard.EXPECT().QueryRow(gomock.Any(), rangeQuery, testDatabase, testTargetTable, 0, 0).Return(rowMock)
+			},
+			wantErr: true,
+		},
+		{
+			name:            "Failed to drop partition",
+			dropSourceAfter: time.Hour * 24 * 7,
+			rolledUpTo:      testRolledUpTo,
+			prepareMock: func(ctrl *gomock.Controller, shard *mock.MockShard) {
+				gomock.InOrder(
+					expectRolledUpRange(ctrl, shard, testFirstRollUp, testRolledUpTo),
+					expectPartitions(ctrl, shard, gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()),
+					shard.EXPECT().Exec(gomock.Any(), dropQuery, testPartition).Return(errors.New("test")),
+				)
+			},
+			wantErr: true,
+		},
+		{
+			name:            "Failed to get partitions",
+			dropSourceAfter: time.Hour * 24 * 7,
+			rolledUpTo:      testRolledUpTo,
+			prepareMock: func(ctrl *gomock.Controller, shard *mock.MockShard) {
+				expectRolledUpRange(ctrl, shard, testFirstRollUp, testRolledUpTo)
+				shard.EXPECT().Query(gomock.Any(), selectQuery, testDatabase, testTable, 1, gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, errors.New("test"))
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		timeNow = func() time.Time {
+			return testCurrentTime
+		}
+
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+
+			shardMock := mock.NewMockShard(ctrl)
+			if tt.prepareMock != nil {
+				tt.prepareMock(ctrl, shardMock)
+			}
+
+			opts := RunOptions{
+				Database:        testDatabase,
+				Table:           testTable,
+				TargetTable:     testTargetTable,
+				DropSourceAfter: tt.dropSourceAfter,
+				Replicated:      tt.replicated,
+				location:        tt.location,
+			}
+
+			var report ShardReport
+
+			err := dropSourcePartitionsOnShard(context.Background(), shardMock, opts, tt.rolledUpTo, &report)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.want, report.DroppedPartitions)
+		})
+	}
+}
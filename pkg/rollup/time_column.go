@@ -0,0 +1,150 @@
+// Copyright 2025 LLC "Ozon Technologies".
+// SPDX-License-Identifier: Apache-2.0
+
+package rollup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	timeUtils "github.com/ozontech/ch-rollup/internal/utils/time"
+	"github.com/ozontech/ch-rollup/pkg/database"
+	"github.com/ozontech/ch-rollup/pkg/types"
+)
+
+var (
+	errUnsupportedTimeColumnType = errors.New("unsupported time column type")
+	errBadDateInterval           = errors.New("interval of Date time column must be a multiple of a day")
+	errBadUnixInterval           = errors.New("interval of unix time column must be a multiple of a second")
+)
+
+// columnTypeWrapperRegexp matches Nullable(T) and LowCardinality(T) types.
+var columnTypeWrapperRegexp = regexp.MustCompile(`^(?:Nullable|LowCardinality)\((.+)\)$`)
+
+// resolveTimeColumnType sets RunOptions.TimeColumnType by type of time column, if it's not set.
+func resolveTimeColumnType(ctx context.Context, shard database.Shard, opts *RunOptions) error {
+	if opts.TimeColumnType != "" {
+		return nil
+	}
+
+	timeColumnName := getTimeColumnName(opts.Columns)
+
+	columnType, err := getColumnTypeOnShard(ctx, shard, opts.Database, opts.Table, timeColumnName)
+	if err != nil {
+		return fmt.Errorf("failed to get type of column %s: %w", timeColumnName, err)
+	}
+
+	if opts.TimeColumnType, err = parseTimeColumnType(columnType); err != nil {
+		return err
+	}
+
+	opts.timeColumnDataType = columnType
+
+	return validateTimeColumnInterval(*opts)
+}
+
+func getColumnTypeOnShard(ctx context.Context, shard database.Shard, databaseName, table, column string) (string, error) {
+	var columnType string
+
+	err := shard.QueryRow(
+		ctx,
+		"SELECT type FROM system.columns WHERE database = ? AND table = ? AND name = ?",
+		databaseName,
+		table,
+		column,
+	).Scan(&columnType)
+	if err != nil {
+		return "", err
+	}
+
+	return columnType, nil
+}
+
+// parseTimeColumnType returns types.TimeColumnType of ClickHouse column type.
+func parseTimeColumnType(columnType string) (types.TimeColumnType, error) {
+	for {
+		match := columnTypeWrapperRegexp.FindStringSubmatch(columnType)
+		if match == nil {
+			break
+		}
+
+		columnType = match[1]
+	}
+
+	switch {
+	case columnType == "DateTime" || strings.HasPrefix(columnType, "DateTime("):
+		return types.TimeColumnDateTime, nil
+	case strings.HasPrefix(columnType, "DateTime64("):
+		return types.TimeColumnDateTime64, nil
+	case columnType == "Date" || columnType == "Date32":
+		return types.TimeColumnDate, nil
+	case columnType == "UInt32":
+		return types.TimeColumnUnixSeconds, nil
+	case columnType == "UInt64":
+		return types.TimeColumnUnixMilliseconds, nil
+	default:
+		return "", fmt.Errorf("%w: '%s'", errUnsupportedTimeColumnType, columnType)
+	}
+}
+
+// validateTimeColumnInterval checks that roll up interval can be applied to time column.
+func validateTimeColumnInterval(opts RunOptions) error {
+	if opts.TimeColumnType == types.TimeColumnDate && opts.CalendarInterval.IsZero() && opts.Interval%day != 0 {
+		return errBadDateInterval
+	}
+
+	// Unix time is bucketed by integer division by seconds of interval.
+	if (opts.TimeColumnType == types.TimeColumnUnixSeconds || opts.TimeColumnType == types.TimeColumnUnixMilliseconds) &&
+		opts.CalendarInterval.IsZero() && (opts.Interval < time.Second || opts.Interval%time.Second != 0) {
+		return errBadUnixInterval
+	}
+
+	return nil
+}
+
+// timeColumnValue returns t in type of time column, so it can be compared with time column at query.
+func timeColumnValue(t time.Time, opts RunOptions) any {
+	switch opts.TimeColumnType {
+	case types.TimeColumnDate:
+		location := opts.location
+		if location == nil {
+			location = time.UTC
+		}
+
+		return t.In(location).Format(time.DateOnly)
+	case types.TimeColumnUnixSeconds:
+		return uint32(t.Unix())
+	case types.TimeColumnUnixMilliseconds:
+		return uint64(t.UnixMilli())
+	default:
+		return t
+	}
+}
+
+// timeColumnRange returns bounds of time range in type of time column.
+func timeColumnRange(r timeUtils.Range, opts RunOptions) (from, to any) {
+	return timeColumnValue(r.From, opts), timeColumnValue(r.To, opts)
+}
+
+// timeRangeArgs returns args of generateTimeRangeConditions:
+// bounds in type of time column and then bounds for each derived time column.
+func timeRangeArgs(r timeUtils.Range, opts RunOptions) []any {
+	from, to := timeColumnRange(r, opts)
+
+	args := make([]any, 0, timeRangeArgsCount(opts.Columns))
+	args = append(args, from, to)
+
+	for range getDerivedTimeColumns(opts.Columns) {
+		args = append(args, r.From, r.To)
+	}
+
+	return args
+}
+
+func timeRangeArgsCount(columns []types.ColumnSetting) int {
+	return 2 + 2*len(getDerivedTimeColumns(columns))
+}
@@ -0,0 +1,233 @@
+// Copyright 2025 LLC "Ozon Technologies".
+// SPDX-License-Identifier: Apache-2.0
+
+package rollup
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	timeUtils "github.com/ozontech/ch-rollup/internal/utils/time"
+	"github.com/ozontech/ch-rollup/pkg/database/mock"
+	"github.com/ozontech/ch-rollup/pkg/types"
+)
+
+func Test_parseTimeColumnType(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		columnType string
+		want       types.TimeColumnType
+		wantErr    error
+	}{
+		{columnType: "DateTime", want: types.TimeColumnDateTime},
+		{columnType: "DateTime('Europe/Moscow')", want: types.TimeColumnDateTime},
+		{columnType: "DateTime64(3, 'UTC')", want: types.TimeColumnDateTime64},
+		{columnType: "Date", want: types.TimeColumnDate},
+		{columnType: "Date32", want: types.TimeColumnDate},
+		{columnType: "UInt32", want: types.TimeColumnUnixSeconds},
+		{columnType: "UInt64", want: types.TimeColumnUnixMilliseconds},
+		{columnType: "LowCardinality(Nullable(DateTime))", want: types.TimeColumnDateTime},
+		{columnType: "String", wantErr: errUnsupportedTimeColumnType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.columnType, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := parseTimeColumnType(tt.columnType)
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_resolveTimeColumnType(t *testing.T) {
+	t.Parallel()
+
+	const (
+		testDatabase = "test_database"
+		testTable    = "test_table"
+	)
+
+	testColumns := []types.ColumnSetting{
+		{
+			Name:         "test_time",
+			IsRollUpTime: true,
+		},
+	}
+
+	tests := []struct {
+		name       string
+		columnType string
+		columnErr  error
+		configured types.TimeColumnType
+		interval   time.Duration
+		want       types.TimeColumnType
+		wantErr    bool
+	}{
+		{
+			name:       "Detected",
+			columnType: "DateTime64(3, 'UTC')",
+			interval:   time.Hour,
+			want:       types.TimeColumnDateTime64,
+		},
+		{
+			name:       "Configured",
+			configured: types.TimeColumnUnixSeconds,
+			interval:   time.Hour,
+			want:       types.TimeColumnUnixSeconds,
+		},
+		{
+			name:       "Date with hourly interval",
+			columnType: "Date",
+			interval:   time.Hour,
+			wantErr:    true,
+		},
+		{
+			name:       "Unix seconds with sub-second interval",
+			columnType: "UInt32",
+			interval:   500 * time.Millisecond,
+			wantErr:    true,
+		},
+		{
+			name:       "Unix milliseconds with fractional seconds interval",
+			columnType: "UInt64",
+			interval:   1500 * time.Millisecond,
+			wantErr:    true,
+		},
+		{
+			name:      "Failed to get column type",
+			columnErr: errors.New("test"),
+			interval:  time.Hour,
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctrl := gomock.NewController(t)
+
+			shardMock := mock.NewMockShard(ctrl)
+
+			if tt.configured == "" {
+				rowMock := mock.NewMockRow(ctrl)
+				if tt.columnErr != nil {
+					rowMock.EXPECT().Scan(gomock.Any()).Return(tt.columnErr)
+				} else {
+					rowMock.EXPECT().Scan(gomock.Any()).SetArg(0, tt.columnType)
+				}
+
+				shardMock.EXPECT().QueryRow(
+					gomock.Any(),
+					"SELECT type FROM system.columns WHERE database = ? AND table = ? AND name = ?",
+					testDatabase,
+					testTable,
+					"test_time",
+				).Return(rowMock)
+			}
+
+			opts := RunOptions{
+				Database:       testDatabase,
+				Table:          testTable,
+				Columns:        testColumns,
+				Interval:       tt.interval,
+				TimeColumnType: tt.configured,
+			}
+
+			err := resolveTimeColumnType(context.Background(), shardMock, &opts)
+			assert.Equal(t, tt.wantErr, err != nil)
+
+			if !tt.wantErr {
+				assert.Equal(t, tt.want, opts.TimeColumnType)
+			}
+		})
+	}
+}
+
+func Test_timeColumnValue(t *testing.T) {
+	t.Parallel()
+
+	testTime := time.Date(2024, time.June, 23, 22, 0, 0, 0, time.UTC)
+
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name string
+		opts RunOptions
+		want any
+	}{
+		{
+			name: "DateTime",
+			opts: RunOptions{TimeColumnType: types.TimeColumnDateTime},
+			want: testTime,
+		},
+		{
+			name: "DateTime64",
+			opts: RunOptions{TimeColumnType: types.TimeColumnDateTime64},
+			want: testTime,
+		},
+		{
+			name: "Date",
+			opts: RunOptions{TimeColumnType: types.TimeColumnDate},
+			want: "2024-06-23",
+		},
+		{
+			name: "Date in location",
+			opts: RunOptions{TimeColumnType: types.TimeColumnDate, location: moscow},
+			want: "2024-06-24",
+		},
+		{
+			name: "Unix seconds",
+			opts: RunOptions{TimeColumnType: types.TimeColumnUnixSeconds},
+			want: uint32(1719180000),
+		},
+		{
+			name: "Unix milliseconds",
+			opts: RunOptions{TimeColumnType: types.TimeColumnUnixMilliseconds},
+			want: uint64(1719180000000),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tt.want, timeColumnValue(testTime, tt.opts))
+		})
+	}
+}
+
+func Test_timeRangeArgs(t *testing.T) {
+	t.Parallel()
+
+	testRange := timeUtils.Range{
+		From: time.Date(2024, time.June, 23, 0, 0, 0, 0, time.UTC),
+		To:   time.Date(2024, time.June, 24, 0, 0, 0, 0, time.UTC),
+	}
+
+	opts := RunOptions{
+		Columns: []types.ColumnSetting{
+			{
+				Name:            "test_date",
+				DerivedFromTime: "toDate",
+			},
+			{
+				Name:         "test_time",
+				IsRollUpTime: true,
+			},
+		},
+		TimeColumnType: types.TimeColumnUnixSeconds,
+	}
+
+	assert.Equal(
+		t,
+		[]any{uint32(1719100800), uint32(1719187200), testRange.From, testRange.To},
+		timeRangeArgs(testRange, opts),
+	)
+}
@@ -0,0 +1,129 @@
+// Copyright 2025 LLC "Ozon Technologies".
+// SPDX-License-Identifier: Apache-2.0
+
+package rollup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/ozontech/ch-rollup/pkg/database"
+	"github.com/ozontech/ch-rollup/pkg/types"
+)
+
+var (
+	errTimezoneMismatch = errors.New("timezone doesn't match timezone of partition key of the table")
+	errTimezoneNotSet   = errors.New("table isn't partitioned in UTC, set timezone to its timezone or auto")
+)
+
+// columnTimezoneRegexp matches timezone of DateTime('Europe/Moscow') and DateTime64(3, 'Europe/Moscow') types.
+var columnTimezoneRegexp = regexp.MustCompile(`^DateTime(?:64)?\((?:\d+,\s*)?'([^']+)'\)$`)
+
+// resolveLocation sets location of partitions boundaries by RunOptions.Timezone.
+// Timezone argument of partition key defines them regardless of column and server timezone, so it's used instead of
+// detected one, and configured one must match it. Partition key must be resolved before.
+func resolveLocation(ctx context.Context, shard database.Shard, opts *RunOptions) error {
+	if opts.partitionTimezone != "" {
+		if opts.Timezone != "" && opts.Timezone != types.TimezoneAuto && opts.Timezone != opts.partitionTimezone {
+			return fmt.Errorf("%w: configured %s, but partitions are in %s", errTimezoneMismatch, opts.Timezone, opts.partitionTimezone)
+		}
+
+		location, err := time.LoadLocation(opts.partitionTimezone)
+		if err != nil {
+			return fmt.Errorf("failed to load timezone of partition key: %w", err)
+		}
+
+		opts.location = location
+
+		return nil
+	}
+
+	switch opts.Timezone {
+	case "":
+		// UTC is kept as default, detection would move windows of existing roll ups on servers outside of UTC.
+		// Dates don't depend on timezone, otherwise UTC windows would cross partitions of other timezone.
+		opts.location = nil
+
+		if opts.TimeColumnType == types.TimeColumnDate {
+			return nil
+		}
+
+		timezone, err := getTimezoneOnShard(ctx, shard, *opts)
+		if err != nil {
+			return fmt.Errorf("failed to detect timezone of %s.%s: %w", opts.Database, opts.Table, err)
+		}
+
+		location, err := time.LoadLocation(timezone)
+		if err != nil {
+			return fmt.Errorf("failed to load detected timezone: %w", err)
+		}
+
+		if !isUTC(location) {
+			return fmt.Errorf("%w: %s.%s is in %s", errTimezoneNotSet, opts.Database, opts.Table, timezone)
+		}
+
+		return nil
+	case types.TimezoneAuto:
+		timezone, err := getTimezoneOnShard(ctx, shard, *opts)
+		if err != nil {
+			return fmt.Errorf("failed to detect timezone of %s.%s: %w", opts.Database, opts.Table, err)
+		}
+
+		opts.location, err = time.LoadLocation(timezone)
+		if err != nil {
+			return fmt.Errorf("failed to load detected timezone: %w", err)
+		}
+
+		return nil
+	default:
+		location, err := time.LoadLocation(opts.Timezone)
+		if err != nil {
+			return err
+		}
+
+		opts.location = location
+
+		return nil
+	}
+}
+
+// getTimezoneOnShard returns timezone of time column type or timezone of the server, if column type has no timezone.
+// Type of time column is read, unless it's read by resolveTimeColumnType.
+func getTimezoneOnShard(ctx context.Context, shard database.Shard, opts RunOptions) (string, error) {
+	columnType := opts.timeColumnDataType
+	if columnType == "" {
+		column := getTimeColumnName(opts.Columns)
+
+		var err error
+
+		if columnType, err = getColumnTypeOnShard(ctx, shard, opts.Database, opts.Table, column); err != nil {
+			return "", fmt.Errorf("failed to get type of column %s: %w", column, err)
+		}
+	}
+
+	if match := columnTimezoneRegexp.FindStringSubmatch(columnType); match != nil {
+		return match[1], nil
+	}
+
+	var timezone string
+
+	if err := shard.QueryRow(ctx, "SELECT timezone()").Scan(&timezone); err != nil {
+		return "", fmt.Errorf("failed to get server timezone: %w", err)
+	}
+
+	return timezone, nil
+}
+
+// isUTC reports whether location has no offset from UTC in winter and summer, like Etc/UTC or GMT.
+func isUTC(location *time.Location) bool {
+	for _, month := range []time.Month{time.January, time.July} {
+		if _, offset := time.Date(2025, month, 1, 0, 0, 0, 0, location).Zone(); offset != 0 {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,180 @@
+// Copyright 2025 LLC "Ozon Technologies".
+// SPDX-License-Identifier: Apache-2.0
+
+package rollup
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	"github.com/ozontech/ch-rollup/pkg/database/mock"
+	"github.com/ozontech/ch-rollup/pkg/types"
+)
+
+func Test_resolveLocation(t *testing.T) {
+	t.Parallel()
+
+	const (
+		testDatabase = "test_database"
+		testTable    = "test_table"
+
+		columnTypeQuery = "SELECT type FROM system.columns WHERE database = ? AND table = ? AND name = ?"
+	)
+
+	testColumns := []types.ColumnSetting{
+		{
+			Name:         "test_time",
+			IsRollUpTime: true,
+		},
+	}
+
+	expectString := func(ctrl *gomock.Controller, shard *mock.MockShard, value string, query string, args ...any) {
+		rowMock := mock.NewMockRow(ctrl)
+		rowMock.EXPECT().Scan(gomock.Any()).SetArg(0, value)
+
+		shard.EXPECT().QueryRow(gomock.Any(), query, args...).Return(rowMock)
+	}
+
+	tests := []struct {
+		name        string
+		prepareMock func(ctrl *gomock.Controller, shard *mock.MockShard)
+		timezone    string
+		// partitionTimezone is a timezone argument of partition key.
+		partitionTimezone  string
+		timeColumnType     types.TimeColumnType
+		timeColumnDataType string
+		want               string
+		wantErr            bool
+	}{
+		{
+			name: "UTC by default",
+			prepareMock: func(ctrl *gomock.Controller, shard *mock.MockShard) {
+				expectString(ctrl, shard, "DateTime", columnTypeQuery, testDatabase, testTable, "test_time")
+				expectString(ctrl, shard, "Etc/UTC", "SELECT timezone()")
+			},
+			want: "UTC",
+		},
+		{
+			name:               "UTC by default with resolved column type",
+			prepareMock:        func(_ *gomock.Controller, _ *mock.MockShard) {},
+			timeColumnDataType: "DateTime('UTC')",
+			want:               "UTC",
+		},
+		{
+			name:           "UTC by default for Date column",
+			prepareMock:    func(_ *gomock.Controller, _ *mock.MockShard) {},
+			timeColumnType: types.TimeColumnDate,
+			want:           "UTC",
+		},
+		{
+			name: "Server timezone isn't UTC by default",
+			prepareMock: func(ctrl *gomock.Controller, shard *mock.MockShard) {
+				expectString(ctrl, shard, "Europe/Moscow", "SELECT timezone()")
+			},
+			timeColumnType:     types.TimeColumnUnixSeconds,
+			timeColumnDataType: "UInt32",
+			wantErr:            true,
+		},
+		{
+			name:               "Column timezone isn't UTC by default",
+			prepareMock:        func(_ *gomock.Controller, _ *mock.MockShard) {},
+			timeColumnDataType: "DateTime('Europe/London')",
+			wantErr:            true,
+		},
+		{
+			name:        "Explicit timezone",
+			prepareMock: func(_ *gomock.Controller, _ *mock.MockShard) {},
+			timezone:    "Europe/Moscow",
+			want:        "Europe/Moscow",
+		},
+		{
+			name: "Column timezone",
+			prepareMock: func(ctrl *gomock.Controller, shard *mock.MockShard) {
+				expectString(ctrl, shard, "DateTime64(3, 'Asia/Kolkata')", columnTypeQuery, testDatabase, testTable, "test_time")
+			},
+			timezone: types.TimezoneAuto,
+			want:     "Asia/Kolkata",
+		},
+		{
+			name: "Server timezone",
+			prepareMock: func(ctrl *gomock.Controller, shard *mock.MockShard) {
+				expectString(ctrl, shard, "DateTime", columnTypeQuery, testDatabase, testTable, "test_time")
+				expectString(ctrl, shard, "Europe/Moscow", "SELECT timezone()")
+			},
+			timezone: types.TimezoneAuto,
+			want:     "Europe/Moscow",
+		},
+		{
+			name:              "Partition key timezone by default",
+			prepareMock:       func(_ *gomock.Controller, _ *mock.MockShard) {},
+			partitionTimezone: "Europe/Moscow",
+			want:              "Europe/Moscow",
+		},
+		{
+			name:              "Partition key timezone instead of detected",
+			prepareMock:       func(_ *gomock.Controller, _ *mock.MockShard) {},
+			timezone:          types.TimezoneAuto,
+			partitionTimezone: "Asia/Kolkata",
+			want:              "Asia/Kolkata",
+		},
+		{
+			name:              "Partition key timezone matches explicit",
+			prepareMock:       func(_ *gomock.Controller, _ *mock.MockShard) {},
+			timezone:          "Europe/Moscow",
+			partitionTimezone: "Europe/Moscow",
+			want:              "Europe/Moscow",
+		},
+		{
+			name:              "Partition key timezone mismatch",
+			prepareMock:       func(_ *gomock.Controller, _ *mock.MockShard) {},
+			timezone:          "UTC",
+			partitionTimezone: "Europe/Moscow",
+			wantErr:           true,
+		},
+		{
+			name: "Failed to get column type",
+			prepareMock: func(ctrl *gomock.Controller, shard *mock.MockShard) {
+				rowMock := mock.NewMockRow(ctrl)
+				rowMock.EXPECT().Scan(gomock.Any()).Return(errors.New("test"))
+
+				shard.EXPECT().QueryRow(gomock.Any(), columnTypeQuery, testDatabase, testTable, "test_time").Return(rowMock)
+			},
+			timezone: types.TimezoneAuto,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctrl := gomock.NewController(t)
+
+			shardMock := mock.NewMockShard(ctrl)
+			tt.prepareMock(ctrl, shardMock)
+
+			opts := RunOptions{
+				Database: testDatabase,
+				Table:    testTable,
+				Columns:  testColumns,
+				Timezone: tt.timezone,
+
+				TimeColumnType: tt.timeColumnType,
+
+				partitionTimezone:  tt.partitionTimezone,
+				timeColumnDataType: tt.timeColumnDataType,
+			}
+
+			err := resolveLocation(context.Background(), shardMock, &opts)
+			assert.Equal(t, tt.wantErr, err != nil)
+
+			if !tt.wantErr {
+				// nil location is UTC.
+				assert.Equal(t, tt.want, opts.location.String())
+			}
+		})
+	}
+}
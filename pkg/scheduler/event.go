@@ -3,7 +3,11 @@
 
 package scheduler
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/ozontech/ch-rollup/pkg/rollup"
+)
 
 //go:generate go run github.com/alvaroloes/enumer -type=EventType -trimprefix=EventType -output=event_type_enum.go
 
@@ -19,6 +23,8 @@ const (
 type Event struct {
 	Type  EventType
 	Error error
+	// Reports of each roll up made before Error (or all of them if there is no Error).
+	Reports []rollup.Report
 }
 
 // String returns string representation of Event.
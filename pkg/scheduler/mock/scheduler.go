@@ -42,11 +42,12 @@ func (m *MockRollUp) EXPECT() *MockRollUpMockRecorder {
 }
 
 // Run mocks base method.
-func (m *MockRollUp) Run(ctx context.Context, opts rollup.RunOptions) error {
+func (m *MockRollUp) Run(ctx context.Context, opts rollup.RunOptions) (rollup.Report, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "Run", ctx, opts)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret0, _ := ret[0].(rollup.Report)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // Run indicates an expected call of Run.
@@ -5,9 +5,12 @@ package scheduler
 
 import (
 	"context"
+	"errors"
 	"maps"
 	"slices"
 
+	"go.uber.org/multierr"
+
 	"github.com/ozontech/ch-rollup/pkg/rollup"
 	"github.com/ozontech/ch-rollup/pkg/types"
 )
@@ -16,26 +19,68 @@ const (
 	tempTablePrefix = "_temp"
 )
 
-func (s *Scheduler) rollUp(ctx context.Context) error {
+func (s *Scheduler) rollUp(ctx context.Context) ([]rollup.Report, error) {
+	var (
+		reports   []rollup.Report
+		shardsErr error
+	)
+
 	for _, task := range s.tasks {
 		for _, rollUpSetting := range task.RollUpSettings {
-			err := s.dbRollUp.Run(ctx, rollup.RunOptions{
-				Database:     task.Database,
-				Table:        task.Table,
-				TempTable:    task.Table + tempTablePrefix,
-				PartitionKey: task.PartitionKey,
-				Columns:      prepareRollUpColumns(task.ColumnSettings, rollUpSetting.ColumnSettings),
-				Interval:     rollUpSetting.Interval,
-				After:        rollUpSetting.After,
-				CopyInterval: task.CopyInterval,
+			// Temp table is created in target database, so it's named after the table it replaces partitions of.
+			tempTable := task.Table + tempTablePrefix
+			if rollUpSetting.TargetTable != "" {
+				tempTable = rollUpSetting.TargetTable + tempTablePrefix
+			}
+
+			report, err := s.dbRollUp.Run(ctx, rollup.RunOptions{
+				Database:             task.Database,
+				Table:                task.Table,
+				TempTable:            tempTable,
+				PartitionKey:         task.PartitionKey,
+				Columns:              prepareRollUpColumns(task.ColumnSettings, rollUpSetting.ColumnSettings),
+				Interval:             rollUpSetting.Interval,
+				After:                rollUpSetting.After,
+				CopyInterval:         task.CopyInterval,
+				Replicated:           task.Replicated,
+				ContinueOnShardError: task.ContinueOnShardError,
+				MaxParallelShards:    task.MaxParallelShards,
+				MaxParallelCopies:    task.MaxParallelCopies,
+				Checks:               append(slices.Clone(task.Checks), rollUpSetting.Checks...),
+				CheckTimeBounds:      task.CheckTimeBounds,
+				BackupRetention:      task.BackupRetention,
+				CommitPerPartition:   task.CommitPerPartition,
+				Timezone:             task.Timezone,
+				CalendarPartitionKey: task.CalendarPartitionKey,
+				CalendarInterval:     rollUpSetting.CalendarInterval,
+				TimeColumnType:       task.TimeColumnType,
+				Where:                rollUpSetting.Where,
+				TargetDatabase:       rollUpSetting.TargetDatabase,
+				TargetTable:          rollUpSetting.TargetTable,
+				DropSourceAfter:      rollUpSetting.DropSourceAfter,
+				AutoColumns:          task.AutoColumns,
+				AllowedFunctions:     task.AllowedFunctions,
+				ResolutionColumn:     task.ResolutionColumn,
+				StartFrom:            task.StartFrom,
+				StartTime:            task.StartTime,
 			})
+
+			reports = append(reports, report)
+
+			// Failures of some shards must not stall roll up on others.
+			var shardErrors rollup.ShardErrors
+			if task.ContinueOnShardError && errors.As(err, &shardErrors) {
+				shardsErr = multierr.Append(shardsErr, err)
+				continue
+			}
+
 			if err != nil {
-				return err
+				return reports, multierr.Append(shardsErr, err)
 			}
 		}
 	}
 
-	return nil
+	return reports, shardsErr
 }
 
 func prepareRollUpColumns(globalColumnSettings, currentColumnSettings []types.ColumnSetting) []types.ColumnSetting {
@@ -18,7 +18,7 @@ import (
 
 // RollUp ...
 type RollUp interface {
-	Run(ctx context.Context, opts rollup.RunOptions) error
+	Run(ctx context.Context, opts rollup.RunOptions) (rollup.Report, error)
 }
 
 const (
@@ -67,10 +67,7 @@ func (s *Scheduler) Run(ctx context.Context) (<-chan Event, error) {
 		defer close(eventChan)
 
 		// Let's do first rollup immediately.
-		eventChan <- Event{
-			Type:  EventTypeRollUp,
-			Error: s.rollUp(ctx),
-		}
+		eventChan <- s.rollUpEvent(ctx)
 
 		ticker := time.NewTicker(defaultSchedulerInterval)
 		defer ticker.Stop()
@@ -78,10 +75,7 @@ func (s *Scheduler) Run(ctx context.Context) (<-chan Event, error) {
 		for {
 			select {
 			case <-ticker.C:
-				eventChan <- Event{
-					Type:  EventTypeRollUp,
-					Error: s.rollUp(ctx),
-				}
+				eventChan <- s.rollUpEvent(ctx)
 
 				ticker.Reset(defaultSchedulerInterval)
 			case <-ctx.Done():
@@ -92,3 +86,13 @@ func (s *Scheduler) Run(ctx context.Context) (<-chan Event, error) {
 
 	return eventChan, nil
 }
+
+func (s *Scheduler) rollUpEvent(ctx context.Context) Event {
+	reports, err := s.rollUp(ctx)
+
+	return Event{
+		Type:    EventTypeRollUp,
+		Error:   err,
+		Reports: reports,
+	}
+}
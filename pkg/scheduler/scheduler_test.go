@@ -170,12 +170,18 @@ func TestScheduler_Run(t *testing.T) {
 							Interval:     time.Hour,
 							CopyInterval: time.Hour,
 						},
-					).Return(nil)
+					).Return(rollup.Report{Database: "test_database", Table: "test_table"}, nil)
 				},
 			},
 			want: []Event{
 				{
 					Type: EventTypeRollUp,
+					Reports: []rollup.Report{
+						{
+							Database: "test_database",
+							Table:    "test_table",
+						},
+					},
 				},
 			},
 		},
@@ -220,13 +226,77 @@ func TestScheduler_Run(t *testing.T) {
 							Interval:     time.Hour,
 							CopyInterval: time.Hour,
 						},
-					).Return(errors.New("test-error"))
+					).Return(rollup.Report{}, errors.New("test-error"))
 				},
 			},
 			want: []Event{
 				{
-					Type:  EventTypeRollUp,
-					Error: errors.New("test-error"),
+					Type:    EventTypeRollUp,
+					Error:   errors.New("test-error"),
+					Reports: []rollup.Report{{}},
+				},
+			},
+		},
+		{
+			name: "Continue on shard error",
+			fields: fields{
+				tasks: []types.Task{
+					{
+						Database:     "test_database",
+						Table:        "test_table",
+						PartitionKey: time.Hour * 24,
+						CopyInterval: time.Hour,
+						RollUpSettings: []types.RollUpSetting{
+							{
+								After:    time.Hour * 24,
+								Interval: time.Hour,
+							},
+							{
+								After:    time.Hour * 48,
+								Interval: time.Hour * 24,
+							},
+						},
+						ColumnSettings: []types.ColumnSetting{
+							{
+								Name:         "test_interval",
+								IsRollUpTime: true,
+							},
+						},
+						ContinueOnShardError: true,
+					},
+				},
+				prepareRollUpMock: func(rollUp *mock.MockRollUp) {
+					gomock.InOrder(
+						rollUp.EXPECT().Run(gomock.Any(), gomock.Any()).Return(
+							rollup.Report{Interval: time.Hour},
+							rollup.ShardErrors{
+								{
+									Shard: "test-shard",
+									Err:   errors.New("test-error"),
+								},
+							},
+						),
+						rollUp.EXPECT().Run(gomock.Any(), gomock.Any()).Return(rollup.Report{Interval: time.Hour * 24}, nil),
+					)
+				},
+			},
+			want: []Event{
+				{
+					Type: EventTypeRollUp,
+					Error: rollup.ShardErrors{
+						{
+							Shard: "test-shard",
+							Err:   errors.New("test-error"),
+						},
+					},
+					Reports: []rollup.Report{
+						{
+							Interval: time.Hour,
+						},
+						{
+							Interval: time.Hour * 24,
+						},
+					},
 				},
 			},
 		},
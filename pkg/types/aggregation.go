@@ -0,0 +1,108 @@
+// Copyright 2025 LLC "Ozon Technologies".
+// SPDX-License-Identifier: Apache-2.0
+
+package types
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	sqlUtils "github.com/ozontech/ch-rollup/internal/utils/sql"
+	timeUtils "github.com/ozontech/ch-rollup/internal/utils/time"
+)
+
+// ConstantValue is a type of value accepted by Constant.
+type ConstantValue interface {
+	~string | ~bool |
+		~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 |
+		~float32 | ~float64
+}
+
+// MergeState returns ColumnSetting of AggregateFunction column which states are merged,
+// like MergeState("counter", "count") for AggregateFunction(count) column.
+// Parametric function is set with parameters, like "quantiles(0.5, 0.9)".
+func MergeState(name, function string) ColumnSetting {
+	return aggregateColumn(name, function, "MergeState")
+}
+
+// Sum returns ColumnSetting of column which values are summed up, like SimpleAggregateFunction(sum, UInt64) column.
+func Sum(name string) ColumnSetting {
+	return aggregateColumn(name, "sum", "")
+}
+
+// Max returns ColumnSetting of column which keeps the maximum value, like SimpleAggregateFunction(max, Float64) column.
+func Max(name string) ColumnSetting {
+	return aggregateColumn(name, "max", "")
+}
+
+// Min returns ColumnSetting of column which keeps the minimum value, like SimpleAggregateFunction(min, Float64) column.
+func Min(name string) ColumnSetting {
+	return aggregateColumn(name, "min", "")
+}
+
+// Any returns ColumnSetting of column which keeps any value of rolled up rows, like host name.
+func Any(name string) ColumnSetting {
+	return aggregateColumn(name, "any", "")
+}
+
+// Constant returns ColumnSetting of column which is set to value at rolled up rows, like interval of roll up.
+// time.Duration is set in whole seconds, so Constant("rollup_interval", time.Hour) is 3600.
+func Constant[T ConstantValue](name string, value T) ColumnSetting {
+	if d, ok := any(value).(time.Duration); ok {
+		return ColumnSetting{
+			Name:       name,
+			Expression: strconv.Itoa(timeUtils.SecondsFromDuration(d)),
+		}
+	}
+
+	v := reflect.ValueOf(value)
+
+	var expression string
+
+	switch v.Kind() {
+	case reflect.String:
+		expression = sqlUtils.QuotedString(v.String())
+	case reflect.Bool:
+		expression = strconv.FormatBool(v.Bool())
+	case reflect.Float32, reflect.Float64:
+		expression = strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		expression = strconv.FormatUint(v.Uint(), 10)
+	default:
+		// Other named types are formatted as numbers, not by their String method.
+		expression = strconv.FormatInt(v.Int(), 10)
+	}
+
+	return ColumnSetting{
+		Name:       name,
+		Expression: expression,
+	}
+}
+
+// AvgFromSumCount returns ColumnSetting of average column which is calculated from sum and count columns of rolled up rows,
+// so the average is weighted by number of rows.
+func AvgFromSumCount(name, sumColumn, countColumn string) ColumnSetting {
+	return ColumnSetting{
+		Name:       name,
+		Expression: fmt.Sprintf("sum(%s) / sum(%s)", sqlUtils.QuotedEntity(sumColumn), sqlUtils.QuotedEntity(countColumn)),
+	}
+}
+
+// aggregateColumn returns ColumnSetting of the column aggregated by function with combinator.
+// Parameters of parametric function follow combinator, like quantilesMergeState(0.5)(column).
+func aggregateColumn(name, function, combinator string) ColumnSetting {
+	functionName, parameters := function, ""
+	if index := strings.IndexByte(function, '('); index >= 0 {
+		functionName, parameters = function[:index], function[index:]
+	}
+
+	return ColumnSetting{
+		Name:              name,
+		Expression:        fmt.Sprintf("%s%s%s(%s)", functionName, combinator, parameters, sqlUtils.QuotedEntity(name)),
+		AggregateFunction: function,
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2025 LLC "Ozon Technologies".
+// SPDX-License-Identifier: Apache-2.0
+
+package types
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAggregationHelpers(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		got  ColumnSetting
+		want ColumnSetting
+	}{
+		{
+			name: "MergeState",
+			got:  MergeState("counter", "count"),
+			want: ColumnSetting{Name: "counter", Expression: `countMergeState("counter")`, AggregateFunction: "count"},
+		},
+		{
+			name: "MergeState parametric",
+			got:  MergeState("latency", "quantiles(0.5, 0.9)"),
+			want: ColumnSetting{Name: "latency", Expression: `quantilesMergeState(0.5, 0.9)("latency")`, AggregateFunction: "quantiles(0.5, 0.9)"},
+		},
+		{
+			name: "Sum",
+			got:  Sum("bytes"),
+			want: ColumnSetting{Name: "bytes", Expression: `sum("bytes")`, AggregateFunction: "sum"},
+		},
+		{
+			name: "Max",
+			got:  Max("latency_max"),
+			want: ColumnSetting{Name: "latency_max", Expression: `max("latency_max")`, AggregateFunction: "max"},
+		},
+		{
+			name: "Min",
+			got:  Min("latency_min"),
+			want: ColumnSetting{Name: "latency_min", Expression: `min("latency_min")`, AggregateFunction: "min"},
+		},
+		{
+			name: "Any",
+			got:  Any("host"),
+			want: ColumnSetting{Name: "host", Expression: `any("host")`, AggregateFunction: "any"},
+		},
+		{
+			name: "Constant number",
+			got:  Constant("rollup_interval", 3600),
+			want: ColumnSetting{Name: "rollup_interval", Expression: "3600"},
+		},
+		{
+			name: "Constant duration",
+			got:  Constant("rollup_interval", time.Hour),
+			want: ColumnSetting{Name: "rollup_interval", Expression: "3600"},
+		},
+		{
+			name: "Constant float",
+			got:  Constant("ratio", 0.25),
+			want: ColumnSetting{Name: "ratio", Expression: "0.25"},
+		},
+		{
+			name: "Constant string",
+			got:  Constant("tier", "it's low"),
+			want: ColumnSetting{Name: "tier", Expression: `'it\'s low'`},
+		},
+		{
+			name: "Constant bool",
+			got:  Constant("is_rolled_up", true),
+			want: ColumnSetting{Name: "is_rolled_up", Expression: "true"},
+		},
+		{
+			name: "AvgFromSumCount",
+			got:  AvgFromSumCount("latency_avg", "latency_sum", "hits"),
+			want: ColumnSetting{Name: "latency_avg", Expression: `sum("latency_sum") / sum("hits")`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tt.want, tt.got)
+			assert.NoError(t, tt.got.Validate())
+		})
+	}
+}
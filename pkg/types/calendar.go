@@ -0,0 +1,70 @@
+// Copyright 2025 LLC "Ozon Technologies".
+// SPDX-License-Identifier: Apache-2.0
+
+package types
+
+import (
+	"errors"
+	"fmt"
+)
+
+// CalendarUnit is a unit of CalendarInterval.
+type CalendarUnit string
+
+// Supported calendar units.
+const (
+	CalendarWeek    CalendarUnit = "week"
+	CalendarMonth   CalendarUnit = "month"
+	CalendarQuarter CalendarUnit = "quarter"
+	CalendarYear    CalendarUnit = "year"
+)
+
+// CalendarInterval is an interval of calendar units, which can have uneven length like months.
+// Weeks start on Monday.
+type CalendarInterval struct {
+	Unit  CalendarUnit // The unit of the interval.
+	Count int          // The number of units in the interval. Default: 1.
+}
+
+var (
+	errUnknownCalendarUnit = errors.New("unknown calendar unit")
+	errBadCalendarCount    = errors.New("count must not be negative")
+)
+
+// IsZero reports whether CalendarInterval is not set.
+func (ci CalendarInterval) IsZero() bool {
+	return ci.Unit == ""
+}
+
+// Units returns number of units in CalendarInterval.
+func (ci CalendarInterval) Units() int {
+	if ci.Count == 0 {
+		return 1
+	}
+
+	return ci.Count
+}
+
+// String returns CalendarInterval like '3 month'.
+func (ci CalendarInterval) String() string {
+	if ci.IsZero() {
+		return ""
+	}
+
+	return fmt.Sprintf("%d %s", ci.Units(), ci.Unit)
+}
+
+// Validate CalendarInterval.
+func (ci CalendarInterval) Validate() error {
+	switch ci.Unit {
+	case CalendarWeek, CalendarMonth, CalendarQuarter, CalendarYear:
+	default:
+		return fmt.Errorf("%w: '%s'", errUnknownCalendarUnit, ci.Unit)
+	}
+
+	if ci.Count < 0 {
+		return errBadCalendarCount
+	}
+
+	return nil
+}
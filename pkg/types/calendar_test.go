@@ -0,0 +1,52 @@
+// Copyright 2025 LLC "Ozon Technologies".
+// SPDX-License-Identifier: Apache-2.0
+
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCalendarInterval_Validate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		interval CalendarInterval
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "Ok",
+			interval: CalendarInterval{Unit: CalendarQuarter},
+			want:     "1 quarter",
+		},
+		{
+			name:     "Ok with count",
+			interval: CalendarInterval{Unit: CalendarWeek, Count: 2},
+			want:     "2 week",
+		},
+		{
+			name:     "Unknown unit",
+			interval: CalendarInterval{Unit: "day"},
+			want:     "1 day",
+			wantErr:  true,
+		},
+		{
+			name:     "Negative count",
+			interval: CalendarInterval{Unit: CalendarMonth, Count: -1},
+			want:     "-1 month",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tt.wantErr, tt.interval.Validate() != nil)
+			assert.Equal(t, tt.want, tt.interval.String())
+		})
+	}
+}
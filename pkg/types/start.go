@@ -0,0 +1,32 @@
+// Copyright 2025 LLC "Ozon Technologies".
+// SPDX-License-Identifier: Apache-2.0
+
+package types
+
+import (
+	"errors"
+	"fmt"
+)
+
+// StartFrom defines where roll ups start when roll up runs for the first time, so there is no meta info of it yet.
+// Data before the start is never rolled up.
+type StartFrom string
+
+// Supported starts of roll ups.
+const (
+	StartFromNow               StartFrom = "now"                // Only data written after the first run is rolled up.
+	StartFromEarliestPartition StartFrom = "earliest_partition" // All data of the table is rolled up, starting from the earliest partition.
+	StartFromTime              StartFrom = "time"               // Data is rolled up starting from the partition of StartTime.
+)
+
+var errUnknownStartFrom = errors.New("unknown start from")
+
+// Validate StartFrom.
+func (s StartFrom) Validate() error {
+	switch s {
+	case StartFromNow, StartFromEarliestPartition, StartFromTime:
+		return nil
+	default:
+		return fmt.Errorf("%w: '%s'", errUnknownStartFrom, s)
+	}
+}
@@ -0,0 +1,33 @@
+// Copyright 2025 LLC "Ozon Technologies".
+// SPDX-License-Identifier: Apache-2.0
+
+package types
+
+import (
+	"errors"
+	"fmt"
+)
+
+// TimeColumnType is a type of IsRollUpTime column.
+type TimeColumnType string
+
+// Supported types of IsRollUpTime column.
+const (
+	TimeColumnDateTime         TimeColumnType = "DateTime"         // DateTime.
+	TimeColumnDateTime64       TimeColumnType = "DateTime64"       // DateTime64 of any precision.
+	TimeColumnDate             TimeColumnType = "Date"             // Date or Date32.
+	TimeColumnUnixSeconds      TimeColumnType = "UnixSeconds"      // UInt32 with unix time in seconds.
+	TimeColumnUnixMilliseconds TimeColumnType = "UnixMilliseconds" // UInt64 with unix time in milliseconds.
+)
+
+var errUnknownTimeColumnType = errors.New("unknown time column type")
+
+// Validate TimeColumnType.
+func (t TimeColumnType) Validate() error {
+	switch t {
+	case TimeColumnDateTime, TimeColumnDateTime64, TimeColumnDate, TimeColumnUnixSeconds, TimeColumnUnixMilliseconds:
+		return nil
+	default:
+		return fmt.Errorf("%w: '%s'", errUnknownTimeColumnType, t)
+	}
+}
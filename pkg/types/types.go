@@ -7,11 +7,16 @@ package types
 import (
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	sqlUtils "github.com/ozontech/ch-rollup/internal/utils/sql"
 )
 
+// TimezoneAuto makes timezone to be detected from time column type or server settings.
+const TimezoneAuto = "auto"
+
 // Tasks ...
 type Tasks []Task
 
@@ -30,30 +35,139 @@ func (t Tasks) Validate() error {
 type Task struct {
 	Database       string          // The name of the database where the table resides.
 	Table          string          // The name of the table to be configured.
-	PartitionKey   time.Duration   // The key used for partitioning data, typically representing a time interval.
+	PartitionKey   time.Duration   // (Optional) The partition granularity of the table. Default: inferred from partition key of the table.
 	CopyInterval   time.Duration   // This is the interval that will be used when copying data. Default: '1h'.
 	RollUpSettings []RollUpSetting // A slice of settings defining roll up intervals and specific column configurations for those intervals.
 	ColumnSettings []ColumnSetting // A slice of column configuration objects that define how data is grouped and aggregated.
+	Replicated     bool            // (Optional) Must be set if the table uses Replicated*MergeTree engine.
+	// (Optional) If set, failure on one shard doesn't interrupt roll up on other shards and next roll ups.
+	ContinueOnShardError bool
+	MaxParallelShards    int     // (Optional) Limits number of shards rolled up at the same time. Default: no limit.
+	MaxParallelCopies    int     // (Optional) Limits number of copy intervals copied at the same time on each shard. Default: 1.
+	Checks               []Check // (Optional) Checks of rolled up data applied for all roll up settings.
+	CheckTimeBounds      bool    // (Optional) If set, roll up is aborted when rolled up time is out of roll up window.
+	// (Optional) If set, replaced partitions are kept in backup table for the duration and can be restored by RollUp.Restore.
+	BackupRetention time.Duration
+	// (Optional) If set, each partition is committed separately, so interrupted roll up resumes from the first uncommitted partition.
+	CommitPerPartition bool
+	// (Optional) Timezone in which table is partitioned: IANA name or TimezoneAuto.
+	// Default: timezone argument of partition key of the table, if it's set there, otherwise UTC.
+	// Without both, roll up fails if time column or server timezone isn't UTC.
+	Timezone string
+	// (Optional) The partition granularity of the table in calendar units, like monthly partitions. Can't be set with PartitionKey.
+	CalendarPartitionKey CalendarInterval
+	// (Optional) The type of IsRollUpTime column. Default: detected from system.columns.
+	TimeColumnType TimeColumnType
+	// (Optional) If set, columns are generated from the table schema: sorting key columns are grouped by,
+	// AggregateFunction and SimpleAggregateFunction columns get their functions and time column is detected from sorting key.
+	// ColumnSettings override generated ones.
+	AutoColumns bool
+	// (Optional) Functions allowed at expressions of columns, checks and where, aggregate functions are allowed with combinators,
+	// like 'count' allows 'countMergeState'. Default: any function except table functions and functions that read other tables.
+	AllowedFunctions []string
+	// (Optional) The column filled with roll up interval in seconds at rolled up rows on every level, like 'rollup_interval'.
+	// It must be Int32, UInt32, Int64 or UInt64 and must not be set at column settings. Raw rows with zero value of it are
+	// counted at report of roll up.
+	ResolutionColumn string
+	// (Optional) Where roll ups start on the first run: StartFromNow, StartFromEarliestPartition to roll up data
+	// that already exists or StartFromTime. Default: StartFromNow.
+	StartFrom StartFrom
+	// (Optional) The time roll ups start from, it's truncated to partition. Must be set with StartFromTime only.
+	StartTime time.Time
 }
 
 // RollUpSetting defines a specific roll up interval and the columns affected during that interval.
 type RollUpSetting struct {
 	After          time.Duration   // The time duration after which the roll up interval applies.
-	Interval       time.Duration   // The roll up interval duration.
+	Interval       time.Duration   // The roll up interval duration. Can't be set with CalendarInterval.
 	ColumnSettings []ColumnSetting // A slice of column configuration objects that override the top-level column settings for the specified interval.
+	Checks         []Check         // (Optional) Checks of rolled up data applied for the specified interval in addition to the top-level checks.
+	// (Optional) The roll up interval in calendar units, like one row per month. Must be set instead of Interval.
+	CalendarInterval CalendarInterval
+	// (Optional) The predicate of rows to roll up, like "service_tier = 'low'". Other rows are kept untouched.
+	// Time column must be qualified by table in it, like "table"."time".
+	Where string
+	// (Optional) The table to write rolled up data to instead of replacing data of Task.Table, like 'metrics_1h'.
+	// It must exist and have the same columns. Default: Task.Table.
+	TargetTable string
+	// (Optional) The database of TargetTable. Default: Task.Database.
+	TargetDatabase string
+	// (Optional) The age after which partitions of Task.Table rolled up to TargetTable are dropped. Default: never.
+	DropSourceAfter time.Duration
 }
 
 // ColumnSetting defines settings for a specific column.
 type ColumnSetting struct {
 	Name         string // The name of the column.
 	IsRollUpTime bool   // (Optional) A boolean indicating if this column is used as the time reference for roll up.
-	Expression   string // (Optional) The expression used to calculate value for the column. Example: 'countMergeState(counter)'
+	Expression   string // (Optional) The expression used to calculate value for the column. Example: 'countMergeState(counter)'. It can contain ExpressionPlaceholders.
+	// (Optional) The function applied to rolled up time to calculate the column, like 'toDate' for date column of the same row.
+	// It must be one of DerivedTimeFunctions. Roll up window is also applied to the column, so partitions by it are pruned.
+	DerivedFromTime string
+	// (Optional) A boolean indicating that the column is intentionally not copied, so rolled up rows get its default value.
+	IsReset bool
+	// (Optional) The aggregate function of Expression, like 'count' or 'quantiles(0.5, 0.9)'. If set, it's checked against
+	// function of AggregateFunction or SimpleAggregateFunction column before roll up. It's set by MergeState, Sum, Max, Min and Any.
+	AggregateFunction string
+}
+
+// Placeholders of ColumnSetting.Expression, they are expanded by roll up of each RollUpSetting,
+// so one top-level column setting can serve all of them. Example: 'countMergeState({column})'.
+const (
+	PlaceholderColumn      = "{column}"       // The quoted name of the column.
+	PlaceholderIntervalSec = "{interval_sec}" // The roll up interval in seconds. It can't be used with CalendarInterval.
+	PlaceholderAfterSec    = "{after_sec}"    // The After of roll up in seconds.
+	PlaceholderWindowFrom  = "{window_from}"  // The start of rolled up window as DateTime.
+	PlaceholderWindowTo    = "{window_to}"    // The end of rolled up window as DateTime, exclusive.
+)
+
+// ExpressionPlaceholders are placeholders allowed at ColumnSetting.Expression.
+var ExpressionPlaceholders = []string{
+	PlaceholderColumn,
+	PlaceholderIntervalSec,
+	PlaceholderAfterSec,
+	PlaceholderWindowFrom,
+	PlaceholderWindowTo,
+}
+
+// DerivedTimeFunctions are functions allowed at ColumnSetting.DerivedFromTime.
+// All of them are monotonic, so window of time can be applied to their results.
+var DerivedTimeFunctions = []string{
+	"toDate",
+	"toDate32",
+	"toDateTime",
+	"toStartOfHour",
+	"toStartOfDay",
+	"toMonday",
+	"toStartOfMonth",
+	"toStartOfQuarter",
+	"toStartOfYear",
+	"toYYYYMMDD",
+	"toYYYYMM",
+	"toYear",
+}
+
+// Check defines verification of rolled up data before it replaces origin data.
+// Source is calculated over origin rows of roll up window, Target over rolled up rows,
+// and roll up is aborted if values differ more than Tolerance.
+type Check struct {
+	Name      string  // The name of the check used in errors and reports.
+	Source    string  // The expression calculated over origin rows. Example: 'count()'.
+	Target    string  // (Optional) The expression calculated over rolled up rows. Example: 'countMerge(counter)'. Default: Source.
+	Tolerance float64 // (Optional) Allowed relative difference between Source and Target values. Default: 0.
 }
 
 var (
-	errBadPartitionKey    = errors.New("partitionKey must be greater than 0")
-	errManyTimeColumns    = errors.New("only one IsRollUpTime column allowed")
-	errTimeColumnNotFound = errors.New("column with IsRollUpTime not found")
+	errBadPartitionKey     = errors.New("partitionKey must not be negative")
+	errManyPartitionKeys   = errors.New("only one of partitionKey and calendarPartitionKey allowed")
+	errBadMaxParallel      = errors.New("maxParallelShards and maxParallelCopies must not be negative")
+	errBadBackupRetention  = errors.New("backupRetention must not be negative")
+	errManyTimeColumns     = errors.New("only one IsRollUpTime column allowed")
+	errTimeColumnNotFound  = errors.New("column with IsRollUpTime not found")
+	errCalendarIntervalSec = errors.New(PlaceholderIntervalSec + " can't be used with calendarInterval")
+	errResolutionColumnSet = errors.New("resolutionColumn is filled by roll up, it must not be set at column settings")
+	errStartTimeRequired   = errors.New("startTime must be set with startFrom 'time'")
+	errStartTimeNotAllowed = errors.New("startTime can be set only with startFrom 'time'")
 )
 
 // Validate Task.
@@ -66,10 +180,54 @@ func (t *Task) Validate() error {
 		return fmt.Errorf("failed to validate database name: %w", err)
 	}
 
-	if t.PartitionKey <= 0 {
+	if t.PartitionKey < 0 {
 		return errBadPartitionKey
 	}
 
+	if !t.CalendarPartitionKey.IsZero() {
+		if t.PartitionKey != 0 {
+			return errManyPartitionKeys
+		}
+
+		if err := t.CalendarPartitionKey.Validate(); err != nil {
+			return fmt.Errorf("failed to validate calendarPartitionKey: %w", err)
+		}
+	}
+
+	if t.MaxParallelShards < 0 || t.MaxParallelCopies < 0 {
+		return errBadMaxParallel
+	}
+
+	if t.BackupRetention < 0 {
+		return errBadBackupRetention
+	}
+
+	if t.Timezone != "" && t.Timezone != TimezoneAuto {
+		if _, err := time.LoadLocation(t.Timezone); err != nil {
+			return fmt.Errorf("failed to validate timezone: %w", err)
+		}
+	}
+
+	if t.TimeColumnType != "" {
+		if err := t.TimeColumnType.Validate(); err != nil {
+			return fmt.Errorf("failed to validate timeColumnType: %w", err)
+		}
+	}
+
+	if err := validateStart(t.StartFrom, t.StartTime); err != nil {
+		return err
+	}
+
+	if t.ResolutionColumn != "" {
+		if err := sqlUtils.ValidateEntityName(t.ResolutionColumn); err != nil {
+			return fmt.Errorf("failed to validate resolutionColumn name: %w", err)
+		}
+
+		if slices.ContainsFunc(t.ColumnSettings, t.isResolutionColumn) {
+			return errResolutionColumnSet
+		}
+	}
+
 	var rollUpTimeColumnName string
 
 	for _, columnSetting := range t.ColumnSettings {
@@ -86,28 +244,111 @@ func (t *Task) Validate() error {
 		}
 	}
 
-	if rollUpTimeColumnName == "" {
+	if rollUpTimeColumnName == "" && !t.AutoColumns {
 		return errTimeColumnNotFound
 	}
 
+	if err := validateChecks(t.Checks); err != nil {
+		return err
+	}
+
 	for _, rollUpSetting := range t.RollUpSettings {
-		if err := rollUpSetting.Validate(rollUpTimeColumnName); err != nil {
+		err := rollUpSetting.Validate(rollUpTimeColumnName)
+		if err == nil {
+			err = t.validateRollUpSettingExpressions(rollUpSetting)
+		}
+
+		if err != nil {
 			return fmt.Errorf(
 				"failed to validate rollUpSetting with after '%s', interval '%s': %w",
 				rollUpSetting.After.String(),
-				rollUpSetting.Interval.String(),
+				rollUpSetting.intervalString(),
 				err,
 			)
 		}
 	}
 
+	return t.validateExpressions(t.ColumnSettings, t.Checks)
+}
+
+func (t *Task) isResolutionColumn(columnSetting ColumnSetting) bool {
+	return columnSetting.Name == t.ResolutionColumn
+}
+
+// validateExpressions checks expressions of columns and checks against AllowedFunctions.
+func (t *Task) validateExpressions(columnSettings []ColumnSetting, checks []Check) error {
+	opts := sqlUtils.ExpressionOptions{AllowedFunctions: t.AllowedFunctions}
+
+	for _, columnSetting := range columnSettings {
+		if columnSetting.Expression == "" {
+			continue
+		}
+
+		columnOpts := opts
+		columnOpts.Placeholders = ExpressionPlaceholders
+
+		if err := sqlUtils.ValidateExpression(columnSetting.Expression, columnOpts); err != nil {
+			return fmt.Errorf("failed to validate expression of column '%s': %w", columnSetting.Name, err)
+		}
+	}
+
+	for _, check := range checks {
+		for _, expression := range []string{check.Source, check.Target} {
+			if expression == "" {
+				continue
+			}
+
+			if err := sqlUtils.ValidateExpression(expression, opts); err != nil {
+				return fmt.Errorf("failed to validate expression of check '%s': %w", check.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateRollUpSettingExpressions checks expressions of RollUpSetting against AllowedFunctions.
+// Where can qualify columns by the table only.
+func (t *Task) validateRollUpSettingExpressions(rs RollUpSetting) error {
+	if err := t.validateExpressions(rs.ColumnSettings, rs.Checks); err != nil {
+		return err
+	}
+
+	if t.ResolutionColumn != "" && slices.ContainsFunc(rs.ColumnSettings, t.isResolutionColumn) {
+		return errResolutionColumnSet
+	}
+
+	if !rs.CalendarInterval.IsZero() {
+		for _, columnSetting := range slices.Concat(t.ColumnSettings, rs.ColumnSettings) {
+			if strings.Contains(columnSetting.Expression, PlaceholderIntervalSec) {
+				return fmt.Errorf("%w: column '%s'", errCalendarIntervalSec, columnSetting.Name)
+			}
+		}
+	}
+
+	if rs.Where == "" {
+		return nil
+	}
+
+	opts := sqlUtils.ExpressionOptions{
+		AllowedFunctions:  t.AllowedFunctions,
+		AllowedQualifiers: []string{t.Table},
+	}
+
+	if err := sqlUtils.ValidateExpression(rs.Where, opts); err != nil {
+		return fmt.Errorf("failed to validate where: %w", err)
+	}
+
 	return nil
 }
 
 var (
 	errBadAfter             = errors.New("after must be greater than 0")
 	errBadInterval          = errors.New("interval must be greater than 0")
+	errManyIntervals        = errors.New("only one of interval and calendarInterval allowed")
 	errUnexpectedTimeColumn = errors.New("rollUpTime column can be defined only in global settings")
+	errBadDropSourceAfter   = errors.New("dropSourceAfter must not be negative")
+	errDropSourceInPlace    = errors.New("dropSourceAfter can be set only with targetTable or targetDatabase")
 )
 
 // Validate RollUpSetting.
@@ -116,8 +357,38 @@ func (rs *RollUpSetting) Validate(rollUpTimeColumnName string) error {
 		return errBadAfter
 	}
 
-	if rs.Interval <= 0 {
-		return errBadInterval
+	if rs.CalendarInterval.IsZero() {
+		if rs.Interval <= 0 {
+			return errBadInterval
+		}
+	} else {
+		if rs.Interval != 0 {
+			return errManyIntervals
+		}
+
+		if err := rs.CalendarInterval.Validate(); err != nil {
+			return fmt.Errorf("failed to validate calendarInterval: %w", err)
+		}
+	}
+
+	if rs.TargetTable != "" {
+		if err := sqlUtils.ValidateEntityName(rs.TargetTable); err != nil {
+			return fmt.Errorf("failed to validate targetTable name: %w", err)
+		}
+	}
+
+	if rs.TargetDatabase != "" {
+		if err := sqlUtils.ValidateEntityName(rs.TargetDatabase); err != nil {
+			return fmt.Errorf("failed to validate targetDatabase name: %w", err)
+		}
+	}
+
+	if rs.DropSourceAfter < 0 {
+		return errBadDropSourceAfter
+	}
+
+	if rs.DropSourceAfter > 0 && rs.TargetTable == "" && rs.TargetDatabase == "" {
+		return errDropSourceInPlace
 	}
 
 	for _, columnSetting := range rs.ColumnSettings {
@@ -130,14 +401,115 @@ func (rs *RollUpSetting) Validate(rollUpTimeColumnName string) error {
 		}
 	}
 
-	return nil
+	return validateChecks(rs.Checks)
+}
+
+func (rs *RollUpSetting) intervalString() string {
+	if !rs.CalendarInterval.IsZero() {
+		return rs.CalendarInterval.String()
+	}
+
+	return rs.Interval.String()
 }
 
+var (
+	errUnknownDerivedTimeFunction = errors.New("unknown derivedFromTime function")
+	errDerivedTimeColumn          = errors.New("derivedFromTime can't be set with isRollUpTime or expression")
+	errResetColumn                = errors.New("isReset can't be set with isRollUpTime, expression or derivedFromTime")
+	errAggregateFunctionColumn    = errors.New("aggregateFunction can be set only with expression")
+)
+
 // Validate ColumnSetting.
 func (cs *ColumnSetting) Validate() error {
 	if err := sqlUtils.ValidateEntityName(cs.Name); err != nil {
 		return fmt.Errorf("failed to validate name: %w", err)
 	}
 
+	if cs.IsReset && (cs.IsRollUpTime || cs.Expression != "" || cs.DerivedFromTime != "") {
+		return errResetColumn
+	}
+
+	if cs.DerivedFromTime != "" {
+		if cs.IsRollUpTime || cs.Expression != "" {
+			return errDerivedTimeColumn
+		}
+
+		if !slices.Contains(DerivedTimeFunctions, cs.DerivedFromTime) {
+			return fmt.Errorf("%w: '%s'", errUnknownDerivedTimeFunction, cs.DerivedFromTime)
+		}
+	}
+
+	if cs.AggregateFunction != "" && cs.Expression == "" {
+		return errAggregateFunctionColumn
+	}
+
+	if cs.Expression != "" {
+		if err := sqlUtils.ValidateExpression(cs.Expression, sqlUtils.ExpressionOptions{Placeholders: ExpressionPlaceholders}); err != nil {
+			return fmt.Errorf("failed to validate expression: %w", err)
+		}
+	}
+
+	return nil
+}
+
+var (
+	errEmptyCheckName   = errors.New("name must not be empty")
+	errEmptyCheckSource = errors.New("source must not be empty")
+	errBadTolerance     = errors.New("tolerance must not be negative")
+)
+
+// Validate Check.
+func (c *Check) Validate() error {
+	if c.Name == "" {
+		return errEmptyCheckName
+	}
+
+	if c.Source == "" {
+		return errEmptyCheckSource
+	}
+
+	if err := sqlUtils.ValidateExpression(c.Source, sqlUtils.ExpressionOptions{}); err != nil {
+		return fmt.Errorf("failed to validate source: %w", err)
+	}
+
+	if c.Target != "" {
+		if err := sqlUtils.ValidateExpression(c.Target, sqlUtils.ExpressionOptions{}); err != nil {
+			return fmt.Errorf("failed to validate target: %w", err)
+		}
+	}
+
+	if c.Tolerance < 0 {
+		return errBadTolerance
+	}
+
+	return nil
+}
+
+func validateChecks(checks []Check) error {
+	for _, check := range checks {
+		if err := check.Validate(); err != nil {
+			return fmt.Errorf("failed to validate check '%s': %w", check.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// validateStart checks that StartTime is set with StartFromTime only.
+func validateStart(startFrom StartFrom, startTime time.Time) error {
+	if startFrom != "" {
+		if err := startFrom.Validate(); err != nil {
+			return fmt.Errorf("failed to validate startFrom: %w", err)
+		}
+	}
+
+	if startFrom == StartFromTime && startTime.IsZero() {
+		return errStartTimeRequired
+	}
+
+	if startFrom != StartFromTime && !startTime.IsZero() {
+		return errStartTimeNotAllowed
+	}
+
 	return nil
 }
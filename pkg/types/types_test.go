@@ -4,6 +4,7 @@
 package types
 
 import (
+	"slices"
 	"testing"
 	"time"
 
@@ -39,11 +40,17 @@ func TestTask_Validate(t *testing.T) {
 	)
 
 	type fields struct {
-		Database       string
-		Table          string
-		PartitionKey   time.Duration
-		RollUpSettings []RollUpSetting
-		ColumnSettings []ColumnSetting
+		Database         string
+		Table            string
+		PartitionKey     time.Duration
+		RollUpSettings   []RollUpSetting
+		ColumnSettings   []ColumnSetting
+		TimeColumnType   TimeColumnType
+		AutoColumns      bool
+		AllowedFunctions []string
+		ResolutionColumn string
+		StartFrom        StartFrom
+		StartTime        time.Time
 	}
 	tests := []struct {
 		name    string
@@ -60,6 +67,15 @@ func TestTask_Validate(t *testing.T) {
 				ColumnSettings: testColumnSettings,
 			},
 		},
+		{
+			name: "Ok without partition key",
+			fields: fields{
+				Database:       testDatabase,
+				Table:          testTable,
+				RollUpSettings: testRollupSettings,
+				ColumnSettings: testColumnSettings,
+			},
+		},
 		{
 			name: "Bad database",
 			fields: fields{
@@ -93,6 +109,27 @@ func TestTask_Validate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "Ok with time column type",
+			fields: fields{
+				Database:       testDatabase,
+				Table:          testTable,
+				RollUpSettings: testRollupSettings,
+				ColumnSettings: testColumnSettings,
+				TimeColumnType: TimeColumnDateTime64,
+			},
+		},
+		{
+			name: "Bad time column type",
+			fields: fields{
+				Database:       testDatabase,
+				Table:          testTable,
+				RollUpSettings: testRollupSettings,
+				ColumnSettings: testColumnSettings,
+				TimeColumnType: "Time",
+			},
+			wantErr: true,
+		},
 		{
 			name: "Failed to validate column",
 			fields: fields{
@@ -143,6 +180,139 @@ func TestTask_Validate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "Ok auto columns without time column",
+			fields: fields{
+				Database:       testDatabase,
+				Table:          testTable,
+				RollUpSettings: testRollupSettings,
+				AutoColumns:    true,
+			},
+		},
+		{
+			name: "Ok allowed functions",
+			fields: fields{
+				Database: testDatabase,
+				Table:    testTable,
+				RollUpSettings: []RollUpSetting{
+					{
+						After:    time.Hour * 24,
+						Interval: time.Hour,
+						Where:    `"test_table"."time_column" < now()`,
+					},
+				},
+				ColumnSettings:   append(slices.Clone(testColumnSettings), ColumnSetting{Name: "hits", Expression: "countMergeState(hits)"}),
+				AllowedFunctions: []string{"count", "now"},
+			},
+		},
+		{
+			name: "Not allowed function",
+			fields: fields{
+				Database:         testDatabase,
+				Table:            testTable,
+				RollUpSettings:   testRollupSettings,
+				ColumnSettings:   append(slices.Clone(testColumnSettings), ColumnSetting{Name: "hits", Expression: "sumMergeState(hits)"}),
+				AllowedFunctions: []string{"count"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Interval seconds with calendar interval",
+			fields: fields{
+				Database: testDatabase,
+				Table:    testTable,
+				RollUpSettings: []RollUpSetting{
+					{
+						After:            time.Hour * 24,
+						CalendarInterval: CalendarInterval{Unit: CalendarMonth},
+					},
+				},
+				ColumnSettings: append(slices.Clone(testColumnSettings), ColumnSetting{Name: "rollup_interval", Expression: PlaceholderIntervalSec}),
+			},
+			wantErr: true,
+		},
+		{
+			name: "Ok resolution column",
+			fields: fields{
+				Database:         testDatabase,
+				Table:            testTable,
+				RollUpSettings:   testRollupSettings,
+				ColumnSettings:   testColumnSettings,
+				ResolutionColumn: "rollup_interval",
+			},
+		},
+		{
+			name: "Resolution column at column settings",
+			fields: fields{
+				Database:         testDatabase,
+				Table:            testTable,
+				RollUpSettings:   testRollupSettings,
+				ColumnSettings:   testColumnSettings,
+				ResolutionColumn: "test_column",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Ok start from time",
+			fields: fields{
+				Database:       testDatabase,
+				Table:          testTable,
+				RollUpSettings: testRollupSettings,
+				ColumnSettings: testColumnSettings,
+				StartFrom:      StartFromTime,
+				StartTime:      time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "Start from time without start time",
+			fields: fields{
+				Database:       testDatabase,
+				Table:          testTable,
+				RollUpSettings: testRollupSettings,
+				ColumnSettings: testColumnSettings,
+				StartFrom:      StartFromTime,
+			},
+			wantErr: true,
+		},
+		{
+			name: "Start time with start from earliest partition",
+			fields: fields{
+				Database:       testDatabase,
+				Table:          testTable,
+				RollUpSettings: testRollupSettings,
+				ColumnSettings: testColumnSettings,
+				StartFrom:      StartFromEarliestPartition,
+				StartTime:      time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+			},
+			wantErr: true,
+		},
+		{
+			name: "Unknown start from",
+			fields: fields{
+				Database:       testDatabase,
+				Table:          testTable,
+				RollUpSettings: testRollupSettings,
+				ColumnSettings: testColumnSettings,
+				StartFrom:      "yesterday",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Where references other table",
+			fields: fields{
+				Database: testDatabase,
+				Table:    testTable,
+				RollUpSettings: []RollUpSetting{
+					{
+						After:    time.Hour * 24,
+						Interval: time.Hour,
+						Where:    `"other_table"."time_column" < now()`,
+					},
+				},
+				ColumnSettings: testColumnSettings,
+			},
+			wantErr: true,
+		},
 		{
 			name: "Failed to validate rollup settings",
 			fields: fields{
@@ -162,11 +332,17 @@ func TestTask_Validate(t *testing.T) {
 			t.Parallel()
 
 			task := &Task{
-				Database:       tt.fields.Database,
-				Table:          tt.fields.Table,
-				PartitionKey:   tt.fields.PartitionKey,
-				RollUpSettings: tt.fields.RollUpSettings,
-				ColumnSettings: tt.fields.ColumnSettings,
+				Database:         tt.fields.Database,
+				Table:            tt.fields.Table,
+				PartitionKey:     tt.fields.PartitionKey,
+				RollUpSettings:   tt.fields.RollUpSettings,
+				ColumnSettings:   tt.fields.ColumnSettings,
+				TimeColumnType:   tt.fields.TimeColumnType,
+				AutoColumns:      tt.fields.AutoColumns,
+				AllowedFunctions: tt.fields.AllowedFunctions,
+				ResolutionColumn: tt.fields.ResolutionColumn,
+				StartFrom:        tt.fields.StartFrom,
+				StartTime:        tt.fields.StartTime,
 			}
 			assert.Equal(t, tt.wantErr, task.Validate() != nil)
 		})
@@ -193,6 +369,11 @@ func TestRollUpSetting_Validate(t *testing.T) {
 		After          time.Duration
 		Interval       time.Duration
 		ColumnSettings []ColumnSetting
+		Checks         []Check
+
+		CalendarInterval CalendarInterval
+		TargetTable      string
+		DropSourceAfter  time.Duration
 	}
 	tests := []struct {
 		name                 string
@@ -217,6 +398,26 @@ func TestRollUpSetting_Validate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "Ok calendar interval",
+			fields: fields{
+				After:          testAfter,
+				ColumnSettings: testColumnSettings,
+
+				CalendarInterval: CalendarInterval{Unit: CalendarMonth},
+			},
+		},
+		{
+			name: "Many intervals",
+			fields: fields{
+				After:          testAfter,
+				Interval:       testInterval,
+				ColumnSettings: testColumnSettings,
+
+				CalendarInterval: CalendarInterval{Unit: CalendarMonth},
+			},
+			wantErr: true,
+		},
 		{
 			name: "Empty interval",
 			fields: fields{
@@ -251,6 +452,53 @@ func TestRollUpSetting_Validate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "Bad check",
+			fields: fields{
+				After:          testAfter,
+				Interval:       testInterval,
+				ColumnSettings: testColumnSettings,
+				Checks: []Check{
+					{
+						Name: "rows",
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Ok target table",
+			fields: fields{
+				After:          testAfter,
+				Interval:       testInterval,
+				ColumnSettings: testColumnSettings,
+
+				TargetTable:     "metrics_1h",
+				DropSourceAfter: time.Hour * 24 * 30,
+			},
+		},
+		{
+			name: "Bad target table",
+			fields: fields{
+				After:          testAfter,
+				Interval:       testInterval,
+				ColumnSettings: testColumnSettings,
+
+				TargetTable: "metrics-1h",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Drop source in place",
+			fields: fields{
+				After:          testAfter,
+				Interval:       testInterval,
+				ColumnSettings: testColumnSettings,
+
+				DropSourceAfter: time.Hour * 24 * 30,
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -260,6 +508,11 @@ func TestRollUpSetting_Validate(t *testing.T) {
 				After:          tt.fields.After,
 				Interval:       tt.fields.Interval,
 				ColumnSettings: tt.fields.ColumnSettings,
+				Checks:         tt.fields.Checks,
+
+				CalendarInterval: tt.fields.CalendarInterval,
+				TargetTable:      tt.fields.TargetTable,
+				DropSourceAfter:  tt.fields.DropSourceAfter,
 			}
 			assert.Equal(
 				t,
@@ -269,3 +522,184 @@ func TestRollUpSetting_Validate(t *testing.T) {
 		})
 	}
 }
+
+func TestColumnSetting_Validate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		columnSetting ColumnSetting
+		wantErr       bool
+	}{
+		{
+			name: "Ok",
+			columnSetting: ColumnSetting{
+				Name: "column",
+			},
+		},
+		{
+			name: "Ok derived from time",
+			columnSetting: ColumnSetting{
+				Name:            "event_date",
+				DerivedFromTime: "toDate",
+			},
+		},
+		{
+			name: "Ok reset",
+			columnSetting: ColumnSetting{
+				Name:    "column",
+				IsReset: true,
+			},
+		},
+		{
+			name: "Ok placeholders",
+			columnSetting: ColumnSetting{
+				Name:       "column",
+				Expression: "countMergeState({column}) * {interval_sec}",
+			},
+		},
+		{
+			name: "Unknown placeholder",
+			columnSetting: ColumnSetting{
+				Name:       "column",
+				Expression: "countMergeState({table})",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Bad name",
+			columnSetting: ColumnSetting{
+				Name: "bad-column",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Reset column with expression",
+			columnSetting: ColumnSetting{
+				Name:       "column",
+				Expression: "any(column)",
+				IsReset:    true,
+			},
+			wantErr: true,
+		},
+		{
+			name: "Injected expression",
+			columnSetting: ColumnSetting{
+				Name:       "column",
+				Expression: "any(column) FROM url('http://example.com', CSV)",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Aggregate function without expression",
+			columnSetting: ColumnSetting{
+				Name:              "column",
+				AggregateFunction: "count",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Unknown derived time function",
+			columnSetting: ColumnSetting{
+				Name:            "event_date",
+				DerivedFromTime: "toString",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Derived time column with expression",
+			columnSetting: ColumnSetting{
+				Name:            "event_date",
+				Expression:      "any(event_date)",
+				DerivedFromTime: "toDate",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tt.wantErr, tt.columnSetting.Validate() != nil)
+		})
+	}
+}
+
+func TestCheck_Validate(t *testing.T) {
+	t.Parallel()
+
+	type fields struct {
+		Name      string
+		Source    string
+		Target    string
+		Tolerance float64
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		wantErr bool
+	}{
+		{
+			name: "Ok",
+			fields: fields{
+				Name:   "rows",
+				Source: "count()",
+				Target: "countMerge(counter)",
+			},
+		},
+		{
+			name: "Ok with tolerance",
+			fields: fields{
+				Name:      "value",
+				Source:    "sum(value)",
+				Tolerance: 0.001,
+			},
+		},
+		{
+			name: "Empty name",
+			fields: fields{
+				Source: "count()",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Empty source",
+			fields: fields{
+				Name:   "rows",
+				Target: "countMerge(counter)",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Subquery at target",
+			fields: fields{
+				Name:   "rows",
+				Source: "count()",
+				Target: "(SELECT count() FROM other_table)",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Negative tolerance",
+			fields: fields{
+				Name:      "value",
+				Source:    "sum(value)",
+				Tolerance: -0.1,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			c := &Check{
+				Name:      tt.fields.Name,
+				Source:    tt.fields.Source,
+				Target:    tt.fields.Target,
+				Tolerance: tt.fields.Tolerance,
+			}
+			assert.Equal(t, tt.wantErr, c.Validate() != nil)
+		})
+	}
+}